@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"go-radio/internal/batch"
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// recordBatch は一覧の番組を1回の認証でまとめて録音し、1件ごとの結果を表示する
+func recordBatch(ctx context.Context, client *radiko.Client, config *radiko.Config, logger *radiko.Logger, chapterOpts radiko.ChapterOptions, st storage.Storage, lib *library.Library, path string) {
+	items, err := batch.Load(path)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	logger.Info("radikoクライアント初期化...")
+	if err := client.AuthContext(ctx); err != nil {
+		logger.Fatal("クライアント初期化に失敗: %v", err)
+	}
+	logger.Info("初期化完了")
+
+	logger.Info("%d件の番組をまとめて録音します", len(items))
+	results := batch.Run(ctx, items, config.BatchConcurrency, func(ctx context.Context, item batch.Item) (string, error) {
+		p, err := item.Program(config)
+		if err != nil {
+			return "", err
+		}
+		if alreadyRecorded(lib, logger, p) {
+			return "録音済みのためスキップ", nil
+		}
+		outputFile, err := radiko.BuildOutputPath(config, p.StationID, item.Output, p.Start)
+		if err != nil {
+			return "", err
+		}
+		if err := record(ctx, client, config, logger, chapterOpts, st, lib, p, outputFile); err != nil {
+			return "", err
+		}
+		return outputFile, nil
+	})
+
+	failed := false
+	for _, r := range results {
+		if r.OK() {
+			logger.Info("[成功] %s %s: %s (%.0f秒)", r.Station, r.Start, r.Result, r.Elapsed)
+		} else {
+			logger.Error("[失敗] %s %s: %s", r.Station, r.Start, r.Error)
+			failed = true
+		}
+	}
+	logger.Info("まとめて録音: %s", batch.Summary(results))
+	if failed {
+		os.Exit(1)
+	}
+}
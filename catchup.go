@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"go-radio/internal/batch"
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// timeFreeWindow はタイムフリーで録音できる期間
+const timeFreeWindow = 7 * 24 * time.Hour
+
+// runCatchup は番組表から検索条件に一致する過去の番組を探し、まだ録音していないものをまとめて録音する。
+// 定期録音が失敗した回をタイムフリーの期間内に取り戻すために使う
+func runCatchup(args []string) {
+	config, err := radiko.LoadConfigWithEnv()
+
+	fs := flag.NewFlagSet("catchup", flag.ExitOnError)
+	var (
+		stations = fs.String("station", "", "ラジオ局ID (カンマ区切りで複数指定可)")
+		title    = fs.String("title", "", "番組名で検索")
+		keyword  = fs.String("keyword", "", "番組名・出演者・説明のキーワードで検索")
+		since    = fs.String("since", "7d", "さかのぼる期間 (7d, 48h など。最大7日)")
+		upload   = fs.String("upload", config.UploadURL, "録音後にアップロードする保存先 (s3://bucket/prefix, gs://, webdav://, file:///dir)")
+		verbose  = fs.Bool("verbose", false, "詳細なログを表示")
+	)
+	fs.Parse(args)
+
+	logger := radiko.NewLogger(*verbose)
+	if err != nil {
+		logger.Error("設定読み込み警告: %v", err)
+	}
+	config.UploadURL = *upload
+
+	filter := radiko.ProgramFilter{Title: *title, Keyword: *keyword}
+	if *stations == "" || filter.IsEmpty() {
+		logger.Info("使用方法:")
+		logger.Info("  go run . catchup -station=TBS -keyword=\"深夜\" -since=7d")
+		os.Exit(1)
+	}
+	period, err := radiko.ParsePeriod(*since)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if period > timeFreeWindow {
+		logger.Info("タイムフリーで録音できるのは過去1週間分のため、期間を7日にします")
+		period = timeFreeWindow
+	}
+	chapterOpts, err := radiko.ParseChapterOptions(config.Chapters)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if err := storage.ValidateKeyTemplate(config.UploadKey); err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	// Ctrl+Cで録音を中断できるようにする（途中までのファイルは削除される）
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var st storage.Storage
+	if config.UploadURL != "" {
+		if st, err = storage.Open(ctx, config.UploadURL); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+
+	lib, err := library.OpenConfigured(ctx, config.Library, nil)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	client := radiko.NewClient()
+	client.SetLogger(logger)
+	client.ApplyConfig(config)
+
+	now := time.Now()
+	from := now.Add(-period)
+	failed := false
+
+	// 録音する番組。batch.Runで並行して録音するため、番組はItemから引けるようにしておく
+	var items []batch.Item
+	programs := map[batch.Item]radiko.Program{}
+	for _, stationID := range strings.Split(*stations, ",") {
+		stationID = strings.TrimSpace(stationID)
+		if alias, ok := config.StationAliases[strings.ToLower(stationID)]; ok {
+			stationID = alias
+		}
+
+		logger.Info("番組表を検索中: 局=%s, 番組名=%q, キーワード=%q", stationID, filter.Title, filter.Keyword)
+		found, err := client.FindTimeFreeProgramsContext(ctx, stationID, filter, now)
+		if err != nil {
+			logger.Error("番組検索に失敗: %v", err)
+			failed = true
+			continue
+		}
+		for _, p := range found {
+			if p.Start.Before(from) {
+				continue
+			}
+			if _, ok := lib.Find(p); ok {
+				logger.Debug("ライブラリに録音済みのためスキップします: %s %s", p.Title, p.Start.Format("2006-01-02 15:04"))
+				continue
+			}
+			outputFile, err := radiko.BuildOutputPath(config, stationID, "", p.Start)
+			if err != nil {
+				logger.Fatal("出力パス生成に失敗: %v", err)
+			}
+			done, err := recorded(ctx, st, config, p, outputFile)
+			if err != nil {
+				logger.Error("%s %s: 録音済みか確認できません: %v", p.Title, p.Start.Format("2006-01-02 15:04"), err)
+				failed = true
+				continue
+			}
+			if done {
+				logger.Debug("録音済みのためスキップします: %s %s", p.Title, p.Start.Format("2006-01-02 15:04"))
+				continue
+			}
+			item := batch.Item{Station: stationID, Start: p.Start.Format("2006-01-02 15:04"), Duration: p.Duration(), Output: outputFile}
+			items = append(items, item)
+			programs[item] = p
+		}
+	}
+
+	if len(items) == 0 {
+		logger.Info("録音していない番組はありません")
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("radikoクライアント初期化...")
+	if err := client.AuthContext(ctx); err != nil {
+		logger.Fatal("クライアント初期化に失敗: %v", err)
+	}
+	logger.Info("初期化完了")
+
+	logger.Info("録音していない%d件の番組を録音します", len(items))
+	results := batch.Run(ctx, items, config.BatchConcurrency, func(ctx context.Context, item batch.Item) (string, error) {
+		p := programs[item]
+		logger.Info("録音開始: %s %s -> %s", p.Title, item.Start, item.Output)
+		if err := record(ctx, client, config, logger, chapterOpts, st, lib, p, item.Output); err != nil {
+			return "", err
+		}
+		return item.Output, nil
+	})
+
+	for _, r := range results {
+		p := programs[r.Item]
+		if r.OK() {
+			logger.Info("[成功] %s %s: %s (%.0f秒)", p.Title, r.Start, r.Result, r.Elapsed)
+		} else {
+			logger.Error("[失敗] %s %s: %s", p.Title, r.Start, r.Error)
+			failed = true
+		}
+	}
+	logger.Info("catchup: %s", batch.Summary(results))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// recorded は番組がローカルの出力先か保存先にすでに録音されているかを返す。
+// 保存先のキーは録音後のアップロード（publish）と同じく番組表のタグ情報から決める
+func recorded(ctx context.Context, st storage.Storage, config *radiko.Config, p radiko.Program, outputFile string) (bool, error) {
+	if _, err := os.Stat(outputFile); err == nil {
+		return true, nil
+	}
+	if st == nil {
+		return false, nil
+	}
+	key, _, err := storage.RecordingTarget(config, radiko.NewMetadata(p), p, outputFile)
+	if err != nil {
+		return false, err
+	}
+	ok, err := storage.Exists(ctx, st, key)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", st.URL(key), err)
+	}
+	return ok, nil
+}
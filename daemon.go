@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+	"go-radio/internal/schedule"
+	"go-radio/internal/storage"
+)
+
+// runDaemon はスケジュールファイルに従って定期的に放送をタイムフリーで録音し続ける
+func runDaemon(args []string) {
+	config, err := radiko.LoadConfigWithEnv()
+	homeDir, _ := os.UserHomeDir()
+
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	var (
+		schedulePath = fs.String("schedule", filepath.Join(homeDir, ".go-radio", "schedule.json"), "スケジュールファイル")
+		upload       = fs.String("upload", config.UploadURL, "録音後にアップロードする保存先 (s3://bucket/prefix, gs://, webdav://, file:///dir)")
+		verbose      = fs.Bool("verbose", false, "詳細なログを表示")
+	)
+	fs.Parse(args)
+
+	logger := radiko.NewLogger(*verbose)
+	if err != nil {
+		logger.Error("設定読み込み警告: %v", err)
+	}
+	config.UploadURL = *upload
+
+	chapterOpts, err := radiko.ParseChapterOptions(config.Chapters)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if err := storage.ValidateKeyTemplate(config.UploadKey); err != nil {
+		logger.Fatal("%v", err)
+	}
+	s, err := schedule.Load(*schedulePath)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	s.ResolveStations(config)
+	for _, job := range s.Jobs {
+		if err := storage.ValidateKeyTemplate(job.Output); err != nil {
+			logger.Fatal("%s: %v", job.Name, err)
+		}
+	}
+
+	// Ctrl+Cで停止する（録音中の場合は途中までのファイルは削除される）
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var st storage.Storage
+	if config.UploadURL != "" {
+		if st, err = storage.Open(ctx, config.UploadURL); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+
+	lib, err := library.OpenConfigured(ctx, config.Library, nil)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	client := radiko.NewClient()
+	client.SetLogger(logger)
+	client.ApplyConfig(config)
+
+	recordJob := func(ctx context.Context, job schedule.Job, start time.Time) error {
+		stationID := job.Station
+		outputFile, err := job.OutputPath(config, stationID, start)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(outputFile); err == nil {
+			logger.Info("%s: 録音済みのためスキップします: %s", job.Name, outputFile)
+			return nil
+		}
+		p := radiko.Program{StationID: stationID, Start: start, End: start.Add(job.Length())}
+		if alreadyRecorded(lib, logger, p) {
+			return nil
+		}
+
+		// トークンの期限が切れている場合に備えて録音ごとに認証する
+		if err := client.AuthContext(ctx); err != nil {
+			return err
+		}
+		if err := record(ctx, client, config, logger, chapterOpts, st, lib, p, outputFile); err != nil {
+			return err
+		}
+		logger.Info("録音完了: %s", outputFile)
+		return nil
+	}
+
+	logger.Info("スケジュールを読み込みました: %s (%d件)", *schedulePath, len(s.Jobs))
+	err = schedule.NewRunner(s, recordJob, logger).Run(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Fatal("%v", err)
+	}
+	logger.Info("停止しました")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"go-radio/internal/feed"
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// runFeed は保存先の録音ファイルからポッドキャスト用のRSSフィードを生成する
+func runFeed(args []string) {
+	config, err := radiko.LoadConfigWithEnv()
+	location := config.UploadURL
+	if location == "" {
+		location = config.DefaultOutputDir
+	}
+
+	fs := flag.NewFlagSet("feed", flag.ExitOnError)
+	var (
+		dir     = fs.String("dir", location, "録音ファイルの保存先 (ディレクトリまたは s3:// などのURL)")
+		by      = fs.String("by", config.FeedBy, "フィードのまとめ方 (station: 局ごと, program: 番組ごと)")
+		baseURL = fs.String("base-url", config.FeedBaseURL, "録音ファイルを公開するhttp(s)のURL")
+		verbose = fs.Bool("verbose", false, "詳細なログを表示")
+	)
+	fs.Parse(args)
+
+	logger := radiko.NewLogger(*verbose)
+	if err != nil {
+		logger.Error("設定読み込み警告: %v", err)
+	}
+	if *baseURL == "" {
+		logger.Info("使用方法:")
+		logger.Info("  go run . feed -base-url=https://example.com/radio  # 録音ファイルを公開するURLを指定")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	st, err := storage.Open(ctx, *dir)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	keys, err := feed.Write(ctx, st, *by, *baseURL)
+	if err != nil {
+		logger.Fatal("フィードの生成に失敗: %v", err)
+	}
+	for _, key := range keys {
+		logger.Info("フィードを生成しました: %s", st.URL(key))
+	}
+}
+
+// writeEpisodeInfo はフィード生成用の番組情報を録音ファイルの横に保存する
+func writeEpisodeInfo(logger *radiko.Logger, md radiko.Metadata, p radiko.Program, outputFile string) {
+	info := feed.NewEpisodeInfo(md, p.StationID, p.End.Sub(p.Start))
+	if err := feed.WriteInfo(feed.InfoPath(outputFile), info); err != nil {
+		logger.Error("番組情報の保存に失敗: %v", err)
+	}
+}
+
+// publish は録音ファイルと番組情報を保存先にアップロードし、
+// フィードの公開URLが設定されていればその録音を含むフィードを更新する。アップロード先のURLを返す（保存先がなければ空）
+func publish(ctx context.Context, st storage.Storage, config *radiko.Config, logger *radiko.Logger, md radiko.Metadata, p radiko.Program, outputFile string) (string, error) {
+	if st == nil {
+		return "", nil
+	}
+	key, opts, err := storage.RecordingTarget(config, md, p, outputFile)
+	if err != nil {
+		return "", err
+	}
+	if err := storage.UploadFile(ctx, st, key, outputFile, opts); err != nil {
+		return "", err
+	}
+	logger.Info("アップロード完了: %s", st.URL(key))
+
+	opts.ContentType = storage.ContentType(feed.InfoPath(outputFile))
+	if err := storage.UploadFile(ctx, st, feed.InfoPath(key), feed.InfoPath(outputFile), opts); err != nil {
+		logger.Error("番組情報のアップロードに失敗: %v", err)
+	}
+	feed.TryUpdate(ctx, logger, st, config, key, feed.NewEpisodeInfo(md, p.StationID, p.End.Sub(p.Start)))
+	return st.URL(key), nil
+}
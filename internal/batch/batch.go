@@ -0,0 +1,145 @@
+// Package batch は複数の番組をまとめて録音する
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+// DefaultConcurrency は同時に録音する番組数のデフォルト
+const DefaultConcurrency = 2
+
+// Item はまとめて録音する1件
+type Item struct {
+	Station string `json:"station"`
+	// Start は開始時間（日本時間の "YYYY-MM-DD HH:MM"）
+	Start string `json:"start"`
+	// Duration は録音時間（分）。省略時は設定のデフォルト
+	Duration int    `json:"duration,omitempty"`
+	Output   string `json:"output,omitempty"`
+}
+
+// Result は1件の録音結果
+type Result struct {
+	Item
+	// Result はRecordFuncが返した結果（録音したファイルなど）
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Elapsed は録音にかかった時間（秒）
+	Elapsed float64 `json:"elapsed"`
+}
+
+// OK は録音に成功したかを返す
+func (r Result) OK() bool {
+	return r.Error == ""
+}
+
+// RecordFunc は1件を録音し、録音したファイルなどの結果を返す
+type RecordFunc func(ctx context.Context, item Item) (string, error)
+
+// Load はJSONの配列で書いた録音の一覧を読み込む
+func Load(path string) ([]Item, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("録音一覧の読み込みに失敗: %w", err)
+	}
+	var items []Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("録音一覧の形式が正しくありません: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("録音一覧が空です: %s", path)
+	}
+	return items, nil
+}
+
+// Program は設定の局IDのエイリアスとデフォルトの録音時間を反映して録音する番組を返す
+func (i Item) Program(cfg *radiko.Config) (radiko.Program, error) {
+	if i.Station == "" {
+		return radiko.Program{}, fmt.Errorf("stationを指定してください")
+	}
+	stationID := i.Station
+	if alias, ok := cfg.StationAliases[strings.ToLower(stationID)]; ok {
+		stationID = alias
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04", i.Start, radiko.JST())
+	if err != nil {
+		return radiko.Program{}, fmt.Errorf("時間の形式が正しくありません: %w", err)
+	}
+	if err := radiko.ValidateDateTime(start); err != nil {
+		return radiko.Program{}, err
+	}
+	duration := i.Duration
+	if duration <= 0 {
+		duration = cfg.DefaultDuration
+	}
+	return radiko.Program{
+		StationID: stationID,
+		Start:     start,
+		End:       start.Add(time.Duration(duration) * time.Minute),
+	}, nil
+}
+
+// Run はitemsを最大concurrency件ずつ並行して録音し、itemsと同じ順番で結果を返す。
+// 1件が失敗しても残りの録音は続ける
+func Run(ctx context.Context, items []Item, concurrency int, record RecordFunc) []Result {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	results := make([]Result, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		results[i].Item = item
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Error = ctx.Err().Error()
+			continue
+		}
+		wg.Add(1)
+		go func(r *Result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			result, err := record(ctx, r.Item)
+			r.Elapsed = time.Since(start).Seconds()
+			r.Result = result
+			if err != nil {
+				r.Error = err.Error()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// Summary は結果の件数をまとめた文字列を返す
+func Summary(results []Result) string {
+	failed := 0
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+		}
+	}
+	return fmt.Sprintf("成功 %d件, 失敗 %d件", len(results)-failed, failed)
+}
+
+// Err は失敗した録音があればまとめたエラーを返す
+func Err(results []Result) error {
+	var errs []error
+	for _, r := range results {
+		if !r.OK() {
+			errs = append(errs, fmt.Errorf("%s %s: %s", r.Station, r.Start, r.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	os.WriteFile(path, []byte(`[
+  {"station": "TBS", "start": "2025-06-08 20:00", "duration": 60},
+  {"station": "LFR", "start": "2025-06-09 01:00", "duration": 120, "output": "ann.mp3"}
+]`), 0644)
+	items, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].Output != "ann.mp3" || items[1].Duration != 120 {
+		t.Errorf("unexpected items: %+v", items)
+	}
+
+	os.WriteFile(path, []byte(`[]`), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for empty list")
+	}
+}
+
+func TestItemProgram(t *testing.T) {
+	cfg := radiko.DefaultConfig()
+	start := time.Now().Add(-24 * time.Hour).In(radiko.JST())
+	item := Item{Station: "tbs", Start: start.Format("2006-01-02 15:04")}
+
+	p, err := item.Program(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.StationID != "TBS" || p.Duration() != cfg.DefaultDuration {
+		t.Errorf("alias and default duration should be applied: %+v", p)
+	}
+
+	for _, bad := range []Item{
+		{Start: item.Start},
+		{Station: "TBS", Start: "2025/06/08 20:00"},
+		{Station: "TBS", Start: start.AddDate(0, 0, -10).Format("2006-01-02 15:04")},
+	} {
+		if _, err := bad.Program(cfg); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	items := []Item{
+		{Station: "TBS", Start: "2025-06-08 20:00"},
+		{Station: "LFR", Start: "2025-06-08 21:00"},
+		{Station: "QRR", Start: "2025-06-08 22:00"},
+		{Station: "FMT", Start: "2025-06-08 23:00"},
+	}
+	var running, maxRunning int32
+	results := Run(context.Background(), items, 2, func(ctx context.Context, item Item) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if item.Station == "QRR" {
+			return "", errors.New("番組が見つかりません")
+		}
+		return item.Station + ".mp3", nil
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("concurrency exceeded: %d", maxRunning)
+	}
+	for i, r := range results {
+		if r.Station != items[i].Station {
+			t.Errorf("results should keep the order: %d = %s", i, r.Station)
+		}
+	}
+	if results[0].Result != "TBS.mp3" || !results[0].OK() || results[2].OK() || results[3].Result != "FMT.mp3" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if got := Summary(results); got != "成功 3件, 失敗 1件" {
+		t.Errorf("Summary() = %s", got)
+	}
+	if err := Err(results); err == nil || !strings.Contains(err.Error(), "QRR 2025-06-08 22:00: 番組が見つかりません") {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestRun_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	items := []Item{{Station: "TBS"}, {Station: "LFR"}, {Station: "QRR"}}
+	results := Run(ctx, items, 1, func(ctx context.Context, item Item) (string, error) {
+		cancel()
+		return "", ctx.Err()
+	})
+	for _, r := range results {
+		if r.OK() {
+			t.Errorf("canceled items should fail: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package feed は録音した番組からポッドキャスト用のRSSフィードを生成する
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// InfoSuffix は録音ファイルの横に保存する番組情報ファイルの接尾辞
+const InfoSuffix = ".json"
+
+// IndexKey はフィードに載せるエピソードの一覧（索引）を保存するキー。
+// 録音のたびに保存先の番組情報ファイルをすべて読み直さずに済むよう、Writeで作りUpdateで更新する
+const IndexKey = ".feed_index.json"
+
+// フィードのまとめ方
+const (
+	ByStation = "station"
+	ByProgram = "program"
+)
+
+// EpisodeInfo は録音ファイルごとの番組情報（番組表から取得したもの）
+type EpisodeInfo struct {
+	Title       string    `json:"title"`
+	Program     string    `json:"program"`
+	StationID   string    `json:"station_id"`
+	Station     string    `json:"station"`
+	Performers  string    `json:"performers,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Start       time.Time `json:"start"`
+	// Duration は録音時間（秒）
+	Duration int    `json:"duration"`
+	Image    string `json:"image,omitempty"`
+}
+
+// NewEpisodeInfo はタグ情報と録音時間から番組情報を作る
+func NewEpisodeInfo(md radiko.Metadata, stationID string, duration time.Duration) EpisodeInfo {
+	return EpisodeInfo{
+		Title:       md.Title,
+		Program:     md.Album,
+		StationID:   stationID,
+		Station:     md.AlbumArtist,
+		Performers:  md.Artist,
+		Description: md.Description,
+		Start:       md.Date,
+		Duration:    int(duration / time.Second),
+		Image:       md.Image,
+	}
+}
+
+// InfoPath は録音ファイルに対応する番組情報ファイルのパスを返す
+func InfoPath(audioFile string) string {
+	return audioFile + InfoSuffix
+}
+
+// WriteInfo は番組情報ファイルを書き込む
+func WriteInfo(path string, info EpisodeInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Episode はフィードの1エピソード
+type Episode struct {
+	EpisodeInfo
+	// File は保存先の中でのキー（サブディレクトリを含む）
+	File        string `json:"file"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// fileNamePattern は自動生成された出力ファイル名（局ID_日付_時刻）
+var fileNamePattern = regexp.MustCompile(`^(?:([A-Za-z0-9-]+)_)?(\d{8}_\d{4})$`)
+
+// Scan は保存先にある録音ファイル（キーのテンプレートで作られたサブディレクトリの中も含む）を
+// エピソードの一覧として返す。"." で始まるディレクトリ（途中までの録音など）の中は含めない。
+// 番組情報ファイルがない録音はファイル名から局と放送日時を推測する
+func Scan(ctx context.Context, st storage.Storage) ([]Episode, error) {
+	objects, err := st.Walk(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("録音ファイルの一覧取得に失敗: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, o := range objects {
+		names[o.Key] = true
+	}
+
+	var episodes []Episode
+	for _, o := range objects {
+		format, ok := radiko.FormatForPath(o.Key)
+		if !ok || hidden(o.Key) || names[radiko.ManifestPath(o.Key)] {
+			// 音声ファイル以外と録音途中のファイルは含めない
+			continue
+		}
+		ep := Episode{File: o.Key, Size: o.Size, ContentType: format.ContentType}
+		if names[InfoPath(o.Key)] {
+			data, err := storage.ReadAll(ctx, st, InfoPath(o.Key))
+			if err != nil {
+				return nil, fmt.Errorf("番組情報の読み込みに失敗: %w", err)
+			}
+			if err := json.Unmarshal(data, &ep.EpisodeInfo); err != nil {
+				return nil, fmt.Errorf("番組情報の解析に失敗: %s: %w", InfoPath(o.Key), err)
+			}
+		} else {
+			ep.EpisodeInfo = guessInfo(o)
+		}
+		episodes = append(episodes, ep)
+	}
+
+	sortEpisodes(episodes)
+	return episodes, nil
+}
+
+// sortEpisodes はエピソードを新しい放送から順に並べる
+func sortEpisodes(episodes []Episode) {
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[i].Start.After(episodes[j].Start)
+	})
+}
+
+// hidden はkeyが "." で始まるディレクトリの中にあるかを返す
+func hidden(key string) bool {
+	dir := path.Dir(key)
+	for _, name := range strings.Split(dir, "/") {
+		if strings.HasPrefix(name, ".") && name != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// guessInfo はファイル名から番組情報を推測する
+func guessInfo(o storage.Object) EpisodeInfo {
+	name := path.Base(o.Key)
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	info := EpisodeInfo{Title: stem, Start: o.ModTime}
+	if m := fileNamePattern.FindStringSubmatch(stem); m != nil {
+		if start, err := time.ParseInLocation("20060102_1504", m[2], radiko.JST()); err == nil {
+			info.Start = start
+		}
+		info.StationID = m[1]
+	}
+	if info.StationID != "" {
+		info.Station = radiko.StationName(info.StationID)
+		info.Program = info.Station
+	}
+	return info
+}
+
+// Feed は1つのフィード（局または番組ごと）
+type Feed struct {
+	// Key はまとめる単位（局IDまたは番組名）
+	Key      string
+	Title    string
+	Episodes []Episode
+}
+
+// FileName はフィードを保存するファイル名を返す
+func (f Feed) FileName() string {
+	return "feed_" + sanitize(f.Key) + ".xml"
+}
+
+// Group はエピソードを局または番組ごとのフィードにまとめる
+func Group(episodes []Episode, by string) ([]Feed, error) {
+	if by != ByStation && by != ByProgram {
+		return nil, fmt.Errorf("フィードのまとめ方が正しくありません: %q (%s または %s)", by, ByStation, ByProgram)
+	}
+
+	feeds := map[string]*Feed{}
+	var keys []string
+	for _, ep := range episodes {
+		key, title := groupOf(ep, by)
+		f, ok := feeds[key]
+		if !ok {
+			if title == "" {
+				title = key
+			}
+			f = &Feed{Key: key, Title: title}
+			feeds[key] = f
+			keys = append(keys, key)
+		}
+		f.Episodes = append(f.Episodes, ep)
+	}
+
+	sort.Strings(keys)
+	result := make([]Feed, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *feeds[key])
+	}
+	return result, nil
+}
+
+// groupOf はエピソードをまとめるフィードのキーと題名を返す
+func groupOf(ep Episode, by string) (key, title string) {
+	key, title = ep.StationID, ep.Station
+	if by == ByProgram {
+		key, title = ep.Program, ep.Program
+	}
+	if key == "" {
+		key, title = "other", "その他の録音"
+	}
+	return key, title
+}
+
+// CheckBaseURL はフィードの公開URLがhttp(s)のURLかを確かめる。
+// s3:// などの保存先のURLはポッドキャストアプリから取得できないため受け付けない
+func CheckBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("フィードの公開URLには http:// または https:// のURLを指定してください: %q", baseURL)
+	}
+	return nil
+}
+
+// Write は保存先の録音ファイルからすべてのフィードと索引を生成して同じ保存先に書き込み、
+// 書き込んだフィードのファイル名を返す
+func Write(ctx context.Context, st storage.Storage, by, baseURL string) ([]string, error) {
+	if err := CheckBaseURL(baseURL); err != nil {
+		return nil, err
+	}
+	episodes, err := Scan(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := Group(episodes, by)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, f := range feeds {
+		key, err := writeFeed(ctx, st, f, baseURL)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := saveIndex(ctx, st, episodes); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// updateMu は同じプロセスの中で並行して索引を書き換えないようにする
+var updateMu sync.Mutex
+
+// Update は保存先のkeyに置いた録音を索引に加え、そのエピソードを含むフィードだけを生成し直して、
+// 書き込んだフィードのファイル名を返す。索引がまだなければWriteと同じく保存先の録音をすべて読み込んで作る。
+// 保存先から削除された録音は索引からも除く
+func Update(ctx context.Context, st storage.Storage, by, baseURL, key string, info EpisodeInfo) (string, error) {
+	if err := CheckBaseURL(baseURL); err != nil {
+		return "", err
+	}
+	format, ok := radiko.FormatForPath(key)
+	if !ok {
+		return "", fmt.Errorf("録音ファイルの形式が分かりません: %s", key)
+	}
+	o, err := st.Stat(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("録音ファイルが見つかりません: %s: %w", st.URL(key), err)
+	}
+	ep := Episode{EpisodeInfo: info, File: key, Size: o.Size, ContentType: format.ContentType}
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	episodes, err := loadIndex(ctx, st)
+	if err != nil {
+		return "", err
+	}
+	added := false
+	for i := range episodes {
+		if episodes[i].File == key {
+			episodes[i], added = ep, true
+		}
+	}
+	if !added {
+		episodes = append(episodes, ep)
+	}
+	sortEpisodes(episodes)
+	if err := saveIndex(ctx, st, episodes); err != nil {
+		return "", err
+	}
+
+	feeds, err := Group(episodes, by)
+	if err != nil {
+		return "", err
+	}
+	group, _ := groupOf(ep, by)
+	for _, f := range feeds {
+		if f.Key == group {
+			return writeFeed(ctx, st, f, baseURL)
+		}
+	}
+	return "", fmt.Errorf("フィードが見つかりません: %s", group)
+}
+
+// loadIndex は索引のエピソードのうち、保存先にまだある録音を返す。
+// 索引がなければ保存先の録音をすべて読み込む
+func loadIndex(ctx context.Context, st storage.Storage) ([]Episode, error) {
+	data, err := storage.ReadAll(ctx, st, IndexKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Scan(ctx, st)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("フィードの索引の読み込みに失敗: %w", err)
+	}
+	var indexed []Episode
+	if err := json.Unmarshal(data, &indexed); err != nil {
+		return nil, fmt.Errorf("フィードの索引の形式が正しくありません: %s: %w", st.URL(IndexKey), err)
+	}
+
+	objects, err := st.Walk(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("録音ファイルの一覧取得に失敗: %w", err)
+	}
+	names := map[string]bool{}
+	for _, o := range objects {
+		names[o.Key] = true
+	}
+	episodes := indexed[:0]
+	for _, ep := range indexed {
+		if names[ep.File] {
+			episodes = append(episodes, ep)
+		}
+	}
+	return episodes, nil
+}
+
+// saveIndex は索引を保存する
+func saveIndex(ctx context.Context, st storage.Storage, episodes []Episode) error {
+	data, err := json.MarshalIndent(episodes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := st.Put(ctx, IndexKey, bytes.NewReader(data), storage.PutOptions{ContentType: "application/json"}); err != nil {
+		return fmt.Errorf("フィードの索引の保存に失敗: %w", err)
+	}
+	return nil
+}
+
+// writeFeed はフィードを生成して保存し、保存したファイル名を返す
+func writeFeed(ctx context.Context, st storage.Storage, f Feed, baseURL string) (string, error) {
+	var buf bytes.Buffer
+	if err := Render(&buf, f, baseURL, time.Now()); err != nil {
+		return "", err
+	}
+	key := f.FileName()
+	if err := st.Put(ctx, key, &buf, storage.PutOptions{ContentType: storage.ContentType(key)}); err != nil {
+		return "", fmt.Errorf("フィードの保存に失敗: %s: %w", st.URL(key), err)
+	}
+	return key, nil
+}
+
+// TryUpdate はconfigにフィードの公開URLがあれば、保存先のkeyに置いた録音のフィードをUpdateで更新する。
+// 失敗しても録音は失敗扱いにせず、ログに残すだけにする
+func TryUpdate(ctx context.Context, logger *radiko.Logger, st storage.Storage, config *radiko.Config, key string, info EpisodeInfo) {
+	if config.FeedBaseURL == "" {
+		return
+	}
+	feedKey, err := Update(ctx, st, config.FeedBy, config.FeedBaseURL, key, info)
+	if err != nil {
+		logger.Error("フィードの更新に失敗: %v", err)
+		return
+	}
+	logger.Debug("フィードを更新しました: %s", st.URL(feedKey))
+}
+
+// sanitize はファイル名に使えない文字を置き換える
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ', '　':
+			return '_'
+		}
+		return r
+	}, s)
+}
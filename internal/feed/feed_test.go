@@ -0,0 +1,291 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+func writeEpisode(t *testing.T, dir, name string, info *EpisodeInfo) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		if err := WriteInfo(filepath.Join(dir, InfoPath(name)), *info); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 6, 7, 20, 0, 0, 0, radiko.JST())
+	writeEpisode(t, dir, "junk.mp3", &EpisodeInfo{
+		Title:     "アフター6ジャンクション",
+		Program:   "アフター6ジャンクション",
+		StationID: "TBS",
+		Station:   "TBSラジオ",
+		Start:     start,
+		Duration:  5400,
+	})
+	writeEpisode(t, dir, "QRR_20240608_0100.m4a", nil)
+	// 録音途中のファイルと音声以外のファイルは含めない
+	writeEpisode(t, dir, "LFR_20240608_0200.aac", nil)
+	os.WriteFile(filepath.Join(dir, "LFR_20240608_0200.aac.manifest.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("memo"), 0644)
+
+	episodes, err := Scan(context.Background(), storage.NewFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(episodes) != 2 {
+		t.Fatalf("expected 2 episodes, got %+v", episodes)
+	}
+
+	guessed := episodes[0]
+	if guessed.File != "QRR_20240608_0100.m4a" || guessed.StationID != "QRR" || guessed.ContentType != "audio/mp4" {
+		t.Errorf("unexpected guessed episode: %+v", guessed)
+	}
+	if want := time.Date(2024, 6, 8, 1, 0, 0, 0, radiko.JST()); !guessed.Start.Equal(want) {
+		t.Errorf("start = %v, want %v", guessed.Start, want)
+	}
+
+	if ep := episodes[1]; ep.Title != "アフター6ジャンクション" || ep.Size != 5 || !ep.Start.Equal(start) {
+		t.Errorf("unexpected episode from info file: %+v", ep)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	episodes := []Episode{
+		{EpisodeInfo: EpisodeInfo{StationID: "TBS", Station: "TBSラジオ", Program: "番組A"}},
+		{EpisodeInfo: EpisodeInfo{StationID: "QRR", Station: "文化放送", Program: "番組A"}},
+		{EpisodeInfo: EpisodeInfo{StationID: "TBS", Station: "TBSラジオ", Program: "番組B"}},
+		{EpisodeInfo: EpisodeInfo{}},
+	}
+
+	feeds, err := Group(episodes, ByStation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 3 || feeds[0].Key != "QRR" || feeds[1].Key != "TBS" || len(feeds[1].Episodes) != 2 {
+		t.Errorf("unexpected station feeds: %+v", feeds)
+	}
+	if feeds[2].Key != "other" || feeds[2].FileName() != "feed_other.xml" {
+		t.Errorf("unexpected fallback feed: %+v", feeds[2])
+	}
+
+	feeds, err = Group(episodes, ByProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 3 || feeds[0].Title != "その他の録音" || len(feeds[1].Episodes) != 2 {
+		t.Errorf("unexpected program feeds: %+v", feeds)
+	}
+
+	if _, err := Group(episodes, "weekday"); err == nil {
+		t.Error("expected error for unknown grouping")
+	}
+}
+
+func TestRender(t *testing.T) {
+	f := Feed{Key: "TBS", Title: "TBSラジオ", Episodes: []Episode{{
+		EpisodeInfo: EpisodeInfo{
+			Title:      "アフター6ジャンクション",
+			Station:    "TBSラジオ",
+			Performers: "宇多丸",
+			Start:      time.Date(2024, 6, 7, 20, 0, 0, 0, radiko.JST()),
+			Duration:   5400,
+			Image:      "https://example.com/a6j.png",
+		},
+		File:        "TBS 20240607.mp3",
+		Size:        1234,
+		ContentType: "audio/mpeg",
+	}}}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, f, "https://cdn.example.com/radio/", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`,
+		`<enclosure url="https://cdn.example.com/radio/TBS%2020240607.mp3" length="1234" type="audio/mpeg">`,
+		`<itunes:duration>01:30:00</itunes:duration>`,
+		`<pubDate>Fri, 07 Jun 2024 20:00:00 +0900</pubDate>`,
+		`<itunes:image href="https://example.com/a6j.png">`,
+		`<guid isPermaLink="false">TBS 20240607.mp3</guid>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("feed should contain %s:\n%s", want, out)
+		}
+	}
+
+	// 出力は整形式のXMLであること
+	var parsed struct {
+		Items []struct {
+			Title string `xml:"title"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if len(parsed.Items) != 1 || parsed.Items[0].Title != "アフター6ジャンクション" {
+		t.Errorf("unexpected items: %+v", parsed.Items)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	for _, name := range []string{"TBS_20240607_2000.mp3", "QRR_20240608_0100.mp3"} {
+		st.Put(ctx, name, strings.NewReader("audio"), storage.PutOptions{})
+	}
+
+	keys, err := Write(ctx, st, ByStation, "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "feed_QRR.xml" {
+		t.Fatalf("unexpected feed files: %v", keys)
+	}
+	data, opts, ok := st.Object(keys[1])
+	if !ok || opts.ContentType != "application/rss+xml" {
+		t.Fatalf("feed should be stored with the RSS content type: %+v", opts)
+	}
+	if !bytes.Contains(data, []byte("https://example.com/TBS_20240607_2000.mp3")) {
+		t.Errorf("feed should link to the recording:\n%s", data)
+	}
+
+	// 生成したフィード自体はエピソードにならない
+	if episodes, _ := Scan(ctx, st); len(episodes) != 2 {
+		t.Errorf("expected 2 episodes after writing feeds, got %d", len(episodes))
+	}
+}
+
+func TestWrite_NestedKeys(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	// キーのテンプレート（{station}/{yyyy}/{mm}/{program}_{start}.mp3）で保存した録音
+	key := "TBS/2024/06/JUNK 爆笑問題_20240607_2000.mp3"
+	st.Put(ctx, key, strings.NewReader("audio"), storage.PutOptions{})
+	info, _ := json.Marshal(EpisodeInfo{Title: "JUNK", Program: "JUNK", StationID: "TBS", Station: "TBSラジオ",
+		Start: time.Date(2024, 6, 7, 20, 0, 0, 0, radiko.JST())})
+	st.Put(ctx, InfoPath(key), bytes.NewReader(info), storage.PutOptions{})
+	// 途中までの録音は含めない
+	st.Put(ctx, ".partial/TBS_20240608_0100.aac", strings.NewReader("partial"), storage.PutOptions{})
+
+	episodes, err := Scan(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(episodes) != 1 || episodes[0].File != key || episodes[0].Station != "TBSラジオ" {
+		t.Fatalf("nested recording should be found with its info file: %+v", episodes)
+	}
+
+	keys, err := Write(ctx, st, ByStation, "https://example.com/radio/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := st.Object(keys[0])
+	want := "https://example.com/radio/TBS/2024/06/JUNK%20%E7%88%86%E7%AC%91%E5%95%8F%E9%A1%8C_20240607_2000.mp3"
+	if !bytes.Contains(data, []byte(want)) {
+		t.Errorf("enclosure should keep the directory separators:\n%s", data)
+	}
+}
+
+func TestWrite_RequiresHTTPBaseURL(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	st.Put(ctx, "TBS_20240607_2000.mp3", strings.NewReader("audio"), storage.PutOptions{})
+
+	for _, baseURL := range []string{"", "s3://bucket/radio", "gs://bucket", "file:///tmp/radio", "example.com/radio"} {
+		if _, err := Write(ctx, st, ByStation, baseURL); err == nil {
+			t.Errorf("Write should reject base URL %q", baseURL)
+		}
+	}
+	if _, _, ok := st.Object("feed_TBS.xml"); ok {
+		t.Error("feed should not be written with an invalid base URL")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	for _, name := range []string{"TBS_20240607_2000.mp3", "QRR_20240608_0100.mp3", "LFR_20240608_0200.mp3"} {
+		st.Put(ctx, name, strings.NewReader("audio"), storage.PutOptions{})
+	}
+	if _, err := Write(ctx, st, ByStation, "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := st.Object(IndexKey); !ok {
+		t.Fatalf("Write should save the index at %s", IndexKey)
+	}
+
+	// 索引があれば番組情報ファイルは読み直さない
+	st.Put(ctx, InfoPath("QRR_20240608_0100.mp3"), strings.NewReader("{"), storage.PutOptions{})
+	st.Delete(ctx, "feed_QRR.xml")
+	st.Delete(ctx, "LFR_20240608_0200.mp3")
+
+	key := "TBS/JUNK_20240609_0100.mp3"
+	st.Put(ctx, key, strings.NewReader("new audio"), storage.PutOptions{})
+	info := EpisodeInfo{Title: "JUNK", Program: "JUNK", StationID: "TBS", Station: "TBSラジオ",
+		Start: time.Date(2024, 6, 9, 1, 0, 0, 0, radiko.JST()), Duration: 7200}
+	feedKey, err := Update(ctx, st, ByStation, "https://example.com", key, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feedKey != "feed_TBS.xml" {
+		t.Errorf("Update should rewrite only the feed of the recording: %s", feedKey)
+	}
+	data, _, _ := st.Object(feedKey)
+	if !bytes.Contains(data, []byte("https://example.com/TBS/JUNK_20240609_0100.mp3")) ||
+		!bytes.Contains(data, []byte("https://example.com/TBS_20240607_2000.mp3")) {
+		t.Errorf("feed should contain both TBS recordings:\n%s", data)
+	}
+	if _, _, ok := st.Object("feed_QRR.xml"); ok {
+		t.Error("other feeds should not be rewritten")
+	}
+
+	data, _, _ = st.Object(IndexKey)
+	var indexed []Episode
+	if err := json.Unmarshal(data, &indexed); err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 3 || indexed[0].File != key || indexed[0].Size != 9 || indexed[0].ContentType != "audio/mpeg" {
+		t.Errorf("index should have the new recording first and drop the deleted one: %+v", indexed)
+	}
+
+	if _, err := Update(ctx, st, ByStation, "s3://bucket", key, info); err == nil {
+		t.Error("Update should reject a non-HTTP base URL")
+	}
+}
+
+func TestUpdate_WithoutIndex(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	st.Put(ctx, "TBS_20240607_2000.mp3", strings.NewReader("audio"), storage.PutOptions{})
+	st.Put(ctx, "TBS_20240608_2000.mp3", strings.NewReader("audio"), storage.PutOptions{})
+
+	// 索引がなければ保存先の録音を読み込んで作る
+	info := EpisodeInfo{Title: "新しい録音", StationID: "TBS", Station: "TBSラジオ", Start: time.Date(2024, 6, 8, 20, 0, 0, 0, radiko.JST())}
+	if _, err := Update(ctx, st, ByStation, "https://example.com", "TBS_20240608_2000.mp3", info); err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := st.Object("feed_TBS.xml")
+	if !bytes.Contains(data, []byte("TBS_20240607_2000.mp3")) || !bytes.Contains(data, []byte("新しい録音")) {
+		t.Errorf("feed should contain the scanned and the new recordings:\n%s", data)
+	}
+	if bytes.Count(data, []byte("<item>")) != 2 {
+		t.Errorf("updated recording should not be duplicated:\n%s", data)
+	}
+}
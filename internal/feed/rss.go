@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// itunesNS はiTunesのポッドキャスト拡張の名前空間
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+type rssXML struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Itunes  string     `xml:"xmlns:itunes,attr"`
+	Channel channelXML `xml:"channel"`
+}
+
+type channelXML struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Author        string    `xml:"itunes:author,omitempty"`
+	Image         *imageXML `xml:"itunes:image,omitempty"`
+	Explicit      string    `xml:"itunes:explicit"`
+	Items         []itemXML `xml:"item"`
+}
+
+type imageXML struct {
+	Href string `xml:"href,attr"`
+}
+
+type itemXML struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description,omitempty"`
+	GUID        guidXML      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   enclosureXML `xml:"enclosure"`
+	Duration    string       `xml:"itunes:duration,omitempty"`
+	Author      string       `xml:"itunes:author,omitempty"`
+	Image       *imageXML    `xml:"itunes:image,omitempty"`
+}
+
+type guidXML struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type enclosureXML struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Render はフィードをRSS 2.0（iTunes拡張付き）として書き込む。
+// エピソードのURLはbaseURLにファイル名を付けたものになる
+func Render(w io.Writer, f Feed, baseURL string, now time.Time) error {
+	base := strings.TrimSuffix(baseURL, "/")
+	channel := channelXML{
+		Title:         f.Title,
+		Link:          base + "/",
+		Description:   fmt.Sprintf("radikoから録音した%sの番組", f.Title),
+		Language:      "ja",
+		LastBuildDate: now.Format(time.RFC1123Z),
+		Explicit:      "false",
+	}
+
+	for _, ep := range f.Episodes {
+		if channel.Image == nil && ep.Image != "" {
+			// 最新のエピソードの番組画像をフィードの画像にする
+			channel.Image = &imageXML{Href: ep.Image}
+		}
+		if channel.Author == "" {
+			channel.Author = ep.Station
+		}
+
+		item := itemXML{
+			Title:       ep.Title,
+			Description: ep.Description,
+			GUID:        guidXML{Value: ep.File},
+			PubDate:     ep.Start.Format(time.RFC1123Z),
+			Enclosure: enclosureXML{
+				URL:    base + "/" + escapePath(ep.File),
+				Length: ep.Size,
+				Type:   ep.ContentType,
+			},
+			Author: ep.Performers,
+		}
+		if ep.Duration > 0 {
+			item.Duration = formatDuration(time.Duration(ep.Duration) * time.Second)
+		}
+		if ep.Image != "" {
+			item.Image = &imageXML{Href: ep.Image}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(rssXML{Version: "2.0", Itunes: itunesNS, Channel: channel}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// escapePath はキーの "/" を残して区切りごとにURLエスケープする
+func escapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// formatDuration はitunes:durationの形式（HH:MM:SS）で返す
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+}
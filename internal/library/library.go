@@ -0,0 +1,250 @@
+// Package library は録音済みの番組の一覧（ライブラリ）を管理し、同じ放送を二重に録音しないようにする
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// Entry は録音済みの1番組
+type Entry struct {
+	Station string    `json:"station"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Title   string    `json:"title,omitempty"`
+	// Output は録音したファイルのパス
+	Output string `json:"output,omitempty"`
+	// Checksum は録音したファイルのSHA-256（ファイルを作らずにアップロードした場合は空）
+	Checksum string `json:"checksum,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// Upload はアップロード先のURL
+	Upload   string    `json:"upload,omitempty"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// ID は放送を区別する文字列（局ID_開始日時_終了日時）を返す
+func (e Entry) ID() string {
+	return radiko.Program{StationID: e.Station, Start: e.Start, End: e.End}.BroadcastID()
+}
+
+// Location は録音の場所（アップロード先、なければファイルのパス）を返す
+func (e Entry) Location() string {
+	if e.Upload != "" {
+		return e.Upload
+	}
+	return e.Output
+}
+
+// NewEntry は録音した番組の項目を作る。outputFileがあればサイズとチェックサムも記録する
+func NewEntry(p radiko.Program, title, outputFile, upload string) (Entry, error) {
+	e := Entry{
+		Station:  p.StationID,
+		Start:    p.Start,
+		End:      p.End,
+		Title:    title,
+		Output:   outputFile,
+		Upload:   upload,
+		Recorded: time.Now(),
+	}
+	if e.Title == "" {
+		e.Title = p.Title
+	}
+	f, err := os.Open(outputFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return e, fmt.Errorf("チェックサムの計算に失敗: %w", err)
+	}
+	e.Checksum = hex.EncodeToString(h.Sum(nil))
+	e.Size = n
+	return e, nil
+}
+
+// Library は保存先に置いたJSONファイルの録音済みの番組の一覧。
+// nilのLibraryは空として扱い、登録しても何もしない
+type Library struct {
+	st  storage.Storage
+	key string
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// StorageKey は録音の保存先にライブラリを置くときのキー
+const StorageKey = ".library.json"
+
+// OpenConfigured は設定に応じてライブラリを開く。
+// pathがあればそのJSONファイルを、なければ保存先stのStorageKeyを使い、どちらもなければnilを返す
+func OpenConfigured(ctx context.Context, path string, st storage.Storage) (*Library, error) {
+	if path != "" {
+		return Open(ctx, storage.NewFile(filepath.Dir(path)), filepath.Base(path))
+	}
+	if st == nil {
+		return nil, nil
+	}
+	return Open(ctx, st, StorageKey)
+}
+
+// Open は保存先stのkeyからライブラリを読み込む。まだない場合は空のライブラリを返す
+func Open(ctx context.Context, st storage.Storage, key string) (*Library, error) {
+	l := &Library{st: st, key: key}
+	if err := l.load(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Find は番組が録音済みなら項目を返す
+func (l *Library) Find(p radiko.Program) (Entry, bool) {
+	if l == nil {
+		return Entry{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[p.BroadcastID()]
+	return e, ok
+}
+
+// Record は録音した番組をライブラリに登録する
+func (l *Library) Record(ctx context.Context, p radiko.Program, title, outputFile, upload string) error {
+	if l == nil {
+		return nil
+	}
+	e, err := NewEntry(p, title, outputFile, upload)
+	if err != nil {
+		return err
+	}
+	return l.Add(ctx, e)
+}
+
+// TryRecord は録音した番組をライブラリに登録し、失敗してもログに残すだけにする。
+// ライブラリ・タグ・番組情報・フィードは録音ファイルの付加情報であり、
+// 録音とアップロードが済んでいればこれらの失敗で録音を失敗扱いにはしない
+func (l *Library) TryRecord(ctx context.Context, logger *radiko.Logger, p radiko.Program, title, outputFile, upload string) {
+	if err := l.Record(ctx, p, title, outputFile, upload); err != nil {
+		logger.Error("ライブラリへの登録に失敗: %v", err)
+	}
+}
+
+// Add は項目を登録して保存する。
+// 他のプロセスが登録した項目を消さないよう、保存の直前に読み込み直す
+func (l *Library) Add(ctx context.Context, e Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return err
+	}
+	l.entries[e.ID()] = e
+	return l.save(ctx)
+}
+
+// Remove はIDの項目を削除して保存する。項目がなければfalseを返す
+func (l *Library) Remove(ctx context.Context, id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return false, err
+	}
+	if _, ok := l.entries[id]; !ok {
+		return false, nil
+	}
+	delete(l.entries, id)
+	return true, l.save(ctx)
+}
+
+// List は録音済みの番組を開始日時順に返す
+func (l *Library) List() []Entry {
+	return l.Search("")
+}
+
+// Search は局ID・番組名・ファイル名にqueryを含む番組を開始日時順に返す（大文字小文字は区別しない）
+func (l *Library) Search(query string) []Entry {
+	if l == nil {
+		return nil
+	}
+	query = strings.ToLower(query)
+	l.mu.Lock()
+	var entries []Entry
+	for _, e := range l.entries {
+		text := strings.ToLower(strings.Join([]string{e.Station, e.Title, e.Output, e.Upload}, "\n"))
+		if strings.Contains(text, query) {
+			entries = append(entries, e)
+		}
+	}
+	l.mu.Unlock()
+	sortEntries(entries)
+	return entries
+}
+
+// load は保存先からライブラリを読み込み直す
+func (l *Library) load(ctx context.Context) error {
+	data, err := storage.ReadAll(ctx, l.st, l.key)
+	if errors.Is(err, storage.ErrNotFound) {
+		l.entries = map[string]Entry{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ライブラリの読み込みに失敗: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("ライブラリの形式が正しくありません: %s: %w", l.st.URL(l.key), err)
+	}
+	l.entries = make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		l.entries[e.ID()] = e
+	}
+	return nil
+}
+
+// save はライブラリを開始日時順のJSONの配列として保存する
+func (l *Library) save(ctx context.Context) error {
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := l.st.Put(ctx, l.key, bytes.NewReader(data), storage.PutOptions{ContentType: "application/json"}); err != nil {
+		return fmt.Errorf("ライブラリの保存に失敗: %w", err)
+	}
+	return nil
+}
+
+// sortEntries は項目を開始日時順（同じなら局ID順）に並べる
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Start.Equal(entries[j].Start) {
+			return entries[i].Start.Before(entries[j].Start)
+		}
+		return entries[i].Station < entries[j].Station
+	})
+}
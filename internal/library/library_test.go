@@ -0,0 +1,139 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+func program(station string, start time.Time, title string) radiko.Program {
+	return radiko.Program{StationID: station, Title: title, Start: start, End: start.Add(time.Hour)}
+}
+
+func TestLibrary(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	start := time.Date(2025, 6, 9, 1, 0, 0, 0, radiko.JST())
+	junk := program("TBS", start, "JUNK 爆笑問題カーボーイ")
+	ann := program("LFR", start.Add(-time.Hour), "オールナイトニッポン")
+
+	lib, err := Open(ctx, st, "library.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lib.Find(junk); ok {
+		t.Fatal("empty library should not find programs")
+	}
+
+	file := filepath.Join(t.TempDir(), "junk.mp3")
+	os.WriteFile(file, []byte("audio"), 0644)
+	if err := lib.Record(ctx, junk, "", file, "s3://radio/junk.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Record(ctx, ann, "", filepath.Join(t.TempDir(), "streamed.mp3"), "s3://radio/ann.mp3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 別のプロセスから開いても録音済みと分かる
+	other, err := Open(ctx, st, "library.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := other.Find(junk)
+	if !ok {
+		t.Fatal("recorded program should be found")
+	}
+	if e.ID() != "TBS_20250609010000_20250609020000" || e.Title != junk.Title || e.Size != 5 || len(e.Checksum) != 64 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if e, _ := other.Find(ann); e.Checksum != "" || e.Location() != "s3://radio/ann.mp3" {
+		t.Errorf("streamed recordings have no checksum: %+v", e)
+	}
+	if _, ok := other.Find(program("TBS", start.Add(24*time.Hour), "")); ok {
+		t.Error("other broadcasts should not be found")
+	}
+
+	if got := other.List(); len(got) != 2 || got[0].Station != "LFR" {
+		t.Errorf("List() should be ordered by start: %+v", got)
+	}
+	if got := other.Search("junk"); len(got) != 1 || got[0].Station != "TBS" {
+		t.Errorf("Search(junk) = %+v", got)
+	}
+
+	// 先に開いたライブラリから登録しても、他で登録した項目は消えない
+	third := program("QRR", start.Add(time.Hour), "")
+	if err := lib.Record(ctx, third, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := other.Remove(ctx, junk.StationID+"_20250609010000_20250609020000")
+	if err != nil || !removed {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if removed, _ := other.Remove(ctx, "TBS_missing"); removed {
+		t.Error("Remove() should report missing entries")
+	}
+	reopened, _ := Open(ctx, st, "library.json")
+	if got := reopened.List(); len(got) != 2 || got[0].Station != "LFR" || got[1].Station != "QRR" {
+		t.Errorf("unexpected entries after remove: %+v", got)
+	}
+}
+
+func TestLibrary_Nil(t *testing.T) {
+	var lib *Library
+	if _, ok := lib.Find(program("TBS", time.Now(), "")); ok {
+		t.Error("nil library should not find programs")
+	}
+	if err := lib.Record(context.Background(), program("TBS", time.Now(), ""), "", "", ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenConfigured(t *testing.T) {
+	ctx := context.Background()
+	if lib, err := OpenConfigured(ctx, "", nil); lib != nil || err != nil {
+		t.Errorf("library requires a path or storage: %v, %v", lib, err)
+	}
+
+	st := storage.NewMemory()
+	lib, err := OpenConfigured(ctx, "", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.Record(ctx, program("TBS", time.Now(), "JUNK"), "", "", "mem://TBS.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := st.Object(StorageKey); !ok {
+		t.Errorf("library should be saved at %s", StorageKey)
+	}
+
+	// パスを指定した場合は保存先よりも優先する
+	path := filepath.Join(t.TempDir(), "library.json")
+	lib, err = OpenConfigured(ctx, path, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lib.List()) != 0 {
+		t.Error("library at path should be empty")
+	}
+	if err := lib.Record(ctx, program("TBS", time.Now(), "JUNK"), "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("library should be saved at %s: %v", path, err)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	st.Put(ctx, "library.json", strings.NewReader("{"), storage.PutOptions{})
+	if _, err := Open(ctx, st, "library.json"); err == nil {
+		t.Error("expected error for invalid library")
+	}
+}
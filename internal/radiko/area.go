@@ -0,0 +1,171 @@
+package radiko
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Area はradikoのエリア（都道府県）
+type Area struct {
+	ID   string
+	Name string
+	// Latitude, Longitude はエリア指定の認証で送る位置（都道府県庁所在地）
+	Latitude  float64
+	Longitude float64
+}
+
+// Location はX-Radiko-Locationヘッダーの値（緯度,経度,gps）を返す
+func (a Area) Location() string {
+	return fmt.Sprintf("%.6f,%.6f,gps", a.Latitude, a.Longitude)
+}
+
+// areas はエリアIDごとの都道府県と位置
+var areas = map[string]Area{
+	"JP1":  {"JP1", "北海道", 43.064615, 141.346807},
+	"JP2":  {"JP2", "青森県", 40.824308, 140.739998},
+	"JP3":  {"JP3", "岩手県", 39.703619, 141.152684},
+	"JP4":  {"JP4", "宮城県", 38.268837, 140.872100},
+	"JP5":  {"JP5", "秋田県", 39.718614, 140.102364},
+	"JP6":  {"JP6", "山形県", 38.240436, 140.363633},
+	"JP7":  {"JP7", "福島県", 37.750299, 140.467551},
+	"JP8":  {"JP8", "茨城県", 36.341811, 140.446793},
+	"JP9":  {"JP9", "栃木県", 36.565725, 139.883565},
+	"JP10": {"JP10", "群馬県", 36.390668, 139.060406},
+	"JP11": {"JP11", "埼玉県", 35.856999, 139.648849},
+	"JP12": {"JP12", "千葉県", 35.605057, 140.123306},
+	"JP13": {"JP13", "東京都", 35.689488, 139.691706},
+	"JP14": {"JP14", "神奈川県", 35.447507, 139.642345},
+	"JP15": {"JP15", "新潟県", 37.902552, 139.023095},
+	"JP16": {"JP16", "富山県", 36.695291, 137.211338},
+	"JP17": {"JP17", "石川県", 36.594682, 136.625573},
+	"JP18": {"JP18", "福井県", 36.065178, 136.221527},
+	"JP19": {"JP19", "山梨県", 35.664158, 138.568449},
+	"JP20": {"JP20", "長野県", 36.651299, 138.180956},
+	"JP21": {"JP21", "岐阜県", 35.391227, 136.722291},
+	"JP22": {"JP22", "静岡県", 34.977120, 138.383084},
+	"JP23": {"JP23", "愛知県", 35.180188, 136.906565},
+	"JP24": {"JP24", "三重県", 34.730283, 136.508588},
+	"JP25": {"JP25", "滋賀県", 35.004531, 135.868590},
+	"JP26": {"JP26", "京都府", 35.021247, 135.755597},
+	"JP27": {"JP27", "大阪府", 34.686297, 135.519661},
+	"JP28": {"JP28", "兵庫県", 34.691269, 135.183071},
+	"JP29": {"JP29", "奈良県", 34.685334, 135.832742},
+	"JP30": {"JP30", "和歌山県", 34.225987, 135.167509},
+	"JP31": {"JP31", "鳥取県", 35.503891, 134.237736},
+	"JP32": {"JP32", "島根県", 35.472295, 133.050500},
+	"JP33": {"JP33", "岡山県", 34.661751, 133.934406},
+	"JP34": {"JP34", "広島県", 34.396560, 132.459622},
+	"JP35": {"JP35", "山口県", 34.185956, 131.470649},
+	"JP36": {"JP36", "徳島県", 34.065718, 134.559360},
+	"JP37": {"JP37", "香川県", 34.340149, 134.043444},
+	"JP38": {"JP38", "愛媛県", 33.841624, 132.765681},
+	"JP39": {"JP39", "高知県", 33.559706, 133.531079},
+	"JP40": {"JP40", "福岡県", 33.606576, 130.418297},
+	"JP41": {"JP41", "佐賀県", 33.249442, 130.299794},
+	"JP42": {"JP42", "長崎県", 32.744839, 129.873756},
+	"JP43": {"JP43", "熊本県", 32.789827, 130.741667},
+	"JP44": {"JP44", "大分県", 33.238172, 131.612619},
+	"JP45": {"JP45", "宮崎県", 31.911096, 131.423893},
+	"JP46": {"JP46", "鹿児島県", 31.560146, 130.557978},
+	"JP47": {"JP47", "沖縄県", 26.212400, 127.680932},
+}
+
+// LookupArea はエリアID（JP1〜JP47、大文字小文字は区別しない）のエリアを返す
+func LookupArea(id string) (Area, error) {
+	a, ok := areas[strings.ToUpper(strings.TrimSpace(id))]
+	if !ok {
+		return Area{}, fmt.Errorf("不明なエリアです: %q (JP1〜JP47)", id)
+	}
+	return a, nil
+}
+
+// LoadAppKey はスマートフォンアプリの認証に使う鍵のファイルを読み込む。
+// ファイルの内容がBase64の場合はデコードする
+func LoadAppKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, fmt.Errorf("エリアを指定した認証にはアプリの鍵ファイル（app_key_file または RADIKO_APP_KEY_FILE）が必要です")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("アプリの鍵ファイルの読み込みに失敗: %w", err)
+	}
+	if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) > 0 {
+		return key, nil
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("アプリの鍵ファイルが空です: %s", path)
+	}
+	return data, nil
+}
+
+// authDevice は認証で名乗るアプリと端末
+type authDevice struct {
+	app       string
+	version   string
+	device    string
+	user      string
+	userAgent string
+	key       []byte
+	// location はエリアを指定する場合のX-Radiko-Location（空ならIPアドレスでエリアが決まる）
+	location string
+}
+
+// pcDevice はブラウザ版（pc_html5）として認証する
+func pcDevice() authDevice {
+	return authDevice{
+		app:       "pc_html5",
+		version:   "0.0.1",
+		device:    "pc",
+		user:      "dummy_user",
+		userAgent: "Mozilla/5.0",
+		key:       []byte(pcAuthKey),
+	}
+}
+
+// authDevice は設定されたエリアに応じて認証に使う端末を返す。
+// エリアが指定されていればスマートフォンアプリとして位置情報を送る
+func (c *Client) authDevice() (authDevice, error) {
+	if c.area == "" {
+		return pcDevice(), nil
+	}
+	area, err := LookupArea(c.area)
+	if err != nil {
+		return authDevice{}, err
+	}
+	if c.appKey == nil {
+		key, err := LoadAppKey(c.appKeyFile)
+		if err != nil {
+			return authDevice{}, err
+		}
+		c.appKey = key
+	}
+	if c.userID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return authDevice{}, err
+		}
+		c.userID = hex.EncodeToString(b)
+	}
+	return authDevice{
+		app:       "aSmartPhone7a",
+		version:   "7.5.0",
+		device:    "29.Pixel_4",
+		user:      c.userID,
+		userAgent: "Dalvik/2.1.0 (Linux; U; Android 10; Pixel 4 Build/QQ3A.200805.001)",
+		key:       c.appKey,
+		location:  area.Location(),
+	}, nil
+}
+
+// setAppHeaders はアプリと端末のヘッダーを設定する
+func (d authDevice) setAppHeaders(h http.Header) {
+	h.Set("X-Radiko-App", d.app)
+	h.Set("X-Radiko-App-Version", d.version)
+	h.Set("X-Radiko-User", d.user)
+	h.Set("X-Radiko-Device", d.device)
+}
@@ -0,0 +1,112 @@
+package radiko
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupArea(t *testing.T) {
+	a, err := LookupArea("jp27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != "JP27" || a.Name != "大阪府" || a.Location() != "34.686297,135.519661,gps" {
+		t.Errorf("unexpected area: %+v (%s)", a, a.Location())
+	}
+	for i := 1; i <= 47; i++ {
+		if _, err := LookupArea(fmt.Sprintf("JP%d", i)); err != nil {
+			t.Errorf("JP%d should be supported", i)
+		}
+	}
+	for _, id := range []string{"", "JP0", "JP48", "osaka"} {
+		if _, err := LookupArea(id); err == nil {
+			t.Errorf("expected error for %q", id)
+		}
+	}
+}
+
+func TestLoadAppKey(t *testing.T) {
+	dir := t.TempDir()
+	raw := filepath.Join(dir, "key.bin")
+	os.WriteFile(raw, []byte{0x00, 0xff, 0x10, 0x80}, 0644)
+	encoded := filepath.Join(dir, "key.txt")
+	os.WriteFile(encoded, []byte(base64.StdEncoding.EncodeToString([]byte("smartphone-key"))+"\n"), 0644)
+
+	if key, err := LoadAppKey(raw); err != nil || string(key) != "\x00\xff\x10\x80" {
+		t.Errorf("LoadAppKey(raw) = %q, %v", key, err)
+	}
+	if key, err := LoadAppKey(encoded); err != nil || string(key) != "smartphone-key" {
+		t.Errorf("LoadAppKey(base64) = %q, %v", key, err)
+	}
+	for _, path := range []string{"", filepath.Join(dir, "missing")} {
+		if _, err := LoadAppKey(path); err == nil {
+			t.Errorf("expected error for %q", path)
+		}
+	}
+}
+
+func TestAuth_Area(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.bin")
+	os.WriteFile(keyFile, []byte("0123456789"), 0644)
+
+	server := newFakeRadiko(t)
+	server.Area = "JP27"
+	c := server.client(&Config{Area: "JP27", AppKeyFile: keyFile})
+
+	if err := c.AuthContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	auth1, auth2 := server.Header("/v2/api/auth1"), server.Header("/v2/api/auth2")
+	if c.AreaID() != "JP27" || c.token() != "fresh-token-1" {
+		t.Errorf("unexpected auth result: area=%s token=%s", c.AreaID(), c.token())
+	}
+	if auth1.Get("X-Radiko-App") != "aSmartPhone7a" || auth1.Get("X-Radiko-Device") == "" || len(auth1.Get("X-Radiko-User")) != 32 {
+		t.Errorf("auth1 should identify as the smartphone app: %v", auth1)
+	}
+	if got := auth2.Get("X-Radiko-Location"); got != "34.686297,135.519661,gps" {
+		t.Errorf("X-Radiko-Location = %q", got)
+	}
+	if got := auth2.Get("X-Radiko-Partialkey"); got != base64.StdEncoding.EncodeToString([]byte("2345")) {
+		t.Errorf("partial key should come from the app key: %q", got)
+	}
+	if auth2.Get("X-Radiko-User") != auth1.Get("X-Radiko-User") || auth2.Get("X-Radiko-Connection") != "wifi" {
+		t.Errorf("auth2 should repeat the device headers: %v", auth2)
+	}
+}
+
+func TestAuth_AreaMismatch(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.bin")
+	os.WriteFile(keyFile, []byte("0123456789"), 0644)
+
+	server := newFakeRadiko(t)
+	c := server.client(&Config{Area: "JP27", AppKeyFile: keyFile})
+	err := c.AuthContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "JP13") {
+		t.Errorf("expected area mismatch error, got %v", err)
+	}
+
+	c.SetArea("JP27", "")
+	if err := c.AuthContext(context.Background()); err == nil || !strings.Contains(err.Error(), "鍵ファイル") {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+}
+
+func TestAuth_PC(t *testing.T) {
+	server := newFakeRadiko(t)
+	c := server.client(&Config{})
+	if err := c.AuthContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	auth1, auth2 := server.Header("/v2/api/auth1"), server.Header("/v2/api/auth2")
+	if auth1.Get("X-Radiko-App") != "pc_html5" || auth2.Get("X-Radiko-Location") != "" {
+		t.Errorf("default auth should use pc_html5 without location: %v %v", auth1, auth2)
+	}
+	if got := auth2.Get("X-Radiko-Partialkey"); got != base64.StdEncoding.EncodeToString([]byte(pcAuthKey[2:6])) {
+		t.Errorf("unexpected partial key: %q", got)
+	}
+}
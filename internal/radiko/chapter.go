@@ -0,0 +1,109 @@
+package radiko
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ChapterByProgram は番組表の番組の区切りでチャプターを付ける指定
+const ChapterByProgram = "program"
+
+// Chapter は録音内のチャプター
+type Chapter struct {
+	Title string
+	// Start は録音の先頭からのチャプター開始位置
+	Start time.Duration
+	// End は録音の先頭からのチャプター終了位置
+	End time.Duration
+}
+
+// ChapterOptions はチャプターの付け方
+type ChapterOptions struct {
+	// ByProgram は番組表の番組の区切りでチャプターを付ける（番組内のコーナーでは区切らない）
+	ByProgram bool
+	// Interval は一定間隔でチャプターを付ける場合の間隔
+	Interval time.Duration
+}
+
+// ParseChapterOptions はチャプターの指定を解析する。
+// "program" は番組の区切り、"30m" のような時間は一定間隔、空文字はチャプターなし
+func ParseChapterOptions(s string) (ChapterOptions, error) {
+	switch s {
+	case "":
+		return ChapterOptions{}, nil
+	case ChapterByProgram:
+		return ChapterOptions{ByProgram: true}, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval < time.Minute {
+		return ChapterOptions{}, fmt.Errorf("チャプターの指定が正しくありません: %q (%q または 1m 以上の間隔を指定してください)", s, ChapterByProgram)
+	}
+	return ChapterOptions{Interval: interval}, nil
+}
+
+// IsZero はチャプターを付けない指定かを返す
+func (o ChapterOptions) IsZero() bool {
+	return !o.ByProgram && o.Interval == 0
+}
+
+// IntervalChapters は録音を一定間隔で区切ったチャプターを返す。
+// タイトルは各チャプターの放送時刻
+func IntervalChapters(start time.Time, length, interval time.Duration) []Chapter {
+	if interval <= 0 {
+		return nil
+	}
+	var chapters []Chapter
+	for offset := time.Duration(0); offset < length; offset += interval {
+		end := offset + interval
+		if end > length {
+			end = length
+		}
+		chapters = append(chapters, Chapter{
+			Title: start.Add(offset).Format("15:04"),
+			Start: offset,
+			End:   end,
+		})
+	}
+	return chapters
+}
+
+// ProgramChapters は録音範囲に含まれる番組ごとのチャプターを返す。
+// 番組表には番組内のコーナーの時刻がないため、1つの番組の中は区切らない
+func ProgramChapters(programs []Program, start time.Time, length time.Duration) []Chapter {
+	end := start.Add(length)
+	var chapters []Chapter
+	for _, p := range programs {
+		if !p.Start.Before(end) || !p.End.After(start) {
+			continue
+		}
+		chapter := Chapter{Title: p.Title, Start: p.Start.Sub(start), End: p.End.Sub(start)}
+		// 録音範囲からはみ出した部分は切り詰める
+		if chapter.Start < 0 {
+			chapter.Start = 0
+		}
+		if chapter.End > length {
+			chapter.End = length
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters
+}
+
+// Chapters は録音に付けるチャプターを返す。
+// 番組の区切りを使う場合に番組表を取得できなければチャプターなしとする
+func (c *Client) Chapters(ctx context.Context, p Program, opts ChapterOptions) []Chapter {
+	length := p.End.Sub(p.Start)
+	switch {
+	case opts.ByProgram:
+		programs, err := c.GetWeeklyProgramsContext(ctx, p.StationID)
+		if err != nil {
+			c.logger.Error("番組表を取得できないためチャプターを付けません: %v", err)
+			return nil
+		}
+		return ProgramChapters(programs, p.Start, length)
+	case opts.Interval > 0:
+		return IntervalChapters(p.Start, length, opts.Interval)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseChapterOptions(t *testing.T) {
+	if opts, err := ParseChapterOptions(""); err != nil || !opts.IsZero() {
+		t.Errorf("empty string should disable chapters: %+v, %v", opts, err)
+	}
+	if opts, err := ParseChapterOptions("program"); err != nil || !opts.ByProgram {
+		t.Errorf("unexpected options for program: %+v, %v", opts, err)
+	}
+	if opts, err := ParseChapterOptions("30m"); err != nil || opts.Interval != 30*time.Minute {
+		t.Errorf("unexpected options for 30m: %+v, %v", opts, err)
+	}
+	for _, s := range []string{"corner", "10s"} {
+		if _, err := ParseChapterOptions(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestIntervalChapters(t *testing.T) {
+	start := time.Date(2024, 6, 7, 1, 0, 0, 0, jstLocation())
+	chapters := IntervalChapters(start, 70*time.Minute, 30*time.Minute)
+	if len(chapters) != 3 {
+		t.Fatalf("expected 3 chapters, got %d", len(chapters))
+	}
+	if chapters[1].Title != "01:30" || chapters[1].Start != 30*time.Minute {
+		t.Errorf("unexpected second chapter: %+v", chapters[1])
+	}
+	if chapters[2].End != 70*time.Minute {
+		t.Errorf("last chapter should end at the recording end: %+v", chapters[2])
+	}
+}
+
+func TestProgramChapters(t *testing.T) {
+	server := newProgramServer(t)
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	jst := jstLocation()
+
+	// 番組の途中から次の番組の途中までを録音した場合
+	start := time.Date(2024, 6, 7, 20, 30, 0, 0, jst)
+	p := Program{StationID: "TBS", Start: start, End: start.Add(5 * time.Hour)}
+	chapters := c.Chapters(context.Background(), p, ChapterOptions{ByProgram: true})
+	if len(chapters) != 2 {
+		t.Fatalf("expected 2 chapters, got %+v", chapters)
+	}
+	if chapters[0].Title != "アフター6ジャンクション2" || chapters[0].Start != 0 || chapters[0].End != time.Hour {
+		t.Errorf("first chapter should be clipped to the recording start: %+v", chapters[0])
+	}
+	if chapters[1].Start != 4*time.Hour+30*time.Minute || chapters[1].End != 5*time.Hour {
+		t.Errorf("second chapter should be clipped to the recording end: %+v", chapters[1])
+	}
+}
+
+func TestChapters_GuideUnavailable(t *testing.T) {
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	p := Program{StationID: "TBS", Start: time.Now().Add(-time.Hour), End: time.Now()}
+	if chapters := c.Chapters(context.Background(), p, ChapterOptions{ByProgram: true}); chapters != nil {
+		t.Errorf("expected no chapters, got %+v", chapters)
+	}
+}
+
+func TestTagFile_Chapters(t *testing.T) {
+	dir := t.TempDir()
+	chapters := []Chapter{
+		{Title: "オープニング", Start: 0, End: 30 * time.Minute},
+		{Title: "コーナー", Start: 30 * time.Minute, End: time.Hour},
+	}
+	md := Metadata{Title: "番組", Chapters: chapters}
+
+	mp3 := filepath.Join(dir, "show.mp3")
+	os.WriteFile(mp3, []byte("\xff\xfbaudio"), 0644)
+	if err := TagFile(mp3, md); err != nil {
+		t.Fatalf("TagFile(mp3) failed: %v", err)
+	}
+	data, _ := os.ReadFile(mp3)
+	frames := readID3Frames(t, data)
+	if toc := frames["CTOC"]; !bytes.Equal(toc, []byte("toc\x00\x03\x02chp0\x00chp1\x00")) {
+		t.Errorf("unexpected CTOC: %q", toc)
+	}
+	// readID3Framesは同じIDのフレームを上書きするので最後のCHAPが残る
+	chap := frames["CHAP"]
+	if !bytes.HasPrefix(chap, []byte("chp1\x00")) {
+		t.Fatalf("unexpected CHAP: %q", chap)
+	}
+	if start := binary.BigEndian.Uint32(chap[5:]); start != 30*60*1000 {
+		t.Errorf("CHAP start = %d", start)
+	}
+	if !bytes.HasSuffix(chap, []byte("コーナー")) {
+		t.Errorf("CHAP should embed the chapter title: %q", chap)
+	}
+
+	// M4AはNero形式のchplに書き込む
+	input := filepath.Join(dir, "in.aac")
+	m4a := filepath.Join(dir, "show.m4a")
+	os.WriteFile(input, adtsFrame([]byte("payload")), 0644)
+	if err := RemuxToM4A(input, m4a); err != nil {
+		t.Fatal(err)
+	}
+	if err := TagFile(m4a, md); err != nil {
+		t.Fatalf("TagFile(m4a) failed: %v", err)
+	}
+	data, _ = os.ReadFile(m4a)
+	chpl := findBox(t, data, "moov", "udta", "chpl")
+	if chpl[0] != 1 || chpl[8] != 2 {
+		t.Fatalf("unexpected chpl header: %v", chpl[:9])
+	}
+	second := chpl[9+8+1+len("オープニング"):]
+	if start := binary.BigEndian.Uint64(second); start != uint64(30*time.Minute/100) {
+		t.Errorf("chpl start = %d", start)
+	}
+	if title := string(second[9 : 9+second[8]]); title != "コーナー" {
+		t.Errorf("chpl title = %q", title)
+	}
+}
@@ -2,22 +2,63 @@ package radiko
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// defaultBaseURL はradiko APIのベースURL
+const defaultBaseURL = "https://radiko.jp"
+
 // Client はradikoクライアント
 type Client struct {
 	authToken  string
 	areaID     string
+	baseURL    string
 	httpClient *http.Client
 	logger     *Logger
+
+	// tokenMu は並列ダウンロード中の再認証からauthTokenとareaIDを保護する
+	tokenMu sync.RWMutex
+	// reauthMu は再認証を1つずつ実行するためのロック
+	reauthMu sync.Mutex
+
+	// concurrency はセグメントの同時ダウンロード数
+	concurrency int
+	// retry はセグメントダウンロードのリトライ設定
+	retry RetryPolicy
+	// failureBudget は録音1回あたりにスキップを許容する失敗セグメント数
+	failureBudget int
+
+	// area は認証で指定するエリアID（空ならIPアドレスでエリアが決まる）
+	area string
+	// appKeyFile はエリアを指定した認証に使うアプリの鍵ファイル
+	appKeyFile string
+	appKey     []byte
+	// userID はスマートフォンアプリとして認証するときのユーザーID
+	userID string
+
+	// premiumEmail, premiumPassword はradikoプレミアムのログイン情報
+	premiumEmail    string
+	premiumPassword string
+	// sessionFile はプレミアムのセッションを保存するファイル
+	sessionFile string
+	// session はプレミアムのセッションID（tokenMuで保護する）
+	session string
+
+	// tokenCache は認証トークンを実行をまたいで使い回すための保存場所
+	tokenCache TokenCache
+	// cacheDir は録音前のエリアの確認で使う局一覧のキャッシュの場所
+	cacheDir string
 }
 
 // NewClient は新しいradikoクライアントを作成
@@ -26,16 +67,78 @@ func NewClient() *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		logger: NewLogger(false), // デフォルトはverbose=false
+		logger:      NewLogger(false), // デフォルトはverbose=false
+		concurrency: DefaultConcurrency,
+		retry:       DefaultRetryPolicy(),
 	}
 }
 
 // SetLogger はロガーを設定
 func (c *Client) SetLogger(logger *Logger) {
 	c.logger = logger
+	logger.AddSecret(c.premiumEmail)
+	logger.AddSecret(c.premiumPassword)
+	logger.AddSecret(c.Session())
+}
+
+// SetConcurrency はセグメントの同時ダウンロード数を設定（1以下で逐次ダウンロード）
+func (c *Client) SetConcurrency(n int) {
+	c.concurrency = n
+}
+
+// SetRetryPolicy はセグメントダウンロードのリトライ設定を変更
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// SetFailureBudget は録音1回あたりにスキップを許容する失敗セグメント数を設定
+func (c *Client) SetFailureBudget(n int) {
+	c.failureBudget = n
+}
+
+// ApplyConfig は設定ファイルのダウンロード関連の値をクライアントに反映
+func (c *Client) ApplyConfig(cfg *Config) {
+	c.SetConcurrency(cfg.Concurrency)
+	retry := DefaultRetryPolicy()
+	retry.MaxRetries = cfg.SegmentRetries
+	c.SetRetryPolicy(retry)
+	c.SetFailureBudget(cfg.FailureBudget)
+	c.cacheDir = cfg.CacheDir
+	c.SetArea(cfg.Area, cfg.AppKeyFile)
+	c.SetPremium(cfg.PremiumEmail, cfg.PremiumPassword, SessionPath(cfg))
+	if path := TokenCachePath(cfg); path != "" {
+		c.SetTokenCache(NewFileTokenCache(path))
+	} else {
+		c.SetTokenCache(nil)
+	}
+}
+
+// SetArea は認証で指定するエリアID（JP1〜JP47）とアプリの鍵ファイルを設定する。
+// エリアを指定するとスマートフォンアプリの認証で位置情報を送り、そのエリアの局を録音できる
+func (c *Client) SetArea(areaID, appKeyFile string) {
+	c.area = areaID
+	c.appKeyFile = appKeyFile
+	c.appKey = nil
+}
+
+// token は現在の認証トークンを返す
+func (c *Client) token() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.authToken
 }
 
-// GetAvailableStations は利用可能な局の一覧を返す
+// apiURL はベースURLとパスからAPIのURLを組み立てる
+func (c *Client) apiURL(path string) string {
+	base := c.baseURL
+	if base == "" {
+		base = defaultBaseURL
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// GetAvailableStations は関東エリアの局一覧を返す。
+// 局一覧APIが利用できない場合のオフライン用フォールバック
 func GetAvailableStations() map[string]string {
 	return map[string]string{
 		"TBS":   "TBSラジオ",
@@ -55,26 +158,52 @@ func GetAvailableStations() map[string]string {
 
 // Auth はradikoの認証を行う（正式な認証フロー）
 func (c *Client) Auth() error {
+	return c.AuthContext(context.Background())
+}
+
+// AuthContext はコンテキスト付きでradikoの認証を行う。
+// 保存した認証トークンが有効期間内であれば、auth1/auth2を省略してそれを使う
+func (c *Client) AuthContext(ctx context.Context) error {
+	if err := c.ensureSession(ctx); err != nil {
+		return err
+	}
+	if c.useCachedToken(ctx) {
+		return nil
+	}
+	return c.authenticate(ctx)
+}
+
+// authenticate はauth1/auth2で認証トークンを取得し、保存場所があれば保存する
+func (c *Client) authenticate(ctx context.Context) error {
 	c.logger.Debug("radiko認証を開始")
 	c.logger.Debug("=== RADIKO認証デバッグ開始 ===")
 
+	if err := c.ensureSession(ctx); err != nil {
+		return err
+	}
+
+	device, err := c.authDevice()
+	if err != nil {
+		return fmt.Errorf("認証の準備に失敗: %w", err)
+	}
+	if device.location != "" {
+		c.logger.Debug("エリアを指定して認証: %s (%s)", c.area, device.location)
+	}
+
 	// Step 1: auth1 - 認証トークンとキー情報を取得
-	auth1URL := "https://radiko.jp/v2/api/auth1"
+	auth1URL := c.apiURL("/v2/api/auth1")
 	c.logger.Debug("auth1 URL: %s", auth1URL)
 
-	req, err := http.NewRequest("GET", auth1URL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", auth1URL, nil)
 	if err != nil {
 		return fmt.Errorf("auth1リクエスト作成エラー: %w", err)
 	}
 
 	// 必要なヘッダーを設定
-	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("User-Agent", device.userAgent)
 	req.Header.Set("Accept", "*/*")
 	req.Header.Set("Pragma", "no-cache")
-	req.Header.Set("X-Radiko-App", "pc_html5")
-	req.Header.Set("X-Radiko-App-Version", "0.0.1")
-	req.Header.Set("X-Radiko-User", "dummy_user")
-	req.Header.Set("X-Radiko-Device", "pc")
+	device.setAppHeaders(req.Header)
 
 	c.logger.Debug("auth1リクエスト送信中...")
 	resp, err := c.httpClient.Do(req)
@@ -125,7 +254,7 @@ func (c *Client) Auth() error {
 	c.logger.Debug("キー長: %s, キーオフセット: %s", keyLength, keyOffset)
 
 	// 部分鍵を生成
-	partialKey, err := c.generatePartialKey(keyLength, keyOffset)
+	partialKey, err := c.partialKey(device.key, keyLength, keyOffset)
 	if err != nil {
 		return fmt.Errorf("部分鍵生成エラー: %w", err)
 	}
@@ -133,19 +262,29 @@ func (c *Client) Auth() error {
 	c.logger.Debug("部分鍵生成完了: %s... (長さ: %d)", partialKey[:min(10, len(partialKey))], len(partialKey))
 
 	// Step 2: auth2 - 認証の有効化
-	auth2URL := "https://radiko.jp/v2/api/auth2"
+	auth2URL := c.apiURL("/v2/api/auth2")
+	if session := c.Session(); session != "" {
+		// プレミアムのセッションを渡すとエリアフリーのトークンになる
+		auth2URL += "?" + url.Values{sessionCookie: {session}}.Encode()
+	}
 	c.logger.Debug("auth2 URL: %s", auth2URL)
 
-	req2, err := http.NewRequest("GET", auth2URL, nil)
+	req2, err := http.NewRequestWithContext(ctx, "GET", auth2URL, nil)
 	if err != nil {
 		return fmt.Errorf("auth2リクエスト作成エラー: %w", err)
 	}
 
-	req2.Header.Set("User-Agent", "Mozilla/5.0")
+	req2.Header.Set("User-Agent", device.userAgent)
 	req2.Header.Set("Accept", "*/*")
 	req2.Header.Set("Pragma", "no-cache")
 	req2.Header.Set("X-Radiko-AuthToken", authToken)
 	req2.Header.Set("X-Radiko-Partialkey", partialKey)
+	if device.location != "" {
+		// スマートフォンアプリは位置情報からエリアを判定される
+		device.setAppHeaders(req2.Header)
+		req2.Header.Set("X-Radiko-Location", device.location)
+		req2.Header.Set("X-Radiko-Connection", "wifi")
+	}
 
 	c.logger.Debug("auth2リクエスト送信中...")
 	c.logger.Debug("使用する認証トークン: %s...", authToken[:min(10, len(authToken))])
@@ -182,24 +321,37 @@ func (c *Client) Auth() error {
 	parts := strings.FieldsFunc(auth2Response, func(r rune) bool {
 		return r == ',' || r == '\n'
 	})
+	areaID := ""
 	if len(parts) > 0 {
-		c.areaID = strings.TrimSpace(parts[0])
+		areaID = strings.TrimSpace(parts[0])
+	}
+	if c.area != "" && !strings.EqualFold(areaID, c.area) {
+		return fmt.Errorf("エリアを指定した認証に失敗: %s を指定しましたが %s と判定されました", strings.ToUpper(c.area), areaID)
 	}
 
-	// 認証トークンを保存
+	// 認証トークンとエリアIDを保存
+	c.tokenMu.Lock()
 	c.authToken = authToken
+	c.areaID = areaID
+	c.tokenMu.Unlock()
+	c.saveToken(ctx)
 
 	c.logger.Info("radiko認証完了")
 	c.logger.Debug("=== RADIKO認証デバッグ完了 ===")
 	return nil
 }
 
-// generatePartialKey は部分鍵を生成
+// pcAuthKey はブラウザ版radikoの共通鍵（公開されている情報）
+// 注意: この値は実際のradikoクライアントから取得される必要があります
+const pcAuthKey = "bcd151073c03b352e1ef2fd66c32209da9ca0afa"
+
+// generatePartialKey はブラウザ版の共通鍵から部分鍵を生成
 func (c *Client) generatePartialKey(keyLengthStr, keyOffsetStr string) (string, error) {
-	// radikoの共通鍵（公開されている情報）
-	// 注意: この値は実際のradikoクライアントから取得される必要があります
-	authKey := "bcd151073c03b352e1ef2fd66c32209da9ca0afa"
+	return c.partialKey([]byte(pcAuthKey), keyLengthStr, keyOffsetStr)
+}
 
+// partialKey は認証に使う鍵から部分鍵を生成
+func (c *Client) partialKey(authKey []byte, keyLengthStr, keyOffsetStr string) (string, error) {
 	keyLength, err := strconv.Atoi(keyLengthStr)
 	if err != nil {
 		return "", fmt.Errorf("キー長の変換エラー: %w", err)
@@ -210,7 +362,6 @@ func (c *Client) generatePartialKey(keyLengthStr, keyOffsetStr string) (string,
 		return "", fmt.Errorf("キーオフセットの変換エラー: %w", err)
 	}
 
-	c.logger.Debug("共通鍵: %s", authKey)
 	c.logger.Debug("抽出範囲: オフセット=%d, 長さ=%d", keyOffset, keyLength)
 
 	// オフセットと長さが有効な範囲内かチェック
@@ -220,10 +371,9 @@ func (c *Client) generatePartialKey(keyLengthStr, keyOffsetStr string) (string,
 
 	// 部分鍵を抽出
 	partialKeyBytes := authKey[keyOffset : keyOffset+keyLength]
-	c.logger.Debug("抽出された部分鍵（hex）: %s", partialKeyBytes)
 
 	// Base64エンコード
-	partialKey := base64.StdEncoding.EncodeToString([]byte(partialKeyBytes))
+	partialKey := base64.StdEncoding.EncodeToString(partialKeyBytes)
 
 	c.logger.Debug("Base64エンコード後: %s", partialKey)
 
@@ -240,12 +390,23 @@ func min(a, b int) int {
 
 // RecordTimeFree はタイムフリー番組を録音する
 func (c *Client) RecordTimeFree(stationID string, startTime time.Time, duration int, outputFile string) error {
+	return c.RecordTimeFreeContext(context.Background(), stationID, startTime, duration, outputFile)
+}
+
+// RecordTimeFreeContext はコンテキスト付きでタイムフリー番組を録音する。
+// キャンセルされた場合は途中までの録音ファイルを削除し、
+// 期限切れの場合は次回再開できるよう録音ファイルとマニフェストを残す
+func (c *Client) RecordTimeFreeContext(ctx context.Context, stationID string, startTime time.Time, duration int, outputFile string) error {
 	endTime := startTime.Add(time.Duration(duration) * time.Minute)
 
 	c.logger.Debug("録音設定: 局=%s, 開始=%s, 終了=%s", stationID, startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
 
+	if err := c.CheckStationAreaContext(ctx, stationID); err != nil {
+		return err
+	}
+
 	// タイムフリー再生用URLを取得
-	streamURL, err := c.getTimeFreeURL(stationID, startTime, endTime)
+	streamURL, err := c.getTimeFreeURL(ctx, stationID, startTime, endTime)
 	if err != nil {
 		return fmt.Errorf("ストリーミングURL取得エラー: %w", err)
 	}
@@ -255,11 +416,26 @@ func (c *Client) RecordTimeFree(stationID string, startTime time.Time, duration
 	c.logger.Info("ダウンロード開始...")
 
 	// Goのみを用いて音声ファイルをダウンロード
-	return c.downloadWithGo(streamURL, outputFile)
+	key := recordingKey{StationID: stationID, Start: startTime, End: endTime}
+	return c.downloadWithGo(ctx, streamURL, outputFile, key)
+}
+
+// getTimeFreeURL はタイムフリー再生用のプレイリストURLを取得する。
+// 401/403が返った場合は保存していたトークンの期限切れとみなして再認証してから取り直す
+func (c *Client) getTimeFreeURL(ctx context.Context, stationID string, startTime, endTime time.Time) (string, error) {
+	usedToken := c.token()
+	streamURL, err := c.fetchTimeFreeURL(ctx, stationID, startTime, endTime)
+	if !isAuthExpired(err) {
+		return streamURL, err
+	}
+	if err := c.reauth(ctx, usedToken); err != nil {
+		return "", &reauthError{err: err}
+	}
+	return c.fetchTimeFreeURL(ctx, stationID, startTime, endTime)
 }
 
-// getTimeFreeURL はタイムフリー再生用のプレイリストURLを取得
-func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time) (string, error) {
+// fetchTimeFreeURL はタイムフリー再生用のプレイリストURLを1回取得する
+func (c *Client) fetchTimeFreeURL(ctx context.Context, stationID string, startTime, endTime time.Time) (string, error) {
 	c.logger.Debug("ストリーミングURL取得を開始: 局=%s", stationID)
 	c.logger.Debug("=== ストリーミングURL取得デバッグ開始 ===")
 	c.logger.Debug("局ID: %s", stationID)
@@ -271,15 +447,16 @@ func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time)
 	}
 
 	// 認証が必要
-	if c.authToken == "" {
+	authToken := c.token()
+	if authToken == "" {
 		c.logger.Error("認証トークンが設定されていません")
 		return "", fmt.Errorf("認証が必要です。先にAuth()を実行してください")
 	}
 
-	c.logger.Debug("使用する認証トークン: %s... (長さ: %d)", c.authToken[:10], len(c.authToken))
+	c.logger.Debug("使用する認証トークン: %s... (長さ: %d)", authToken[:min(10, len(authToken))], len(authToken))
 
 	// タイムフリー用のプレイリストURLを構築
-	streamInfoURL := fmt.Sprintf("https://radiko.jp/v2/api/ts/playlist.m3u8?station_id=%s", stationID)
+	streamInfoURL := c.apiURL(fmt.Sprintf("/v2/api/ts/playlist.m3u8?station_id=%s", stationID))
 	if !startTime.IsZero() {
 		streamInfoURL += "&ft=" + startTime.Format("20060102150405")
 	}
@@ -289,7 +466,7 @@ func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time)
 
 	c.logger.Debug("ストリーミング情報URL: %s", streamInfoURL)
 
-	req, err := http.NewRequest("GET", streamInfoURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", streamInfoURL, nil)
 	if err != nil {
 		c.logger.Error("リクエスト作成エラー: %v", err)
 		return "", fmt.Errorf("ストリーミング情報リクエスト作成エラー: %w", err)
@@ -298,7 +475,8 @@ func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time)
 	// 必要なヘッダーを設定（認証トークンを含む）
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
 	req.Header.Set("Accept", "*/*")
-	req.Header.Set("X-Radiko-AuthToken", c.authToken)
+	req.Header.Set("X-Radiko-AuthToken", authToken)
+	c.setSessionCookie(req)
 	req.Header.Set("pragma", "no-cache")
 	req.Header.Set("Cache-Control", "no-cache")
 
@@ -337,7 +515,7 @@ func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time)
 		var buf bytes.Buffer
 		buf.ReadFrom(resp.Body)
 		c.logger.Debug("ストリーミングエラーレスポンス: %s", buf.String())
-		return "", fmt.Errorf("ストリーミング情報取得失敗: HTTP %d", resp.StatusCode)
+		return "", &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Op: "ストリーミング情報取得"}
 	}
 
 	// レスポンスを読み取り（m3u8プレイリスト）
@@ -382,9 +560,10 @@ func (c *Client) getTimeFreeURL(stationID string, startTime, endTime time.Time)
 	return streamInfoURL, nil
 }
 
-// downloadWithGo はffmpegを使用せずGoだけで音声をダウンロード
-func (c *Client) downloadWithGo(streamURL, outputFile string) error {
-	segments, err := c.fetchSegments(streamURL)
+// downloadWithGo はffmpegを使用せずGoだけで音声をダウンロード。
+// 進捗はマニフェストに記録し、同じ番組の録音が中断されていた場合は続きから再開する
+func (c *Client) downloadWithGo(ctx context.Context, streamURL, outputFile string, key recordingKey) error {
+	segments, err := c.fetchSegments(ctx, streamURL)
 	if err != nil {
 		return err
 	}
@@ -392,39 +571,44 @@ func (c *Client) downloadWithGo(streamURL, outputFile string) error {
 		return fmt.Errorf("プレイリストからセグメントを取得できませんでした")
 	}
 
-	out, err := os.Create(outputFile)
+	out, m, err := openResumable(outputFile, key, len(segments))
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	for i, segURL := range segments {
-		req, err := http.NewRequest("GET", segURL, nil)
-		if err != nil {
-			return err
-		}
-		req.Header.Set("User-Agent", "Mozilla/5.0")
-		if c.authToken != "" {
-			req.Header.Set("X-Radiko-AuthToken", c.authToken)
-		}
+	first := len(m.Written)
+	if first > 0 {
+		c.logger.Info("中断された録音を再開: %d/%dセグメント完了済み", first, len(segments))
+	}
 
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			return err
-		}
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return fmt.Errorf("セグメントダウンロード失敗: %s", resp.Status)
+	manifestPath := ManifestPath(outputFile)
+	hook := func(index int, size int64, skipped bool) error {
+		m.add(index, size, skipped)
+		if len(m.Written)%manifestSaveInterval == 0 {
+			return m.save(manifestPath)
 		}
-		if _, err := io.Copy(out, resp.Body); err != nil {
-			resp.Body.Close()
+		return nil
+	}
+
+	if err := c.downloadSegments(ctx, segments, first, out, hook); err != nil {
+		if errors.Is(err, context.Canceled) {
+			// 明示的なキャンセルでは途中までの録音を残さない
+			out.Close()
+			os.Remove(outputFile)
+			os.Remove(manifestPath)
+			c.logger.Info("録音をキャンセルしました")
 			return err
 		}
-		resp.Body.Close()
-		if (i+1)%10 == 0 {
-			c.logger.Info("%d/%dセグメント完了", i+1, len(segments))
+		// 書き込み済みの位置を保存して次回の再開に備える
+		if saveErr := m.save(manifestPath); saveErr != nil {
+			c.logger.Error("マニフェストの保存に失敗: %v", saveErr)
+		} else {
+			c.logger.Info("再実行すると%d/%dセグメント目から再開します: %s", len(m.Written)+1, len(segments), manifestPath)
 		}
+		return err
 	}
+	os.Remove(manifestPath)
 
 	fi, err := out.Stat()
 	if err == nil {
@@ -434,16 +618,55 @@ func (c *Client) downloadWithGo(streamURL, outputFile string) error {
 	return err
 }
 
-// fetchSegments はm3u8プレイリストを再帰的に解析し、セグメントURLを取得
-func (c *Client) fetchSegments(playlistURL string) ([]string, error) {
-	req, err := http.NewRequest("GET", playlistURL, nil)
+// copySegment はセグメントを1つダウンロードしてwに書き込む
+func (c *Client) copySegment(ctx context.Context, segURL string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", segURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	if token := c.token(); token != "" {
+		req.Header.Set("X-Radiko-AuthToken", token)
+	}
+	c.setSessionCookie(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// fetchSegments はm3u8プレイリストを再帰的に解析し、セグメントURLを取得する。
+// 401/403が返った場合はトークンの期限切れとみなして再認証してから取り直す
+func (c *Client) fetchSegments(ctx context.Context, playlistURL string) ([]string, error) {
+	usedToken := c.token()
+	segments, err := c.fetchPlaylistSegments(ctx, playlistURL)
+	if !isAuthExpired(err) {
+		return segments, err
+	}
+	if err := c.reauth(ctx, usedToken); err != nil {
+		return nil, &reauthError{err: err}
+	}
+	return c.fetchPlaylistSegments(ctx, playlistURL)
+}
+
+// fetchPlaylistSegments はm3u8プレイリストを1回取得してセグメントURLを返す
+func (c *Client) fetchPlaylistSegments(ctx context.Context, playlistURL string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", playlistURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0")
-	if c.authToken != "" {
-		req.Header.Set("X-Radiko-AuthToken", c.authToken)
+	if token := c.token(); token != "" {
+		req.Header.Set("X-Radiko-AuthToken", token)
 	}
+	c.setSessionCookie(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -451,7 +674,7 @@ func (c *Client) fetchSegments(playlistURL string) ([]string, error) {
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("プレイリスト取得失敗: %s", resp.Status)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Op: "プレイリスト取得"}
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -471,7 +694,7 @@ func (c *Client) fetchSegments(playlistURL string) ([]string, error) {
 			u = base + u
 		}
 		if strings.Contains(u, ".m3u8") {
-			sub, err := c.fetchSegments(u)
+			sub, err := c.fetchPlaylistSegments(ctx, u)
 			if err != nil {
 				return nil, err
 			}
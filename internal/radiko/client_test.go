@@ -1,6 +1,7 @@
 package radiko
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -46,7 +47,7 @@ func TestFetchSegments(t *testing.T) {
 	defer server.Close()
 
 	c := &Client{httpClient: server.Client(), logger: NewLogger(false)}
-	segments, err := c.fetchSegments(server.URL + "/main.m3u8")
+	segments, err := c.fetchSegments(context.Background(), server.URL+"/main.m3u8")
 	if err != nil {
 		t.Fatalf("fetchSegments error: %v", err)
 	}
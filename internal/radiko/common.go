@@ -32,26 +32,145 @@ func LoadConfigWithEnv() (*Config, error) {
 		cfg.FFmpegPath = v
 	}
 
+	if v := os.Getenv("OUTPUT_FORMAT"); v != "" {
+		cfg.OutputFormat = v
+	}
+
+	if v := os.Getenv("CHAPTERS"); v != "" {
+		cfg.Chapters = v
+	}
+
+	if v := os.Getenv("UPLOAD_URL"); v != "" {
+		cfg.UploadURL = v
+	}
+
+	if v := os.Getenv("UPLOAD_KEY"); v != "" {
+		cfg.UploadKey = v
+	}
+
+	if v := os.Getenv("CONTENT_TYPES"); v != "" {
+		cfg.ContentTypes = parsePairs(v)
+	}
+
+	if v := os.Getenv("UPLOAD_TAGS"); v != "" {
+		cfg.UploadTags = parsePairs(v)
+	}
+
+	if v := os.Getenv("UPLOAD_STORAGE_CLASS"); v != "" {
+		cfg.StorageClass = v
+	}
+
+	if v := os.Getenv("UPLOAD_KMS_KEY_ID"); v != "" {
+		cfg.KMSKeyID = v
+	}
+
+	if v := os.Getenv("FEED_BASE_URL"); v != "" {
+		cfg.FeedBaseURL = v
+	}
+
+	if v := os.Getenv("FEED_BY"); v != "" {
+		cfg.FeedBy = v
+	}
+
+	if v := os.Getenv("CACHE_DIR"); v != "" {
+		cfg.CacheDir = v
+	}
+
+	if v := os.Getenv("RADIKO_AREA"); v != "" {
+		cfg.Area = v
+	}
+
+	if v := os.Getenv("RADIKO_APP_KEY_FILE"); v != "" {
+		cfg.AppKeyFile = v
+	}
+
+	if v := os.Getenv("RADIKO_EMAIL"); v != "" {
+		cfg.PremiumEmail = v
+	}
+
+	if v := os.Getenv("RADIKO_PASSWORD"); v != "" {
+		cfg.PremiumPassword = v
+	}
+
+	if v := os.Getenv("TOKEN_CACHE"); v != "" {
+		cfg.DisableTokenCache = v == "false"
+	}
+
+	if v, ok := os.LookupEnv("LIBRARY_PATH"); ok {
+		cfg.Library = v
+	}
+
+	if v := os.Getenv("DOWNLOAD_CONCURRENCY"); v != "" {
+		if n, convErr := strconv.Atoi(v); convErr == nil {
+			cfg.Concurrency = n
+		}
+	}
+
+	if v := os.Getenv("BATCH_CONCURRENCY"); v != "" {
+		if n, convErr := strconv.Atoi(v); convErr == nil {
+			cfg.BatchConcurrency = n
+		}
+	}
+
+	if v := os.Getenv("SEGMENT_RETRIES"); v != "" {
+		if n, convErr := strconv.Atoi(v); convErr == nil {
+			cfg.SegmentRetries = n
+		}
+	}
+
+	if v := os.Getenv("FAILURE_BUDGET"); v != "" {
+		if n, convErr := strconv.Atoi(v); convErr == nil {
+			cfg.FailureBudget = n
+		}
+	}
+
 	return cfg, err
 }
 
+// parsePairs は "key=value,key=value" 形式の環境変数を読み込む
+func parsePairs(v string) map[string]string {
+	pairs := map[string]string{}
+	for _, item := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	return pairs
+}
+
 // BuildOutputPath creates the final output file path based on the
 // provided parameters and configuration. The directory part of the
-// path is created if necessary.
+// path is created if necessary. When cfg.OutputFormat is set the file
+// gets that format's extension; otherwise a supported audio extension
+// (.mp3, .m4a, .aac, .opus, .flac) is kept and anything else gets .mp3.
 func BuildOutputPath(cfg *Config, stationID, output string, start time.Time) (string, error) {
+	format := outputFormats[DefaultFormat]
+	if cfg.OutputFormat != "" {
+		f, err := LookupFormat(cfg.OutputFormat)
+		if err != nil {
+			return "", err
+		}
+		format = f
+	}
+
 	file := output
 	if file == "" {
-		file = fmt.Sprintf("%s_%s.mp3", stationID, start.Format("20060102_1504"))
-	} else if file == "yyyymmdd_hhmm.mp3" {
-		file = fmt.Sprintf("%s.mp3", start.Format("20060102_1504"))
+		file = fmt.Sprintf("%s_%s%s", stationID, start.Format("20060102_1504"), format.Ext)
+	} else if ext := filepath.Ext(file); strings.TrimSuffix(file, ext) == "yyyymmdd_hhmm" {
+		file = start.Format("20060102_1504") + ext
 	}
 
 	if !filepath.IsAbs(file) && cfg.DefaultOutputDir != "" {
 		file = filepath.Join(cfg.DefaultOutputDir, file)
 	}
 
-	if !strings.HasSuffix(file, ".mp3") {
-		file += ".mp3"
+	if f, ok := FormatForPath(file); !ok {
+		file += format.Ext
+	} else if cfg.OutputFormat != "" && f.Name != format.Name {
+		file = strings.TrimSuffix(file, f.Ext) + format.Ext
 	}
 
 	dir := filepath.Dir(file)
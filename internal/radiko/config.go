@@ -2,16 +2,57 @@ package radiko
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 // Config はアプリケーションの設定
 type Config struct {
-	DefaultOutputDir string            `json:"default_output_dir"`
-	DefaultDuration  int               `json:"default_duration"`
-	StationAliases   map[string]string `json:"station_aliases"`
-	FFmpegPath       string            `json:"ffmpeg_path"`
+	DefaultOutputDir string                    `json:"default_output_dir"`
+	DefaultDuration  int                       `json:"default_duration"`
+	StationAliases   map[string]string         `json:"station_aliases"`
+	FFmpegPath       string                    `json:"ffmpeg_path"`
+	CacheDir         string                    `json:"cache_dir"`
+	Concurrency      int                       `json:"concurrency"`
+	SegmentRetries   int                       `json:"segment_retries"`
+	FailureBudget    int                       `json:"failure_budget"`
+	OutputFormat     string                    `json:"output_format"`
+	Encoders         map[string]EncoderOptions `json:"encoders,omitempty"`
+	Chapters         string                    `json:"chapters"`
+	UploadURL        string                    `json:"upload_url"`
+	FeedBaseURL      string                    `json:"feed_base_url"`
+	FeedBy           string                    `json:"feed_by"`
+	UploadKey        string                    `json:"upload_key"`
+	ContentTypes     map[string]string         `json:"content_types,omitempty"`
+	UploadTags       map[string]string         `json:"upload_tags,omitempty"`
+	StorageClass     string                    `json:"storage_class"`
+	KMSKeyID         string                    `json:"kms_key_id"`
+	BatchConcurrency int                       `json:"batch_concurrency,omitempty"`
+	// Library は録音済みの番組の一覧（ライブラリ）のファイル。空の場合は使わない
+	Library string `json:"library"`
+	// Area は認証で指定するエリアID（JP1〜JP47）。空の場合はIPアドレスでエリアが決まる
+	Area string `json:"area,omitempty"`
+	// AppKeyFile はエリアを指定した認証に使うスマートフォンアプリの鍵ファイル
+	AppKeyFile string `json:"app_key_file,omitempty"`
+	// PremiumEmail, PremiumPassword はradikoプレミアム（エリアフリー）のログイン情報。
+	// 環境変数からだけ読み込み、設定ファイルには保存しない
+	PremiumEmail    string `json:"-"`
+	PremiumPassword string `json:"-"`
+	// DisableTokenCache は認証トークンをCacheDirに保存して使い回すのをやめる
+	DisableTokenCache bool `json:"disable_token_cache,omitempty"`
+}
+
+// String はプレミアムのログイン情報を伏せた設定の内容を返す（ログ表示用）
+func (c Config) String() string {
+	type config Config
+	if c.PremiumEmail != "" {
+		c.PremiumEmail = "****"
+	}
+	if c.PremiumPassword != "" {
+		c.PremiumPassword = "****"
+	}
+	return fmt.Sprintf("%+v", config(c))
 }
 
 // DefaultConfig はデフォルト設定を返す
@@ -34,7 +75,12 @@ func DefaultConfig() *Config {
 			"nack":    "NACK5",
 			"fmy":     "YFM",
 		},
-		FFmpegPath: "ffmpeg",
+		FFmpegPath:     "ffmpeg",
+		CacheDir:       filepath.Join(homeDir, ".go-radio", "cache"),
+		Library:        filepath.Join(homeDir, ".go-radio", "library.json"),
+		Concurrency:    DefaultConcurrency,
+		SegmentRetries: DefaultRetryPolicy().MaxRetries,
+		FeedBy:         "station",
 	}
 }
 
@@ -63,7 +109,8 @@ func LoadConfig(configPath string) (*Config, error) {
 	return config, err
 }
 
-// SaveConfig は設定ファイルを保存
+// SaveConfig は設定ファイルを保存する。
+// 保存先のURLに認証情報を含められるため、本人だけが読めるファイルにする
 func (c *Config) SaveConfig(configPath string) error {
 	if configPath == "" {
 		homeDir, err := os.UserHomeDir()
@@ -82,5 +129,5 @@ func (c *Config) SaveConfig(configPath string) error {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	return os.WriteFile(configPath, data, 0600)
 }
@@ -3,6 +3,7 @@ package radiko
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +20,12 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.FFmpegPath != "ffmpeg" {
 		t.Errorf("expected ffmpeg path ffmpeg, got %s", cfg.FFmpegPath)
 	}
+	if cfg.Concurrency != DefaultConcurrency {
+		t.Errorf("expected concurrency %d, got %d", DefaultConcurrency, cfg.Concurrency)
+	}
+	if cfg.CacheDir != filepath.Join(home, ".go-radio", "cache") {
+		t.Errorf("unexpected cache dir %s", cfg.CacheDir)
+	}
 	if len(cfg.StationAliases) == 0 {
 		t.Errorf("station aliases should not be empty")
 	}
@@ -32,10 +39,25 @@ func TestLoadAndSaveConfig(t *testing.T) {
 		DefaultDuration:  30,
 		StationAliases:   map[string]string{"x": "y"},
 		FFmpegPath:       "/usr/bin/ffmpeg",
+		PremiumEmail:     "listener@example.com",
+		PremiumPassword:  "secret",
 	}
 	if err := cfg.SaveConfig(path); err != nil {
 		t.Fatalf("SaveConfig error: %v", err)
 	}
+	// プレミアムのログイン情報は保存せず、ファイルは本人だけが読める
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "listener@example.com") || strings.Contains(string(data), "secret") {
+		t.Errorf("premium credentials should not be saved:\n%s", data)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("config file should be private: %v", fi.Mode().Perm())
+	}
 	loaded, err := LoadConfig(path)
 	if err != nil {
 		t.Fatalf("LoadConfig error: %v", err)
@@ -60,3 +82,30 @@ func TestLoadConfigMissingFile(t *testing.T) {
 		t.Errorf("expected default duration %d, got %d", def.DefaultDuration, cfg.DefaultDuration)
 	}
 }
+
+func TestLoadConfigWithEnv_Upload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("UPLOAD_KEY", "{station}/{yyyy}/{program}_{start}.mp3")
+	t.Setenv("CONTENT_TYPES", "mp3=audio/mpeg3, opus = audio/opus")
+	t.Setenv("UPLOAD_TAGS", "project=radio,invalid,env=prod")
+	t.Setenv("UPLOAD_STORAGE_CLASS", "STANDARD_IA")
+	t.Setenv("UPLOAD_KMS_KEY_ID", "alias/radio")
+	t.Setenv("LIBRARY_PATH", "")
+
+	cfg, err := LoadConfigWithEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UploadKey != "{station}/{yyyy}/{program}_{start}.mp3" || cfg.StorageClass != "STANDARD_IA" || cfg.KMSKeyID != "alias/radio" {
+		t.Errorf("unexpected upload settings: %+v", cfg)
+	}
+	if cfg.ContentTypes["mp3"] != "audio/mpeg3" || cfg.ContentTypes["opus"] != "audio/opus" {
+		t.Errorf("unexpected content types: %v", cfg.ContentTypes)
+	}
+	if len(cfg.UploadTags) != 2 || cfg.UploadTags["env"] != "prod" {
+		t.Errorf("unexpected tags: %v", cfg.UploadTags)
+	}
+	if cfg.Library != "" {
+		t.Errorf("LIBRARY_PATH= should disable the library: %q", cfg.Library)
+	}
+}
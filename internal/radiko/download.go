@@ -0,0 +1,94 @@
+package radiko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultConcurrency はセグメントの同時ダウンロード数のデフォルト値
+const DefaultConcurrency = 4
+
+// segmentResult はセグメント1つ分のダウンロード結果
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// segmentHook は書き込み（またはスキップ）したセグメントごとに呼ばれる
+type segmentHook func(index int, size int64, skipped bool) error
+
+// downloadSegments はsegments[first:]を並列にダウンロードし、プレイリストの順序でwに書き込む。
+// 取得済みで書き込み待ちのセグメントも同時ダウンロード数に含めるため、
+// メモリ上に保持するセグメントは最大でも同時ダウンロード数分に抑えられる
+func (c *Client) downloadSegments(ctx context.Context, segments []string, first int, w io.Writer, hook segmentHook) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	c.logger.Debug("セグメントダウンロード開始: %d/%dセグメント目から, 同時ダウンロード数=%d", first+1, len(segments), workers)
+
+	results := make([]chan segmentResult, len(segments))
+	for i := range results {
+		results[i] = make(chan segmentResult, 1)
+	}
+
+	// slots は書き込みが完了するまで解放されないため、書き込みが遅れると新しいダウンロードも止まる
+	slots := make(chan struct{}, workers)
+	go func() {
+		for i := first; i < len(segments); i++ {
+			segURL := segments[i]
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, segURL string) {
+				data, err := c.fetchSegmentWithRetry(ctx, i, segURL)
+				results[i] <- segmentResult{data: data, err: err}
+			}(i, segURL)
+		}
+	}()
+
+	var failed []int
+	for i := first; i < len(segments); i++ {
+		r := <-results[i]
+		<-slots
+		if r.err != nil {
+			var authErr *reauthError
+			if ctx.Err() != nil || errors.As(r.err, &authErr) {
+				return fmt.Errorf("セグメント%d: %w", i, r.err)
+			}
+			failed = append(failed, i)
+			if len(failed) > c.failureBudget {
+				return &SegmentError{Failed: failed, Total: len(segments), Err: r.err}
+			}
+			c.logger.Error("セグメント%dをスキップします (%d/%d): %v", i, len(failed), c.failureBudget, r.err)
+			if hook != nil {
+				if err := hook(i, 0, true); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if _, err := w.Write(r.data); err != nil {
+			return err
+		}
+		if hook != nil {
+			if err := hook(i, int64(len(r.data)), false); err != nil {
+				return err
+			}
+		}
+		if (i+1)%10 == 0 {
+			c.logger.Info("%d/%dセグメント完了", i+1, len(segments))
+		}
+	}
+	if len(failed) > 0 {
+		c.logger.Error("%d個のセグメントをスキップして録音しました: %v", len(failed), failed)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadSegmentsOrdered(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		// 先頭のセグメントほど遅く返して、完了順と書き込み順を入れ替える
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/seg"))
+		time.Sleep(time.Duration(10-n%10) * 2 * time.Millisecond)
+		fmt.Fprintf(w, "[%d]", n)
+	}))
+	defer server.Close()
+
+	var segments []string
+	var want strings.Builder
+	for i := 0; i < 20; i++ {
+		segments = append(segments, fmt.Sprintf("%s/seg%d", server.URL, i))
+		fmt.Fprintf(&want, "[%d]", i)
+	}
+
+	c := &Client{httpClient: server.Client(), logger: NewLogger(false), concurrency: 3}
+	var out bytes.Buffer
+	if err := c.downloadSegments(context.Background(), segments, 0, &out, nil); err != nil {
+		t.Fatalf("downloadSegments error: %v", err)
+	}
+	if out.String() != want.String() {
+		t.Errorf("segments out of order:\n got=%s\nwant=%s", out.String(), want.String())
+	}
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 concurrent downloads, got %d", maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("expected downloads to run concurrently, got %d", maxInFlight)
+	}
+}
+
+func TestDownloadSegmentsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/seg2" {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	var segments []string
+	for i := 0; i < 5; i++ {
+		segments = append(segments, fmt.Sprintf("%s/seg%d", server.URL, i))
+	}
+
+	c := &Client{httpClient: server.Client(), logger: NewLogger(false), concurrency: 2}
+	var out bytes.Buffer
+	err := c.downloadSegments(context.Background(), segments, 0, &out, nil)
+	if err == nil {
+		t.Fatal("expected error for missing segment")
+	}
+	if out.String() != "/seg0/seg1" {
+		t.Errorf("expected only segments before the failure to be written, got %s", out.String())
+	}
+}
@@ -0,0 +1,159 @@
+package radiko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultFormat は出力形式が指定されていない場合の形式
+const DefaultFormat = "mp3"
+
+// OutputFormat は出力ファイルの形式
+type OutputFormat struct {
+	// Name は形式名（-format や Config.OutputFormat に指定する値）
+	Name string
+	// Ext は出力ファイルの拡張子
+	Ext string
+	// ContentType はアップロード時のContent-Type
+	ContentType string
+	// codec はffmpegのエンコーダー名
+	codec string
+	// container はffmpegの出力フォーマット名（拡張子から判定できない場合に指定）
+	container string
+	// copy はエンコーダー設定がない場合にffmpegを使わずに出力できるか
+	copy bool
+}
+
+// EncoderOptions は形式ごとのエンコーダー設定
+type EncoderOptions struct {
+	// Bitrate はビットレート（例: "192k"）。固定ビットレートでエンコードする
+	Bitrate string `json:"bitrate,omitempty"`
+	// Quality はVBRの品質（mp3/aac/m4aは-q:a、flacは圧縮レベルとして渡す）
+	Quality *int `json:"quality,omitempty"`
+	// Mono はモノラルにダウンミックスする
+	Mono bool `json:"mono,omitempty"`
+	// SampleRate はサンプリング周波数（Hz）
+	SampleRate int `json:"sample_rate,omitempty"`
+}
+
+// IsZero はエンコーダー設定が指定されていないかを返す
+func (o EncoderOptions) IsZero() bool {
+	return o.Bitrate == "" && o.Quality == nil && !o.Mono && o.SampleRate == 0
+}
+
+// outputFormats は対応している出力形式
+var outputFormats = map[string]OutputFormat{
+	"mp3":  {Name: "mp3", Ext: ".mp3", ContentType: "audio/mpeg", codec: "libmp3lame"},
+	"m4a":  {Name: "m4a", Ext: ".m4a", ContentType: "audio/mp4", codec: "aac", copy: true},
+	"aac":  {Name: "aac", Ext: ".aac", ContentType: "audio/aac", codec: "aac", container: "adts", copy: true},
+	"opus": {Name: "opus", Ext: ".opus", ContentType: "audio/ogg", codec: "libopus"},
+	"flac": {Name: "flac", Ext: ".flac", ContentType: "audio/flac", codec: "flac"},
+}
+
+// LookupFormat は形式名から出力形式を返す
+func LookupFormat(name string) (OutputFormat, error) {
+	f, ok := outputFormats[strings.ToLower(strings.TrimPrefix(name, "."))]
+	if !ok {
+		return OutputFormat{}, fmt.Errorf("対応していない出力形式です: %s (対応形式: %s)", name, strings.Join(FormatNames(), ", "))
+	}
+	return f, nil
+}
+
+// FormatNames は対応している形式名の一覧を返す
+func FormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FormatForPath はファイルの拡張子から出力形式を返す。対応していない拡張子の場合はfalse
+func FormatForPath(path string) (OutputFormat, bool) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		return OutputFormat{}, false
+	}
+	f, err := LookupFormat(ext)
+	return f, err == nil
+}
+
+// RecordingPath は出力ファイルに対応する変換前の録音ファイル（ADTS形式のAAC）のパスを返す
+func RecordingPath(outputFile string) string {
+	base := outputFile
+	if _, ok := FormatForPath(outputFile); ok {
+		base = strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	}
+	if filepath.Ext(outputFile) == ".aac" {
+		// 出力もAACの場合は変換前のファイルと区別する
+		return base + ".rec.aac"
+	}
+	return base + ".aac"
+}
+
+// ffmpegArgs は録音ファイルを変換するffmpegの引数を返す
+func (f OutputFormat) ffmpegArgs(input, output string, opts EncoderOptions) []string {
+	args := []string{"-y", "-i", input, "-vn", "-c:a", f.codec}
+	if opts.Bitrate != "" {
+		args = append(args, "-b:a", opts.Bitrate)
+	}
+	if opts.Quality != nil {
+		if f.Name == "flac" {
+			args = append(args, "-compression_level", strconv.Itoa(*opts.Quality))
+		} else {
+			args = append(args, "-q:a", strconv.Itoa(*opts.Quality))
+		}
+	}
+	if opts.Mono {
+		args = append(args, "-ac", "1")
+	}
+	if opts.SampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(opts.SampleRate))
+	}
+	if f.container != "" {
+		args = append(args, "-f", f.container)
+	}
+	return append(args, output)
+}
+
+// ConvertAudioContext converts a recorded AAC file into the format implied by
+// the output extension, applying the encoder settings for that format from
+// cfg. M4A and AAC outputs without encoder settings are produced without
+// ffmpeg; everything else is transcoded by ffmpeg.
+func ConvertAudioContext(ctx context.Context, cfg *Config, input, output string) error {
+	f, ok := FormatForPath(output)
+	if !ok {
+		f = outputFormats[DefaultFormat]
+	}
+	opts := cfg.Encoders[f.Name]
+
+	if f.copy && opts.IsZero() {
+		if f.Name == "m4a" {
+			return RemuxToM4A(input, output)
+		}
+		return os.Rename(input, output)
+	}
+
+	ffmpegPath := cfg.FFmpegPath
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	cmd := exec.CommandContext(ctx, ffmpegPath, f.ffmpegArgs(input, output, opts)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpegの実行に失敗: %w: %s", err, lastLine(out))
+	}
+	return nil
+}
+
+// lastLine はffmpegの出力から最後の行（通常はエラーの内容）を返す
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,132 @@
+package radiko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupFormat(t *testing.T) {
+	for _, name := range []string{"mp3", "M4A", ".opus", "flac", "aac"} {
+		if _, err := LookupFormat(name); err != nil {
+			t.Errorf("LookupFormat(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := LookupFormat("wav"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	mp3, _ := LookupFormat("mp3")
+	got := mp3.ffmpegArgs("in.aac", "out.mp3", EncoderOptions{Bitrate: "192k"})
+	want := []string{"-y", "-i", "in.aac", "-vn", "-c:a", "libmp3lame", "-b:a", "192k", "out.mp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mp3 args = %v, want %v", got, want)
+	}
+
+	quality := 5
+	flac, _ := LookupFormat("flac")
+	got = flac.ffmpegArgs("in.aac", "out.flac", EncoderOptions{Quality: &quality, Mono: true, SampleRate: 16000})
+	want = []string{"-y", "-i", "in.aac", "-vn", "-c:a", "flac", "-compression_level", "5", "-ac", "1", "-ar", "16000", "out.flac"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flac args = %v, want %v", got, want)
+	}
+
+	aac, _ := LookupFormat("aac")
+	got = aac.ffmpegArgs("in.rec.aac", "out.aac", EncoderOptions{Bitrate: "64k"})
+	if got[len(got)-3] != "-f" || got[len(got)-2] != "adts" {
+		t.Errorf("aac args should force the adts muxer: %v", got)
+	}
+}
+
+func TestBuildOutputPath_Format(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 6, 7, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		output string
+		want   string
+	}{
+		{"", "", "TBS_20240607_2000.mp3"},
+		{"", "show.opus", "show.opus"},
+		{"flac", "", "TBS_20240607_2000.flac"},
+		{"opus", "show.mp3", "show.opus"},
+		{"opus", "show", "show.opus"},
+		{"m4a", "yyyymmdd_hhmm.mp3", "20240607_2000.m4a"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{DefaultOutputDir: dir, OutputFormat: tt.format}
+		got, err := BuildOutputPath(cfg, "TBS", tt.output, start)
+		if err != nil {
+			t.Fatalf("BuildOutputPath(%q, %q) failed: %v", tt.format, tt.output, err)
+		}
+		if want := filepath.Join(dir, tt.want); got != want {
+			t.Errorf("BuildOutputPath(%q, %q) = %s, want %s", tt.format, tt.output, got, want)
+		}
+	}
+
+	if _, err := BuildOutputPath(&Config{OutputFormat: "wav"}, "TBS", "", start); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestRecordingPath(t *testing.T) {
+	tests := map[string]string{
+		"/tmp/show.mp3":  "/tmp/show.aac",
+		"/tmp/show.flac": "/tmp/show.aac",
+		"/tmp/show.aac":  "/tmp/show.rec.aac",
+		"/tmp/show":      "/tmp/show.aac",
+	}
+	for output, want := range tests {
+		if got := RecordingPath(output); got != want {
+			t.Errorf("RecordingPath(%q) = %s, want %s", output, got, want)
+		}
+	}
+}
+
+func TestConvertAudioContext_AACWithoutEncoder(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "show.rec.aac")
+	output := filepath.Join(dir, "show.aac")
+	os.WriteFile(input, []byte("adts"), 0644)
+
+	// エンコーダー設定がなければffmpegは実行されない
+	cfg := &Config{FFmpegPath: filepath.Join(dir, "missing-ffmpeg")}
+	if err := ConvertAudioContext(context.Background(), cfg, input, output); err != nil {
+		t.Fatalf("ConvertAudioContext failed: %v", err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "adts" {
+		t.Errorf("Expected recording to be moved to %s", output)
+	}
+}
+
+func TestConvertAudioContext_EncoderOptions(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		FFmpegPath: ffmpeg,
+		Encoders:   map[string]EncoderOptions{"mp3": {Mono: true, SampleRate: 16000}},
+	}
+	if err := ConvertAudioContext(context.Background(), cfg, "in.aac", "out.mp3"); err != nil {
+		t.Fatalf("ConvertAudioContext failed: %v", err)
+	}
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "-y -i in.aac -vn -c:a libmp3lame -ac 1 -ar 16000 out.mp3" {
+		t.Errorf("Unexpected ffmpeg args: %s", got)
+	}
+}
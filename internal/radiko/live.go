@@ -0,0 +1,355 @@
+package radiko
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// liveGracePeriod は録音時間に対して許容する追加の待ち時間。
+// プレイリストの更新が止まった場合でもこの時間を過ぎたら録音を終える
+const liveGracePeriod = time.Minute
+
+// streamListXML はライブストリームURL一覧XMLのルート要素
+type streamListXML struct {
+	URLs []struct {
+		AreaFree          int    `xml:"areafree,attr"`
+		TimeFree          int    `xml:"timefree,attr"`
+		PlaylistCreateURL string `xml:"playlist_create_url"`
+	} `xml:"url"`
+}
+
+// mediaSegment はメディアプレイリスト内の1セグメント
+type mediaSegment struct {
+	sequence int
+	url      string
+	duration time.Duration
+}
+
+// mediaPlaylist はHLSメディアプレイリストの解析結果
+type mediaPlaylist struct {
+	targetDuration time.Duration
+	segments       []mediaSegment
+	endList        bool
+}
+
+// PartialRecordingError は録音時間に達する前に時間切れになり、途中までの録音だけを残したことを表す。
+// 録音ファイルは残っているため、呼び出し側は変換・アップロードしたうえで失敗として報告する
+type PartialRecordingError struct {
+	// File は途中までの録音ファイル
+	File string
+	// Size は録音できた大きさ（バイト）
+	Size int64
+	Err  error
+}
+
+func (e *PartialRecordingError) Error() string {
+	return fmt.Sprintf("時間切れのため途中までしか録音できませんでした (%s, %.2f MB): %v", e.File, float64(e.Size)/(1024*1024), e.Err)
+}
+
+func (e *PartialRecordingError) Unwrap() error {
+	return e.Err
+}
+
+// RecordLive はライブストリームを指定時間だけ録音する。
+// 途中で時間切れになった場合は録音ファイルを残して *PartialRecordingError を返す
+func (c *Client) RecordLive(ctx context.Context, stationID string, duration time.Duration, outputFile string) error {
+	if c.token() == "" {
+		return fmt.Errorf("認証が必要です。先にAuth()を実行してください")
+	}
+
+	c.logger.Debug("ライブ録音設定: 局=%s, 録音時間=%s", stationID, duration)
+
+	if err := c.CheckStationAreaContext(ctx, stationID); err != nil {
+		return err
+	}
+
+	streamURL, err := c.getLiveURL(ctx, stationID)
+	if err != nil {
+		return fmt.Errorf("ライブストリームURL取得エラー: %w", err)
+	}
+	c.logger.Debug("ライブストリームURL: %s", streamURL)
+
+	mediaURL, err := c.resolveMediaPlaylist(ctx, streamURL)
+	if err != nil {
+		return fmt.Errorf("メディアプレイリスト取得エラー: %w", err)
+	}
+	c.logger.Debug("メディアプレイリストURL: %s", mediaURL)
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	err = c.followLive(ctx, mediaURL, duration, out)
+	fi, statErr := out.Stat()
+	if statErr != nil {
+		return statErr
+	}
+	if err != nil {
+		// Lambdaの実行時間の上限などで時間切れになった場合は、途中までの録音を残して変換できるようにする
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && fi.Size() > 0 {
+			return &PartialRecordingError{File: outputFile, Size: fi.Size(), Err: err}
+		}
+		if ctx.Err() != nil {
+			// 中断された場合は途中までの録音を残さない
+			out.Close()
+			os.Remove(outputFile)
+		}
+		return err
+	}
+	c.logger.Info("ライブ録音完了: %s (%.2f MB)", outputFile, float64(fi.Size())/(1024*1024))
+	return nil
+}
+
+// followLive はスライディングウィンドウのメディアプレイリストを追いかけて録音時間分のセグメントをwに書き込む
+func (c *Client) followLive(ctx context.Context, mediaURL string, duration time.Duration, w io.Writer) error {
+	c.logger.Info("ライブ録音開始...")
+	deadline := time.Now().Add(duration + liveGracePeriod)
+	var recorded time.Duration
+	lastSeq := -1
+	for recorded < duration {
+		playlist, err := c.fetchMediaPlaylist(ctx, mediaURL)
+		if err != nil {
+			return err
+		}
+
+		// 最初の取得ではスライディングウィンドウ内のセグメントをすべて録音し、
+		// 以降はメディアシーケンス番号で重複を除いて新しいセグメントのみ追記する
+		for _, seg := range playlist.segments {
+			if seg.sequence <= lastSeq {
+				continue
+			}
+			if lastSeq >= 0 && seg.sequence > lastSeq+1 {
+				c.logger.Error("セグメントが欠落しました: %d - %d", lastSeq+1, seg.sequence-1)
+			}
+			// 一時的なエラーはタイムフリーと同じく待ち時間を延ばしながら再試行する
+			data, err := c.fetchSegmentWithRetry(ctx, seg.sequence, seg.url)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			lastSeq = seg.sequence
+			recorded += seg.duration
+			if recorded >= duration {
+				break
+			}
+		}
+		c.logger.Debug("ライブ録音中: %s / %s (シーケンス=%d)", recorded.Truncate(time.Second), duration, lastSeq)
+
+		if recorded >= duration || playlist.endList {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.logger.Error("プレイリストが更新されないため録音を終了します")
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(livePollInterval(playlist.targetDuration)):
+		}
+	}
+
+	c.logger.Debug("ライブ録音終了: %s", recorded.Truncate(time.Second))
+	return nil
+}
+
+// livePollInterval はプレイリストの再取得間隔を返す（#EXT-X-TARGETDURATIONの半分）
+func livePollInterval(target time.Duration) time.Duration {
+	if target <= 0 {
+		return time.Second
+	}
+	return target / 2
+}
+
+// getLiveURL はライブ再生用のプレイリストURLを取得
+func (c *Client) getLiveURL(ctx context.Context, stationID string) (string, error) {
+	listURL := c.apiURL(fmt.Sprintf("/v3/station/stream/pc_html5/%s.xml", stationID))
+	c.logger.Debug("ストリームURL一覧取得: %s", listURL)
+
+	data, err := c.getAuthorized(ctx, listURL)
+	if err != nil {
+		return "", err
+	}
+
+	var doc streamListXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("ストリームURL一覧解析エラー: %w", err)
+	}
+
+	for _, u := range doc.URLs {
+		if u.TimeFree == 0 && u.AreaFree == 0 && u.PlaylistCreateURL != "" {
+			lsid, err := newListenerID()
+			if err != nil {
+				return "", err
+			}
+			query := url.Values{}
+			query.Set("station_id", stationID)
+			query.Set("l", "15")
+			query.Set("lsid", lsid)
+			query.Set("type", "b")
+			return u.PlaylistCreateURL + "?" + query.Encode(), nil
+		}
+	}
+	return "", fmt.Errorf("ライブストリームURLが見つかりません: 局=%s", stationID)
+}
+
+// resolveMediaPlaylist はマスタープレイリストからメディアプレイリストのURLを解決する
+func (c *Client) resolveMediaPlaylist(ctx context.Context, playlistURL string) (string, error) {
+	data, err := c.getAuthorized(ctx, playlistURL)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(data, []byte("#EXT-X-STREAM-INF")) {
+		// すでにメディアプレイリスト
+		return playlistURL, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return resolveURL(playlistURL, line)
+	}
+	return "", fmt.Errorf("マスタープレイリストにメディアプレイリストがありません")
+}
+
+// fetchMediaPlaylist はメディアプレイリストを取得して解析
+func (c *Client) fetchMediaPlaylist(ctx context.Context, playlistURL string) (*mediaPlaylist, error) {
+	data, err := c.getAuthorized(ctx, playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseMediaPlaylist(data, playlistURL)
+}
+
+// parseMediaPlaylist はHLSメディアプレイリストを解析する
+func parseMediaPlaylist(data []byte, playlistURL string) (*mediaPlaylist, error) {
+	playlist := &mediaPlaylist{}
+	sequence := 0
+	var segDuration time.Duration
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+			if err != nil {
+				return nil, fmt.Errorf("メディアシーケンスの解析エラー: %w", err)
+			}
+			sequence = n
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if err != nil {
+				return nil, fmt.Errorf("ターゲット長の解析エラー: %w", err)
+			}
+			playlist.targetDuration = time.Duration(n) * time.Second
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			sec, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("セグメント長の解析エラー: %w", err)
+			}
+			segDuration = time.Duration(sec * float64(time.Second))
+		case line == "#EXT-X-ENDLIST":
+			playlist.endList = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			u, err := resolveURL(playlistURL, line)
+			if err != nil {
+				return nil, err
+			}
+			playlist.segments = append(playlist.segments, mediaSegment{
+				sequence: sequence,
+				url:      u,
+				duration: segDuration,
+			})
+			sequence++
+			segDuration = 0
+		}
+	}
+	return playlist, scanner.Err()
+}
+
+// get はradikoの認証ヘッダー付きでGETリクエストを送り、本文を返す
+func (c *Client) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	if token := c.token(); token != "" {
+		req.Header.Set("X-Radiko-AuthToken", token)
+	}
+	c.setSessionCookie(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Op: rawURL + " の取得"}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// getAuthorized はgetと同じくURLの内容を返す。
+// 401/403が返った場合はタイムフリーと同じくトークンの期限切れとみなし、再認証してから取り直す
+func (c *Client) getAuthorized(ctx context.Context, rawURL string) ([]byte, error) {
+	usedToken := c.token()
+	data, err := c.get(ctx, rawURL)
+	if !isAuthExpired(err) {
+		return data, err
+	}
+	if err := c.reauth(ctx, usedToken); err != nil {
+		return nil, &reauthError{err: err}
+	}
+	return c.get(ctx, rawURL)
+}
+
+// resolveURL はプレイリスト内の相対URLを絶対URLに変換する
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// newListenerID はストリーム取得用のランダムなリスナーIDを生成
+func newListenerID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
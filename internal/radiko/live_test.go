@@ -0,0 +1,189 @@
+package radiko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseMediaPlaylist(t *testing.T) {
+	data := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:5\n#EXT-X-MEDIA-SEQUENCE:100\n" +
+		"#EXTINF:5.000,\nseg100.aac\n#EXTINF:4.5,\nhttps://example.com/seg101.aac\n#EXT-X-ENDLIST\n"
+	playlist, err := parseMediaPlaylist([]byte(data), "https://radiko.example/live/chunklist.m3u8")
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist error: %v", err)
+	}
+	if playlist.targetDuration != 5*time.Second || !playlist.endList {
+		t.Errorf("unexpected playlist header: %+v", playlist)
+	}
+	if len(playlist.segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(playlist.segments))
+	}
+	first, second := playlist.segments[0], playlist.segments[1]
+	if first.sequence != 100 || first.url != "https://radiko.example/live/seg100.aac" || first.duration != 5*time.Second {
+		t.Errorf("unexpected first segment: %+v", first)
+	}
+	if second.sequence != 101 || second.url != "https://example.com/seg101.aac" || second.duration != 4500*time.Millisecond {
+		t.Errorf("unexpected second segment: %+v", second)
+	}
+}
+
+// newLiveServer はライブストリームを配信するテスト用のradikoサーバーを返す。
+// チャンクリストは取得するたびにウィンドウが1セグメントずつ進み、セグメントの応答はsegmentで返す。
+// トークン "token" 以外のリクエストは403で拒否する
+func newLiveServer(t *testing.T, segment func(w http.ResponseWriter, name string)) *fakeRadiko {
+	t.Helper()
+	var mu sync.Mutex
+	polls := 0
+	server := newFakeRadiko(t)
+	server.Status = func(r *http.Request) int {
+		if r.Header.Get("X-Radiko-AuthToken") != "token" {
+			return http.StatusForbidden
+		}
+		return http.StatusOK
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v3/station/stream/pc_html5/TBS.xml":
+			fmt.Fprintf(w, `<urls>
+<url areafree="1" timefree="0"><playlist_create_url>%s/areafree.m3u8</playlist_create_url></url>
+<url areafree="0" timefree="0"><playlist_create_url>%s/so/playlist.m3u8</playlist_create_url></url>
+</urls>`, server.URL, server.URL)
+		case r.URL.Path == "/so/playlist.m3u8":
+			if r.URL.Query().Get("station_id") != "TBS" || r.URL.Query().Get("lsid") == "" {
+				w.WriteHeader(400)
+				return
+			}
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=52973\nchunklist.m3u8\n")
+		case r.URL.Path == "/so/chunklist.m3u8":
+			mu.Lock()
+			base := polls
+			polls++
+			mu.Unlock()
+			var b strings.Builder
+			fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:%d\n", base)
+			for i := base; i < base+3; i++ {
+				fmt.Fprintf(&b, "#EXTINF:0.2,\nseg%d.aac\n", i)
+			}
+			fmt.Fprint(w, b.String())
+		case strings.HasPrefix(r.URL.Path, "/so/seg"):
+			segment(w, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/so/"), ".aac"))
+		default:
+			w.WriteHeader(404)
+		}
+	})
+	return server
+}
+
+func TestRecordLive(t *testing.T) {
+	server := newLiveServer(t, func(w http.ResponseWriter, name string) {
+		fmt.Fprint(w, name)
+	})
+
+	c := &Client{authToken: "token", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	out := filepath.Join(t.TempDir(), "live.aac")
+	if err := c.RecordLive(context.Background(), "TBS", time.Second, out); err != nil {
+		t.Fatalf("RecordLive error: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if string(data) != "seg0seg1seg2seg3seg4" {
+		t.Errorf("unexpected recorded segments: %s", data)
+	}
+}
+
+func TestRecordLive_RetriesSegment(t *testing.T) {
+	var mu sync.Mutex
+	failed := false
+	server := newLiveServer(t, func(w http.ResponseWriter, name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		// seg1の最初の取得だけ一時的なエラーを返す
+		if name == "seg1" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, name)
+	})
+
+	c := &Client{authToken: "token", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	c.SetRetryPolicy(RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	out := filepath.Join(t.TempDir(), "live.aac")
+	if err := c.RecordLive(context.Background(), "TBS", time.Second, out); err != nil {
+		t.Fatalf("RecordLive error: %v", err)
+	}
+	data, _ := os.ReadFile(out)
+	if string(data) != "seg0seg1seg2seg3seg4" {
+		t.Errorf("failed segment should be retried: %s", data)
+	}
+}
+
+func TestRecordLive_KeepsPartialOnDeadline(t *testing.T) {
+	server := newLiveServer(t, func(w http.ResponseWriter, name string) {
+		fmt.Fprint(w, name)
+	})
+
+	c := &Client{authToken: "token", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	out := filepath.Join(t.TempDir(), "live.aac")
+	// 録音時間より先に期限が来ても、それまでの録音は残す
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	err := c.RecordLive(ctx, "TBS", time.Minute, out)
+	var partial *PartialRecordingError
+	if !errors.As(err, &partial) || partial.File != out || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected PartialRecordingError, got %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || !strings.HasPrefix(string(data), "seg0seg1seg2") {
+		t.Errorf("partial recording should be kept: %q, %v", data, err)
+	}
+
+	// 明示的に中断された場合は残さない
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	if err := c.RecordLive(ctx, "TBS", time.Minute, out); err == nil {
+		t.Error("canceled recording should fail")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("canceled recording should be removed: %v", err)
+	}
+}
+
+func TestRecordLive_ReauthOnExpiredToken(t *testing.T) {
+	server := newLiveServer(t, func(w http.ResponseWriter, name string) {
+		fmt.Fprint(w, name)
+	})
+	server.IssueToken = func(int) string { return "token2" }
+	// 録音を始める時点のトークンは期限切れ
+	server.Status = rejectTokens("token")
+
+	c := &Client{authToken: "token", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	out := filepath.Join(t.TempDir(), "live.aac")
+	if err := c.RecordLive(context.Background(), "TBS", time.Second, out); err != nil {
+		t.Fatalf("RecordLive error: %v", err)
+	}
+	if server.Auths() != 1 {
+		t.Errorf("expected a single re-authentication, got %d", server.Auths())
+	}
+	if c.token() != "token2" {
+		t.Errorf("expected refreshed token, got %s", c.token())
+	}
+}
+
+func TestRecordLiveRequiresAuth(t *testing.T) {
+	c := &Client{logger: NewLogger(false)}
+	if err := c.RecordLive(context.Background(), "TBS", time.Second, filepath.Join(t.TempDir(), "x.aac")); err == nil {
+		t.Errorf("expected error without auth token")
+	}
+}
@@ -0,0 +1,411 @@
+package radiko
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// samplesPerFrame はAACの1フレームあたりのサンプル数
+const samplesPerFrame = 1024
+
+// m4aChunkFrames は1チャンクにまとめるフレーム数（stcoの1エントリ分）
+const m4aChunkFrames = 64
+
+// adtsBufferSize はADTSの最大フレーム長(8191バイト)を1回で先読みできる読み込みバッファの大きさ
+const adtsBufferSize = 16 * 1024
+
+// adtsSampleRates はADTSヘッダーのサンプリング周波数インデックスに対応する周波数
+var adtsSampleRates = []uint32{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// adtsInfo はADTSストリームの構成とフレーム一覧
+type adtsInfo struct {
+	profile     byte // MPEG-4 Audio Object Type - 1
+	freqIndex   byte
+	channels    byte
+	sampleRate  uint32
+	frameSizes  []uint32 // ヘッダーを除いたフレームのサイズ
+	payloadSize int64
+}
+
+// duration はサンプル数単位のストリーム長を返す
+func (a *adtsInfo) duration() uint64 {
+	return uint64(len(a.frameSizes)) * samplesPerFrame
+}
+
+// RemuxToM4A はADTS形式のAACファイルを再エンコードせずにM4A(MP4)コンテナへ格納する。
+// HLSセグメントの先頭に付くID3タグや壊れたバイト列は読み飛ばす
+func RemuxToM4A(input, output string) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// 1回目の走査でフレーム構成を集め、2回目でフレーム本体をmdatにコピーする
+	info, err := scanADTS(bufio.NewReaderSize(in, adtsBufferSize), nil)
+	if err != nil {
+		return fmt.Errorf("ADTS解析エラー: %w", err)
+	}
+	if len(info.frameSizes) == 0 {
+		return fmt.Errorf("AACフレームが見つかりません: %s", input)
+	}
+
+	if dir := filepath.Dir(output); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err := writeM4A(out, in, info); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	return out.Close()
+}
+
+// writeM4A はftyp・moov・mdatの順に書き出す（moovを先頭に置いて先読み不要で再生できるようにする）
+func writeM4A(out io.Writer, in io.ReadSeeker, info *adtsInfo) error {
+	ftyp := m4aFtyp()
+	mdatHeader := uint64(8)
+	// moovの大きさはチャンクオフセットの値に依存しないため、仮のオフセットで先に組み立てて大きさを求める
+	moovSize := uint64(len(m4aMoov(info, 0)))
+	dataStart := uint64(len(ftyp)) + moovSize + mdatHeader
+	if dataStart+uint64(info.payloadSize) > math.MaxUint32 {
+		return fmt.Errorf("M4Aに格納できるサイズ(4GB)を超えています")
+	}
+
+	w := bufio.NewWriter(out)
+	w.Write(ftyp)
+	w.Write(m4aMoov(info, uint32(dataStart)))
+	writeBoxHeader(w, "mdat", mdatHeader+uint64(info.payloadSize))
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := scanADTS(bufio.NewReaderSize(in, adtsBufferSize), w); err != nil {
+		return fmt.Errorf("ADTS読み込みエラー: %w", err)
+	}
+	return w.Flush()
+}
+
+// scanADTS はADTSストリームを先頭から走査してフレーム構成を返す。
+// payloadがnilでない場合はヘッダーを除いたフレーム本体を書き込む
+func scanADTS(r *bufio.Reader, payload io.Writer) (*adtsInfo, error) {
+	info := &adtsInfo{}
+	first := true
+	for {
+		b, err := r.Peek(10)
+		if len(b) < 7 {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || err == nil {
+				return info, nil
+			}
+			return nil, err
+		}
+
+		// HLSセグメント先頭のID3v2タグ（タイムスタンプ）を読み飛ばす
+		if len(b) == 10 && b[0] == 'I' && b[1] == 'D' && b[2] == '3' {
+			size := int(syncsafeDecode(b[6:10]))
+			if b[5]&0x10 != 0 {
+				size += 10 // フッターあり
+			}
+			if _, err := r.Discard(10 + size); err != nil {
+				return info, nil
+			}
+			continue
+		}
+
+		// 同期ワード(0xFFF)まで読み飛ばす
+		if b[0] != 0xFF || b[1]&0xF6 != 0xF0 {
+			r.Discard(1)
+			continue
+		}
+
+		frameLen := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5])>>5
+		headerLen := 7
+		if b[1]&0x01 == 0 {
+			headerLen = 9 // CRCあり
+		}
+		profile := b[2] >> 6
+		freqIndex := (b[2] >> 2) & 0x0F
+		channels := (b[2]&0x01)<<2 | b[3]>>6
+		if frameLen <= headerLen || int(freqIndex) >= len(adtsSampleRates) {
+			r.Discard(1)
+			continue
+		}
+
+		if first {
+			info.profile = profile
+			info.freqIndex = freqIndex
+			info.channels = channels
+			info.sampleRate = adtsSampleRates[freqIndex]
+			first = false
+		} else if freqIndex != info.freqIndex || channels != info.channels {
+			return nil, fmt.Errorf("ストリームの途中で音声形式が変わっています")
+		}
+
+		frame, err := r.Peek(frameLen)
+		if len(frame) < frameLen {
+			if err == io.EOF {
+				// 末尾の欠けたフレームは含めない
+				return info, nil
+			}
+			return nil, err
+		}
+		if payload != nil {
+			if _, err := payload.Write(frame[headerLen:]); err != nil {
+				return nil, err
+			}
+		}
+		r.Discard(frameLen)
+		size := int64(frameLen - headerLen)
+		info.frameSizes = append(info.frameSizes, uint32(size))
+		info.payloadSize += size
+	}
+}
+
+// m4aFtyp はftypボックスを返す
+func m4aFtyp() []byte {
+	b := &boxBuilder{}
+	b.begin("ftyp")
+	b.str("M4A ")
+	b.u32(0)
+	b.str("M4A ")
+	b.str("mp42")
+	b.str("isom")
+	b.end()
+	return b.buf
+}
+
+// m4aMoov はmoovボックスを返す。dataStartはmdat内の最初のフレームのファイル先頭からの位置
+func m4aMoov(info *adtsInfo, dataStart uint32) []byte {
+	duration := info.duration()
+	b := &boxBuilder{}
+	b.begin("moov")
+
+	b.fullBox("mvhd", 0, 0)
+	b.u32(0) // creation_time
+	b.u32(0) // modification_time
+	b.u32(info.sampleRate)
+	b.u32(uint32(duration))
+	b.u32(0x00010000) // rate 1.0
+	b.u16(0x0100)     // volume 1.0
+	b.zero(10)
+	b.matrix()
+	b.zero(24)
+	b.u32(2) // next_track_ID
+	b.end()
+
+	b.begin("trak")
+	b.fullBox("tkhd", 0, 0x000003) // enabled | in_movie
+	b.u32(0)
+	b.u32(0)
+	b.u32(1) // track_ID
+	b.u32(0)
+	b.u32(uint32(duration))
+	b.zero(8)
+	b.u16(0)      // layer
+	b.u16(0)      // alternate_group
+	b.u16(0x0100) // volume
+	b.u16(0)
+	b.matrix()
+	b.u32(0) // width
+	b.u32(0) // height
+	b.end()
+
+	b.begin("mdia")
+	b.fullBox("mdhd", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.u32(info.sampleRate)
+	b.u32(uint32(duration))
+	b.u16(0x55C4) // language "und"
+	b.u16(0)
+	b.end()
+
+	b.fullBox("hdlr", 0, 0)
+	b.u32(0)
+	b.str("soun")
+	b.zero(12)
+	b.str("SoundHandler\x00")
+	b.end()
+
+	b.begin("minf")
+	b.fullBox("smhd", 0, 0)
+	b.u16(0) // balance
+	b.u16(0)
+	b.end()
+
+	b.begin("dinf")
+	b.fullBox("dref", 0, 0)
+	b.u32(1)
+	b.fullBox("url ", 0, 0x000001) // 同じファイル内のデータ
+	b.end()
+	b.end()
+	b.end()
+
+	b.begin("stbl")
+	m4aStsd(b, info)
+
+	// 全フレームが同じ長さなのでsttsは1エントリで済む
+	b.fullBox("stts", 0, 0)
+	b.u32(1)
+	b.u32(uint32(len(info.frameSizes)))
+	b.u32(samplesPerFrame)
+	b.end()
+
+	chunks := (len(info.frameSizes) + m4aChunkFrames - 1) / m4aChunkFrames
+	b.fullBox("stsc", 0, 0)
+	last := len(info.frameSizes) % m4aChunkFrames
+	if last == 0 || chunks == 1 {
+		b.u32(1)
+		b.u32(1)
+		b.u32(uint32(min(m4aChunkFrames, len(info.frameSizes))))
+		b.u32(1)
+	} else {
+		b.u32(2)
+		b.u32(1)
+		b.u32(m4aChunkFrames)
+		b.u32(1)
+		b.u32(uint32(chunks))
+		b.u32(uint32(last))
+		b.u32(1)
+	}
+	b.end()
+
+	b.fullBox("stsz", 0, 0)
+	b.u32(0) // 可変サイズ
+	b.u32(uint32(len(info.frameSizes)))
+	for _, size := range info.frameSizes {
+		b.u32(size)
+	}
+	b.end()
+
+	b.fullBox("stco", 0, 0)
+	b.u32(uint32(chunks))
+	offset := dataStart
+	for i, size := range info.frameSizes {
+		if i%m4aChunkFrames == 0 {
+			b.u32(offset)
+		}
+		offset += size
+	}
+	b.end()
+
+	b.end() // stbl
+	b.end() // minf
+	b.end() // mdia
+	b.end() // trak
+	b.end() // moov
+	return b.buf
+}
+
+// m4aStsd はmp4aサンプルエントリとesdsを書き込む
+func m4aStsd(b *boxBuilder, info *adtsInfo) {
+	b.fullBox("stsd", 0, 0)
+	b.u32(1)
+	b.begin("mp4a")
+	b.zero(6)
+	b.u16(1) // data_reference_index
+	b.zero(8)
+	b.u16(uint16(max(info.channels, 1)))
+	b.u16(16) // sample size
+	b.zero(4)
+	b.u32(info.sampleRate << 16)
+
+	// AudioSpecificConfig: object type(5) | frequency index(4) | channel config(4) | 0(3)
+	objectType := info.profile + 1
+	asc := []byte{
+		objectType<<3 | info.freqIndex>>1,
+		(info.freqIndex&0x01)<<7 | info.channels<<3,
+	}
+	var maxFrame uint32
+	for _, size := range info.frameSizes {
+		maxFrame = max(maxFrame, size)
+	}
+	seconds := float64(info.duration()) / float64(info.sampleRate)
+	avgBitrate := uint32(0)
+	if seconds > 0 {
+		avgBitrate = uint32(float64(info.payloadSize) * 8 / seconds)
+	}
+
+	decoderSpecific := descriptor(0x05, asc)
+	decoderConfig := descriptor(0x04, append([]byte{
+		0x40, // MPEG-4 Audio
+		0x15, // AudioStream
+		byte(maxFrame >> 16), byte(maxFrame >> 8), byte(maxFrame),
+		byte(avgBitrate >> 24), byte(avgBitrate >> 16), byte(avgBitrate >> 8), byte(avgBitrate), // maxBitrate
+		byte(avgBitrate >> 24), byte(avgBitrate >> 16), byte(avgBitrate >> 8), byte(avgBitrate), // avgBitrate
+	}, decoderSpecific...))
+	slConfig := descriptor(0x06, []byte{0x02})
+	es := descriptor(0x03, append(append([]byte{0x00, 0x01, 0x00}, decoderConfig...), slConfig...))
+
+	b.fullBox("esds", 0, 0)
+	b.bytes(es)
+	b.end()
+
+	b.end() // mp4a
+	b.end() // stsd
+}
+
+// descriptor はMPEG-4記述子（タグ + 可変長サイズ + 本体）を返す
+func descriptor(tag byte, body []byte) []byte {
+	n := len(body)
+	return append([]byte{tag, 0x80 | byte(n>>21), 0x80 | byte(n>>14), 0x80 | byte(n>>7), byte(n & 0x7F)}, body...)
+}
+
+// writeBoxHeader はボックスのヘッダーを書き込む
+func writeBoxHeader(w io.Writer, boxType string, size uint64) {
+	var h [8]byte
+	binary.BigEndian.PutUint32(h[:4], uint32(size))
+	copy(h[4:], boxType)
+	w.Write(h[:])
+}
+
+// boxBuilder はMP4ボックスを組み立てる。beginとendの組でボックスの大きさを埋める
+type boxBuilder struct {
+	buf    []byte
+	starts []int
+}
+
+func (b *boxBuilder) begin(boxType string) {
+	b.starts = append(b.starts, len(b.buf))
+	b.u32(0)
+	b.str(boxType)
+}
+
+func (b *boxBuilder) fullBox(boxType string, version byte, flags uint32) {
+	b.begin(boxType)
+	b.u32(uint32(version)<<24 | flags&0xFFFFFF)
+}
+
+func (b *boxBuilder) end() {
+	start := b.starts[len(b.starts)-1]
+	b.starts = b.starts[:len(b.starts)-1]
+	binary.BigEndian.PutUint32(b.buf[start:], uint32(len(b.buf)-start))
+}
+
+func (b *boxBuilder) u16(v uint16)   { b.buf = binary.BigEndian.AppendUint16(b.buf, v) }
+func (b *boxBuilder) u32(v uint32)   { b.buf = binary.BigEndian.AppendUint32(b.buf, v) }
+func (b *boxBuilder) str(s string)   { b.buf = append(b.buf, s...) }
+func (b *boxBuilder) bytes(p []byte) { b.buf = append(b.buf, p...) }
+func (b *boxBuilder) zero(n int)     { b.buf = append(b.buf, make([]byte, n)...) }
+
+// matrix は単位行列を書き込む
+func (b *boxBuilder) matrix() {
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b.u32(v)
+	}
+}
@@ -0,0 +1,153 @@
+package radiko
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// adtsFrame はテスト用のADTSフレーム（AAC-LC, 48kHz, ステレオ, CRCなし）を返す
+func adtsFrame(payload []byte) []byte {
+	frameLen := 7 + len(payload)
+	h := []byte{
+		0xFF, 0xF1,
+		1<<6 | 3<<2 | 0, // profile=LC(1), freq=48000(3), channel上位ビット=0
+		2<<6 | byte(frameLen>>11),
+		byte(frameLen >> 3),
+		byte(frameLen<<5) | 0x1F,
+		0xFC,
+	}
+	return append(h, payload...)
+}
+
+// id3Tag はHLSセグメント先頭に付くものと同じ形のID3v2タグを返す
+func id3Tag(body []byte) []byte {
+	n := len(body)
+	h := []byte{'I', 'D', '3', 4, 0, 0, byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+	return append(h, body...)
+}
+
+// findBox はMP4データから指定パスのボックス本体を返す
+func findBox(t *testing.T, data []byte, path ...string) []byte {
+	t.Helper()
+	for len(data) >= 8 {
+		size := binary.BigEndian.Uint32(data)
+		if size < 8 || int(size) > len(data) {
+			t.Fatalf("invalid box size %d", size)
+		}
+		if string(data[4:8]) == path[0] {
+			body := data[8:size]
+			if len(path) == 1 {
+				return body
+			}
+			return findBox(t, body, path[1:]...)
+		}
+		data = data[size:]
+	}
+	t.Fatalf("box not found: %v", path)
+	return nil
+}
+
+func TestRemuxToM4A(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.aac")
+	output := filepath.Join(dir, "out", "out.m4a")
+
+	var stream, payloads bytes.Buffer
+	frames := 130
+	for i := 0; i < frames; i++ {
+		if i%50 == 0 {
+			stream.Write(id3Tag([]byte("PRIV timestamp")))
+		}
+		payload := bytes.Repeat([]byte{byte(i)}, 10+i%7)
+		payloads.Write(payload)
+		stream.Write(adtsFrame(payload))
+	}
+	// 末尾の欠けたフレームは無視される
+	stream.Write(adtsFrame([]byte{1, 2, 3, 4})[:8])
+	if err := os.WriteFile(input, stream.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemuxToM4A(input, output); err != nil {
+		t.Fatalf("RemuxToM4A failed: %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if brand := string(findBox(t, data, "ftyp")[:4]); brand != "M4A " {
+		t.Errorf("Expected brand M4A, got %q", brand)
+	}
+
+	mdhd := findBox(t, data, "moov", "trak", "mdia", "mdhd")
+	if rate := binary.BigEndian.Uint32(mdhd[12:]); rate != 48000 {
+		t.Errorf("Expected timescale 48000, got %d", rate)
+	}
+	if d := binary.BigEndian.Uint32(mdhd[16:]); d != uint32(frames*1024) {
+		t.Errorf("Expected duration %d, got %d", frames*1024, d)
+	}
+
+	stsz := findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stsz")
+	if n := binary.BigEndian.Uint32(stsz[8:]); n != uint32(frames) {
+		t.Errorf("Expected %d samples, got %d", frames, n)
+	}
+
+	stco := findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stco")
+	chunks := binary.BigEndian.Uint32(stco[4:])
+	if chunks != 3 {
+		t.Errorf("Expected 3 chunks, got %d", chunks)
+	}
+	first := binary.BigEndian.Uint32(stco[8:])
+	if !bytes.Equal(data[first:first+10], payloads.Bytes()[:10]) {
+		t.Errorf("Chunk offset does not point at the first frame")
+	}
+
+	mdat := findBox(t, data, "mdat")
+	if !bytes.Equal(mdat, payloads.Bytes()) {
+		t.Errorf("mdat does not match the ADTS payloads (got %d bytes, want %d)", len(mdat), payloads.Len())
+	}
+
+	esds := findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+	// AudioSpecificConfig: LC, 48kHz, stereo
+	if !bytes.Contains(esds, []byte{0x05, 0x80, 0x80, 0x80, 0x02, 0x11, 0x90}) {
+		t.Errorf("AudioSpecificConfig not found in stsd")
+	}
+}
+
+func TestRemuxToM4A_NoFrames(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.aac")
+	os.WriteFile(input, []byte("not aac"), 0644)
+
+	if err := RemuxToM4A(input, filepath.Join(dir, "out.m4a")); err == nil {
+		t.Error("Expected error for input without AAC frames")
+	}
+}
+
+func TestBuildOutputPath_M4A(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{DefaultOutputDir: dir}
+	start := time.Date(2024, 6, 7, 20, 0, 0, 0, time.UTC)
+
+	tests := map[string]string{
+		"show.m4a":          filepath.Join(dir, "show.m4a"),
+		"show.mp3":          filepath.Join(dir, "show.mp3"),
+		"show":              filepath.Join(dir, "show.mp3"),
+		"yyyymmdd_hhmm.m4a": filepath.Join(dir, "20240607_2000.m4a"),
+		"yyyymmdd_hhmm.mp3": filepath.Join(dir, "20240607_2000.mp3"),
+	}
+	for output, want := range tests {
+		got, err := BuildOutputPath(cfg, "TBS", output, start)
+		if err != nil {
+			t.Fatalf("BuildOutputPath(%q) failed: %v", output, err)
+		}
+		if got != want {
+			t.Errorf("BuildOutputPath(%q) = %s, want %s", output, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package radiko
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestSaveInterval はマニフェストを保存するセグメント間隔
+const manifestSaveInterval = 10
+
+// recordingKey は録音対象を識別する情報
+type recordingKey struct {
+	StationID string    `json:"station_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// manifestSegment は書き込み済みセグメントの位置情報
+type manifestSegment struct {
+	Index   int   `json:"index"`
+	Offset  int64 `json:"offset"`
+	Size    int64 `json:"size"`
+	Skipped bool  `json:"skipped,omitempty"`
+}
+
+// manifest は途中まで録音したファイルの再開用情報
+type manifest struct {
+	recordingKey
+	Segments int               `json:"segments"`
+	Written  []manifestSegment `json:"written"`
+}
+
+// ManifestPath は録音ファイルに対応するマニフェストのパスを返す
+func ManifestPath(outputFile string) string {
+	return outputFile + ".manifest.json"
+}
+
+// loadManifest はマニフェストを読み込む（存在しない・壊れている場合はnil）
+func loadManifest(path string) *manifest {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return &m
+}
+
+// save はマニフェストを一時ファイル経由で書き込む
+func (m *manifest) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// matches は同じ番組・同じプレイリストの録音かを返す
+func (m *manifest) matches(key recordingKey, segments int) bool {
+	return m.StationID == key.StationID &&
+		m.Start.Equal(key.Start) &&
+		m.End.Equal(key.End) &&
+		m.Segments == segments
+}
+
+// size は書き込み済みのバイト数を返す
+func (m *manifest) size() int64 {
+	if len(m.Written) == 0 {
+		return 0
+	}
+	last := m.Written[len(m.Written)-1]
+	return last.Offset + last.Size
+}
+
+// add は書き込んだセグメントを記録する
+func (m *manifest) add(index int, size int64, skipped bool) {
+	m.Written = append(m.Written, manifestSegment{
+		Index:   index,
+		Offset:  m.size(),
+		Size:    size,
+		Skipped: skipped,
+	})
+}
+
+// openResumable は録音ファイルを開き、再開可能であれば書き込み済みの位置まで進める。
+// マニフェストが一致しない、またはファイルがマニフェストより短い場合は最初から録音する
+func openResumable(outputFile string, key recordingKey, segments int) (*os.File, *manifest, error) {
+	if dir := filepath.Dir(outputFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m := loadManifest(ManifestPath(outputFile))
+	if m != nil && m.matches(key, segments) && len(m.Written) > 0 {
+		if fi, err := os.Stat(outputFile); err == nil && fi.Size() >= m.size() {
+			out, err := os.OpenFile(outputFile, os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, nil, err
+			}
+			// マニフェスト保存後に書き込まれた分は破棄する
+			if err := out.Truncate(m.size()); err != nil {
+				out.Close()
+				return nil, nil, err
+			}
+			if _, err := out.Seek(m.size(), 0); err != nil {
+				out.Close()
+				return nil, nil, err
+			}
+			return out, m, nil
+		}
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, &manifest{recordingKey: key, Segments: segments}, nil
+}
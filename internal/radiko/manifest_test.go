@@ -0,0 +1,125 @@
+package radiko
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadWithGoResume(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	broken := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		fail := broken && r.URL.Path == "/seg13.aac"
+		mu.Unlock()
+
+		if r.URL.Path == "/playlist.m3u8" {
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n")
+			for i := 0; i < 15; i++ {
+				fmt.Fprintf(&b, "seg%d.aac\n", i)
+			}
+			io.WriteString(w, b.String())
+			return
+		}
+		if fail {
+			w.WriteHeader(404)
+			return
+		}
+		io.WriteString(w, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".aac")+";")
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: server.Client(), logger: NewLogger(false), concurrency: 1}
+	out := filepath.Join(t.TempDir(), "rec.aac")
+	jst := jstLocation()
+	key := recordingKey{StationID: "TBS", Start: time.Date(2024, 6, 7, 20, 0, 0, 0, jst), End: time.Date(2024, 6, 7, 21, 0, 0, 0, jst)}
+
+	if err := c.downloadWithGo(context.Background(), server.URL+"/playlist.m3u8", out, key); err == nil {
+		t.Fatal("expected error for missing segment")
+	}
+	m := loadManifest(ManifestPath(out))
+	if m == nil || len(m.Written) != 13 {
+		t.Fatalf("expected manifest with 13 written segments, got %+v", m)
+	}
+
+	mu.Lock()
+	broken = false
+	mu.Unlock()
+	if err := c.downloadWithGo(context.Background(), server.URL+"/playlist.m3u8", out, key); err != nil {
+		t.Fatalf("resume error: %v", err)
+	}
+
+	var want strings.Builder
+	for i := 0; i < 15; i++ {
+		fmt.Fprintf(&want, "seg%d;", i)
+	}
+	data, _ := os.ReadFile(out)
+	if string(data) != want.String() {
+		t.Errorf("unexpected output after resume:\n got=%s\nwant=%s", data, want.String())
+	}
+	if requests["/seg0.aac"] != 1 || requests["/seg12.aac"] != 1 {
+		t.Errorf("segments written before the failure should not be downloaded again: %v", requests)
+	}
+	if _, err := os.Stat(ManifestPath(out)); !os.IsNotExist(err) {
+		t.Errorf("manifest should be removed after completion")
+	}
+}
+
+func TestOpenResumableMismatch(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "rec.aac")
+	key := recordingKey{StationID: "TBS", Start: time.Unix(0, 0), End: time.Unix(3600, 0)}
+
+	m := &manifest{recordingKey: key, Segments: 3}
+	m.add(0, 4, false)
+	m.add(1, 0, true)
+	m.add(2, 4, false)
+	if m.size() != 8 || m.Written[2].Offset != 4 {
+		t.Fatalf("unexpected offsets: %+v", m.Written)
+	}
+	if err := m.save(ManifestPath(out)); err != nil {
+		t.Fatalf("save error: %v", err)
+	}
+	// マニフェスト保存後の書きかけの分は切り詰められる
+	if err := os.WriteFile(out, []byte("aaaabbbbcc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, resumed, err := openResumable(out, key, 3)
+	if err != nil {
+		t.Fatalf("openResumable error: %v", err)
+	}
+	f.Close()
+	if len(resumed.Written) != 3 {
+		t.Errorf("expected resume from manifest, got %+v", resumed)
+	}
+	if fi, _ := os.Stat(out); fi.Size() != 8 {
+		t.Errorf("expected file truncated to 8 bytes, got %d", fi.Size())
+	}
+
+	// 別の番組なら最初から
+	other := key
+	other.StationID = "LFR"
+	f, fresh, err := openResumable(out, other, 3)
+	if err != nil {
+		t.Fatalf("openResumable error: %v", err)
+	}
+	f.Close()
+	if len(fresh.Written) != 0 {
+		t.Errorf("expected fresh manifest for different recording, got %+v", fresh)
+	}
+	if fi, _ := os.Stat(out); fi.Size() != 0 {
+		t.Errorf("expected file recreated, got %d bytes", fi.Size())
+	}
+}
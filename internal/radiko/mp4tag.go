@@ -0,0 +1,267 @@
+package radiko
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// mp4Box はMP4ファイル内のボックスの位置
+type mp4Box struct {
+	boxType string
+	offset  int64
+	size    int64
+}
+
+// mp4ChunkContainers はチャンクオフセット（stco/co64）を探すときにたどるボックス
+var mp4ChunkContainers = map[string]bool{
+	"trak": true, "mdia": true, "minf": true, "stbl": true,
+}
+
+// writeMP4Tags はM4Aファイルのmoov/udtaをiTunes形式のメタデータで置き換える。
+// moovがmdatより前にある場合はmoovの大きさの変化に合わせてチャンクオフセットを補正する
+func writeMP4Tags(path string, md Metadata) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	boxes, err := readMP4Boxes(in, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	var moov *mp4Box
+	for i := range boxes {
+		if boxes[i].boxType == "moov" {
+			moov = &boxes[i]
+			break
+		}
+	}
+	if moov == nil {
+		return fmt.Errorf("moovボックスが見つかりません: %s", path)
+	}
+
+	old := make([]byte, moov.size)
+	if _, err := in.ReadAt(old, moov.offset); err != nil {
+		return err
+	}
+	headerLen := 8
+	if binary.BigEndian.Uint32(old) == 1 {
+		headerLen = 16
+	}
+	newMoov, err := rebuildMoov(old[headerLen:], md)
+	if err != nil {
+		return err
+	}
+
+	// moovより後ろにあるデータはmoovの大きさの差だけずれる
+	delta := int64(len(newMoov)) - moov.size
+	if err := patchChunkOffsets(newMoov[8:], moov.offset, delta); err != nil {
+		return err
+	}
+
+	return replaceFile(path, func(w io.Writer) error {
+		if _, err := io.Copy(w, io.NewSectionReader(in, 0, moov.offset)); err != nil {
+			return err
+		}
+		if _, err := w.Write(newMoov); err != nil {
+			return err
+		}
+		end := moov.offset + moov.size
+		_, err := io.Copy(w, io.NewSectionReader(in, end, fi.Size()-end))
+		return err
+	})
+}
+
+// readMP4Boxes はファイル直下のボックスの一覧を返す
+func readMP4Boxes(r io.ReaderAt, fileSize int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	header := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("MP4ボックスの読み込みエラー: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("MP4ボックスの読み込みエラー: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > fileSize {
+			return nil, fmt.Errorf("MP4ボックスの大きさが不正です: %s (%d)", header[4:8], size)
+		}
+		boxes = append(boxes, mp4Box{boxType: string(header[4:8]), offset: offset, size: size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// eachBox はbuf内のボックスを順に呼び出す（body はヘッダーを除いた本体）
+func eachBox(buf []byte, fn func(boxType string, box, body []byte) error) error {
+	for len(buf) > 0 {
+		if len(buf) < 8 {
+			return fmt.Errorf("MP4ボックスが途中で切れています")
+		}
+		size := int(binary.BigEndian.Uint32(buf))
+		headerLen := 8
+		if size == 1 {
+			if len(buf) < 16 {
+				return fmt.Errorf("MP4ボックスが途中で切れています")
+			}
+			size = int(binary.BigEndian.Uint64(buf[8:]))
+			headerLen = 16
+		}
+		if size < headerLen || size > len(buf) {
+			return fmt.Errorf("MP4ボックスの大きさが不正です: %s (%d)", buf[4:8], size)
+		}
+		if err := fn(string(buf[4:8]), buf[:size], buf[headerLen:size]); err != nil {
+			return err
+		}
+		buf = buf[size:]
+	}
+	return nil
+}
+
+// rebuildMoov は既存のudtaを除いたmoovに新しいudtaを追加して返す
+func rebuildMoov(children []byte, md Metadata) ([]byte, error) {
+	b := &boxBuilder{}
+	b.begin("moov")
+	err := eachBox(children, func(boxType string, box, _ []byte) error {
+		if boxType != "udta" {
+			b.bytes(box)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	mp4Udta(b, md)
+	b.end()
+	return b.buf, nil
+}
+
+// patchChunkOffsets はafterより後ろを指すチャンクオフセットにdeltaを加える
+func patchChunkOffsets(buf []byte, after, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	return eachBox(buf, func(boxType string, _, body []byte) error {
+		switch {
+		case mp4ChunkContainers[boxType]:
+			return patchChunkOffsets(body, after, delta)
+		case boxType == "stco":
+			n := int(binary.BigEndian.Uint32(body[4:]))
+			for i := 0; i < n; i++ {
+				p := body[8+i*4:]
+				if v := int64(binary.BigEndian.Uint32(p)); v > after {
+					binary.BigEndian.PutUint32(p, uint32(v+delta))
+				}
+			}
+		case boxType == "co64":
+			n := int(binary.BigEndian.Uint32(body[4:]))
+			for i := 0; i < n; i++ {
+				p := body[8+i*8:]
+				if v := int64(binary.BigEndian.Uint64(p)); v > after {
+					binary.BigEndian.PutUint64(p, uint64(v+delta))
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// mp4Udta はiTunes形式のメタデータ（udta/meta/ilst）を書き込む
+func mp4Udta(b *boxBuilder, md Metadata) {
+	b.begin("udta")
+	b.fullBox("meta", 0, 0)
+
+	b.fullBox("hdlr", 0, 0)
+	b.u32(0)
+	b.str("mdir")
+	b.str("appl")
+	b.zero(8)
+	b.str("\x00")
+	b.end()
+
+	b.begin("ilst")
+	text := func(name, value string) {
+		if value != "" {
+			mp4DataItem(b, name, 1, []byte(value))
+		}
+	}
+	text("\xa9nam", md.Title)
+	text("\xa9alb", md.Album)
+	text("\xa9ART", md.Artist)
+	text("aART", md.AlbumArtist)
+	if !md.Date.IsZero() {
+		text("\xa9day", md.Date.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+	text("desc", md.Description)
+	text("\xa9cmt", md.Description)
+	if len(md.Cover) > 0 {
+		dataType := uint32(13) // JPEG
+		if md.coverMIME() == "image/png" {
+			dataType = 14
+		}
+		mp4DataItem(b, "covr", dataType, md.Cover)
+	}
+	b.end() // ilst
+
+	b.end() // meta
+	mp4Chapters(b, md.Chapters)
+	b.end() // udta
+}
+
+// mp4Chapters はチャプターをNero形式のchplボックスとして書き込む
+func mp4Chapters(b *boxBuilder, chapters []Chapter) {
+	if len(chapters) == 0 {
+		return
+	}
+	chapters = chapters[:min(len(chapters), 255)]
+
+	b.fullBox("chpl", 1, 0)
+	b.u32(0) // reserved
+	b.bytes([]byte{byte(len(chapters))})
+	for _, ch := range chapters {
+		// 開始時刻は100ナノ秒単位
+		b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(ch.Start/100))
+		title := ch.Title
+		if len(title) > 255 {
+			title = truncateUTF8(title, 255)
+		}
+		b.bytes([]byte{byte(len(title))})
+		b.str(title)
+	}
+	b.end()
+}
+
+// truncateUTF8 は文字の途中で切らないようにnバイト以内に切り詰める
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// mp4DataItem はilstの1項目（dataボックスを含む）を書き込む
+func mp4DataItem(b *boxBuilder, name string, dataType uint32, value []byte) {
+	b.begin(name)
+	b.begin("data")
+	b.u32(dataType)
+	b.u32(0) // locale
+	b.bytes(value)
+	b.end()
+	b.end()
+}
@@ -0,0 +1,228 @@
+package radiko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sessionCookie はradikoプレミアムのセッションを渡すCookieとパラメータの名前
+const sessionCookie = "radiko_session"
+
+// sessionFileName はプレミアムのセッションを次回の実行で使い回すために保存するファイル名（CacheDirの中）
+const sessionFileName = "premium_session.json"
+
+// savedSession はファイルに保存するプレミアムのセッション
+type savedSession struct {
+	Email   string    `json:"email"`
+	Session string    `json:"radiko_session"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// loginResponse は /v4/api/member/login のレスポンス
+type loginResponse struct {
+	Session  string `json:"radiko_session"`
+	AreaFree string `json:"areafree"`
+}
+
+// SetPremium はradikoプレミアムのメールアドレスとパスワードを設定する。
+// 設定すると認証の前にログインし、エリア外の局も録音できるようになる。
+// sessionFileを指定するとセッションを保存し、次回の実行ではログインせずに使い回す
+func (c *Client) SetPremium(email, password, sessionFile string) {
+	c.premiumEmail = email
+	c.premiumPassword = password
+	c.sessionFile = sessionFile
+	c.logger.AddSecret(email)
+	c.logger.AddSecret(password)
+}
+
+// Session は現在のプレミアムのセッションIDを返す（ログインしていなければ空）
+func (c *Client) Session() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.session
+}
+
+func (c *Client) setSession(session string) {
+	c.logger.AddSecret(session)
+	c.tokenMu.Lock()
+	c.session = session
+	c.tokenMu.Unlock()
+}
+
+// setSessionCookie はプレミアムにログインしていればリクエストにセッションのCookieを付ける
+func (c *Client) setSessionCookie(req *http.Request) {
+	if session := c.Session(); session != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+	}
+}
+
+// LoginContext はradikoプレミアムにログインしてセッションを保持する
+func (c *Client) LoginContext(ctx context.Context, email, password string) error {
+	c.logger.AddSecret(email)
+	c.logger.AddSecret(password)
+	c.logger.Debug("radikoプレミアムにログイン")
+
+	form := url.Values{"mail": {email}, "pass": {password}}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL("/v4/api/member/login"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("ログインリクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ログインリクエストエラー: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("radikoプレミアムのログインに失敗: HTTP %d（メールアドレスとパスワードを確認してください）", resp.StatusCode)
+	}
+
+	var lr loginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+		return fmt.Errorf("ログインのレスポンスが正しくありません: %w", err)
+	}
+	if lr.Session == "" {
+		return fmt.Errorf("ログインのレスポンスにセッションがありません")
+	}
+	c.setSession(lr.Session)
+	if lr.AreaFree != "1" {
+		c.logger.Info("エリアフリーが有効ではないため、エリア外の局は録音できません")
+	}
+	c.logger.Info("radikoプレミアムにログインしました")
+	return nil
+}
+
+// CheckSessionContext は現在のセッションが有効かを確認する
+func (c *Client) CheckSessionContext(ctx context.Context) (bool, error) {
+	if c.Session() == "" {
+		return false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL("/ap/member/webapi/member/login/check"), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	c.setSessionCookie(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("セッションの確認に失敗: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// LogoutContext はradikoプレミアムからログアウトし、保存したセッションを削除する
+func (c *Client) LogoutContext(ctx context.Context) error {
+	if c.Session() == "" {
+		if saved, err := loadSession(c.sessionFile); err == nil {
+			c.setSession(saved.Session)
+		}
+	}
+	session := c.Session()
+	if c.sessionFile != "" {
+		if err := os.Remove(c.sessionFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("保存したセッションの削除に失敗: %w", err)
+		}
+	}
+	if session == "" {
+		return nil
+	}
+
+	form := url.Values{sessionCookie: {session}}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL("/v4/api/member/logout"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("ログアウトリクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ログアウトリクエストエラー: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("radikoプレミアムのログアウトに失敗: HTTP %d", resp.StatusCode)
+	}
+	c.setSession("")
+	c.logger.Info("radikoプレミアムからログアウトしました")
+	return nil
+}
+
+// ensureSession はプレミアムが設定されていれば、保存したセッションを使い回すかログインする
+func (c *Client) ensureSession(ctx context.Context) error {
+	if c.premiumEmail == "" || c.Session() != "" {
+		return nil
+	}
+	if saved, err := loadSession(c.sessionFile); err == nil && saved.Email == c.premiumEmail {
+		c.setSession(saved.Session)
+		ok, err := c.CheckSessionContext(ctx)
+		if err == nil && ok {
+			c.logger.Debug("保存したradikoプレミアムのセッションを使います")
+			return nil
+		}
+		c.logger.Debug("保存したセッションが使えないためログインし直します")
+		c.setSession("")
+	}
+
+	if err := c.LoginContext(ctx, c.premiumEmail, c.premiumPassword); err != nil {
+		return err
+	}
+	if c.sessionFile != "" {
+		if err := saveSession(c.sessionFile, savedSession{Email: c.premiumEmail, Session: c.Session(), SavedAt: time.Now()}); err != nil {
+			c.logger.Error("セッションの保存に失敗: %v", err)
+		}
+	}
+	return nil
+}
+
+// SessionPath はプレミアムのセッションを保存するファイルのパスを返す
+func SessionPath(cfg *Config) string {
+	if cfg.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.CacheDir, sessionFileName)
+}
+
+func loadSession(path string) (savedSession, error) {
+	var s savedSession
+	if path == "" {
+		return s, os.ErrNotExist
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, err
+	}
+	if s.Session == "" {
+		return s, os.ErrNotExist
+	}
+	return s, nil
+}
+
+// saveSession はセッションを本人だけが読めるファイルに保存する
+func saveSession(path string, s savedSession) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
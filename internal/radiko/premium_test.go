@@ -0,0 +1,148 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testEmail    = "listener@example.com"
+	testPassword = "p@ss-w0rd-secret"
+	testSession  = "session-0123456789abcdef"
+)
+
+// newPremiumServer はタイムフリーのプレイリストでプレミアムのセッションのCookieを求めるサーバーを返す
+func newPremiumServer(t *testing.T) *fakeRadiko {
+	t.Helper()
+	s := newFakeRadiko(t)
+	s.Status = func(r *http.Request) int {
+		if cookie, err := r.Cookie(sessionCookie); err != nil || cookie.Value != testSession {
+			return http.StatusForbidden
+		}
+		return http.StatusOK
+	}
+	return s
+}
+
+func TestPremium(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	server := newPremiumServer(t)
+	cfg := &Config{CacheDir: t.TempDir(), PremiumEmail: testEmail, PremiumPassword: testPassword}
+	ctx := context.Background()
+
+	c := server.client(cfg)
+	c.SetLogger(NewLogger(true))
+	if err := c.AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Session() != testSession || c.AreaID() != "JP27" {
+		t.Errorf("session should be passed to auth2: session=%q area=%s", c.Session(), c.AreaID())
+	}
+	if _, err := c.getTimeFreeURL(ctx, "ABC", time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Errorf("playlist request should carry the session cookie: %v", err)
+	}
+
+	// セッションは本人だけが読めるファイルに保存する
+	fi, err := os.Stat(SessionPath(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("session file mode = %v", fi.Mode().Perm())
+	}
+
+	// 保存先にアップロードされることもあるため、認証トークンのキャッシュにメールアドレスを残さない
+	if data, err := os.ReadFile(TokenCachePath(cfg)); err != nil || strings.Contains(string(data), testEmail) {
+		t.Errorf("token cache should not contain the email: %s, %v", data, err)
+	}
+
+	// 次回の実行では保存したセッションを使い回す
+	again := server.client(cfg)
+	again.SetLogger(NewLogger(true))
+	if err := again.AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Logins() != 1 || again.Session() != testSession {
+		t.Errorf("saved session should be reused: logins=%d", server.Logins())
+	}
+
+	if err := again.LogoutContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Logouts() != 1 || again.Session() != "" {
+		t.Errorf("logout should end the session: logouts=%d", server.Logouts())
+	}
+	if _, err := os.Stat(SessionPath(cfg)); !os.IsNotExist(err) {
+		t.Errorf("logout should remove the saved session: %v", err)
+	}
+
+	for _, secret := range []string{testEmail, testPassword, testSession} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("debug log should not contain %q:\n%s", secret, logs.String())
+		}
+	}
+}
+
+func TestPremium_ExpiredSession(t *testing.T) {
+	server := newPremiumServer(t)
+	cfg := &Config{CacheDir: t.TempDir(), PremiumEmail: testEmail, PremiumPassword: testPassword}
+	saveSession(SessionPath(cfg), savedSession{Email: testEmail, Session: "expired"})
+
+	c := server.client(cfg)
+	if err := c.AuthContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.Logins() != 1 || c.Session() != testSession {
+		t.Errorf("expired session should trigger a login: logins=%d session=%q", server.Logins(), c.Session())
+	}
+}
+
+func TestPremium_LoginFailed(t *testing.T) {
+	server := newPremiumServer(t)
+	c := server.client(&Config{PremiumEmail: testEmail, PremiumPassword: "wrong"})
+	err := c.AuthContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("expected login error, got %v", err)
+	}
+}
+
+func TestLogger_AddSecret(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	l := NewLogger(true)
+	l.AddSecret("hunter2")
+	l.AddSecret("")
+	l.Debug("password=%s", "hunter2")
+	l.Info("header: %v", map[string]string{"Cookie": "radiko_session=hunter2"})
+	if strings.Contains(logs.String(), "hunter2") || !strings.Contains(logs.String(), "password=****") {
+		t.Errorf("secrets should be redacted:\n%s", logs.String())
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PremiumEmail = testEmail
+	cfg.PremiumPassword = testPassword
+	got := fmt.Sprintf("%+v", cfg)
+	if strings.Contains(got, testPassword) || !strings.Contains(got, "PremiumPassword:****") {
+		t.Errorf("password should be redacted: %s", got)
+	}
+	if strings.Contains(got, testEmail) || !strings.Contains(got, "PremiumEmail:****") {
+		t.Errorf("email should be redacted: %s", got)
+	}
+	if cfg.PremiumEmail != testEmail || cfg.PremiumPassword != testPassword {
+		t.Error("String() should not modify the config")
+	}
+}
@@ -0,0 +1,270 @@
+package radiko
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// programTimeLayout は番組表XMLのft/to属性の時刻形式
+const programTimeLayout = "20060102150405"
+
+// Program は番組表の1番組
+type Program struct {
+	ID          string
+	StationID   string
+	Title       string
+	Performers  string
+	Start       time.Time
+	End         time.Time
+	Description string
+	Info        string
+	URL         string
+	Image       string
+}
+
+// Duration は番組の長さを分単位で返す
+func (p Program) Duration() int {
+	return int(p.End.Sub(p.Start) / time.Minute)
+}
+
+// BroadcastID は放送を区別する文字列（局ID_開始日時_終了日時、日時は日本時間の YYYYMMDDhhmmss）を返す。
+// 番組表のIDと違い、番組表を取得しなくても局と日時から作れる
+func (p Program) BroadcastID() string {
+	jst := jstLocation()
+	return p.StationID + "_" + p.Start.In(jst).Format(programTimeLayout) + "_" + p.End.In(jst).Format(programTimeLayout)
+}
+
+// programXML は番組表XMLのルート要素
+type programXML struct {
+	Stations []struct {
+		ID    string `xml:"id,attr"`
+		Name  string `xml:"name"`
+		Progs []struct {
+			Date  string `xml:"date"`
+			Progs []struct {
+				ID    string `xml:"id,attr"`
+				Ft    string `xml:"ft,attr"`
+				To    string `xml:"to,attr"`
+				Title string `xml:"title"`
+				URL   string `xml:"url"`
+				Desc  string `xml:"desc"`
+				Info  string `xml:"info"`
+				Pfm   string `xml:"pfm"`
+				Img   string `xml:"img"`
+			} `xml:"prog"`
+		} `xml:"progs"`
+	} `xml:"stations>station"`
+}
+
+// JST は日本時間のタイムゾーンを返す。録音や番組表を扱う他のパッケージもこれを使う
+func JST() *time.Location {
+	return jstLocation()
+}
+
+// jstLocation は日本時間のタイムゾーンを返す
+func jstLocation() *time.Location {
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return jst
+}
+
+// GetWeeklyPrograms は局の週間番組表を取得
+func (c *Client) GetWeeklyPrograms(stationID string) ([]Program, error) {
+	return c.GetWeeklyProgramsContext(context.Background(), stationID)
+}
+
+// GetWeeklyProgramsContext はコンテキスト付きで局の週間番組表を取得
+func (c *Client) GetWeeklyProgramsContext(ctx context.Context, stationID string) ([]Program, error) {
+	url := c.apiURL(fmt.Sprintf("/v3/program/station/weekly/%s.xml", stationID))
+	return c.fetchPrograms(ctx, url)
+}
+
+// GetDailyPrograms は局の指定日の番組表を取得
+func (c *Client) GetDailyPrograms(stationID string, date time.Time) ([]Program, error) {
+	return c.GetDailyProgramsContext(context.Background(), stationID, date)
+}
+
+// GetDailyProgramsContext はコンテキスト付きで局の指定日の番組表を取得
+func (c *Client) GetDailyProgramsContext(ctx context.Context, stationID string, date time.Time) ([]Program, error) {
+	day := date.In(jstLocation()).Format("20060102")
+	url := c.apiURL(fmt.Sprintf("/v3/program/station/date/%s/%s.xml", day, stationID))
+	return c.fetchPrograms(ctx, url)
+}
+
+// fetchPrograms は番組表XMLを取得して解析
+func (c *Client) fetchPrograms(ctx context.Context, url string) ([]Program, error) {
+	c.logger.Debug("番組表取得: %s", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("番組表リクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("番組表リクエストエラー: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("番組表取得失敗: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("番組表読み取りエラー: %w", err)
+	}
+
+	programs, err := parsePrograms(data)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Debug("番組表取得完了: %d番組", len(programs))
+	return programs, nil
+}
+
+// parsePrograms は番組表XMLを解析して開始時刻順の番組一覧を返す
+func parsePrograms(data []byte) ([]Program, error) {
+	var doc programXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("番組表解析エラー: %w", err)
+	}
+
+	jst := jstLocation()
+	var programs []Program
+	for _, st := range doc.Stations {
+		for _, day := range st.Progs {
+			for _, p := range day.Progs {
+				start, err := time.ParseInLocation(programTimeLayout, p.Ft, jst)
+				if err != nil {
+					return nil, fmt.Errorf("番組開始時刻の解析エラー: %w", err)
+				}
+				end, err := time.ParseInLocation(programTimeLayout, p.To, jst)
+				if err != nil {
+					return nil, fmt.Errorf("番組終了時刻の解析エラー: %w", err)
+				}
+				programs = append(programs, Program{
+					ID:          p.ID,
+					StationID:   st.ID,
+					Title:       strings.TrimSpace(p.Title),
+					Performers:  strings.TrimSpace(p.Pfm),
+					Start:       start,
+					End:         end,
+					Description: strings.TrimSpace(p.Desc),
+					Info:        strings.TrimSpace(p.Info),
+					URL:         strings.TrimSpace(p.URL),
+					Image:       strings.TrimSpace(p.Img),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(programs, func(i, j int) bool {
+		return programs[i].Start.Before(programs[j].Start)
+	})
+	return programs, nil
+}
+
+// ProgramFilter は番組検索の条件
+type ProgramFilter struct {
+	// Title は番組名に含まれる文字列
+	Title string
+	// Keyword は番組名・出演者・説明のいずれかに含まれる文字列
+	Keyword string
+}
+
+// IsEmpty は検索条件が指定されていないかを返す
+func (f ProgramFilter) IsEmpty() bool {
+	return f.Title == "" && f.Keyword == ""
+}
+
+// Match は番組が検索条件に一致するかを返す（大文字小文字は区別しない）
+func (f ProgramFilter) Match(p Program) bool {
+	if f.Title != "" && !containsFold(p.Title, f.Title) {
+		return false
+	}
+	if f.Keyword != "" {
+		fields := []string{p.Title, p.Performers, p.Description, p.Info}
+		found := false
+		for _, field := range fields {
+			if containsFold(field, f.Keyword) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold は大文字小文字を区別せずに部分一致を判定
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// FilterPrograms は検索条件に一致する番組を返す
+func FilterPrograms(programs []Program, filter ProgramFilter) []Program {
+	var matched []Program
+	for _, p := range programs {
+		if filter.Match(p) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// TimeFreeAvailable は番組が放送済みかつタイムフリーの利用可能期間内かを返す
+func (p Program) TimeFreeAvailable(now time.Time) bool {
+	weekAgo := now.AddDate(0, 0, -7)
+	return !p.Start.Before(weekAgo) && !p.End.After(now)
+}
+
+// FindTimeFreePrograms は週間番組表から検索条件に一致し、
+// タイムフリーで録音可能な番組を開始時刻順に返す
+func (c *Client) FindTimeFreePrograms(stationID string, filter ProgramFilter, now time.Time) ([]Program, error) {
+	return c.FindTimeFreeProgramsContext(context.Background(), stationID, filter, now)
+}
+
+// FindTimeFreeProgramsContext はコンテキスト付きでFindTimeFreeProgramsを実行
+func (c *Client) FindTimeFreeProgramsContext(ctx context.Context, stationID string, filter ProgramFilter, now time.Time) ([]Program, error) {
+	programs, err := c.GetWeeklyProgramsContext(ctx, stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []Program
+	for _, p := range FilterPrograms(programs, filter) {
+		if p.TimeFreeAvailable(now) {
+			available = append(available, p)
+		}
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("タイムフリーで録音可能な番組が見つかりません: 局=%s, 番組名=%q, キーワード=%q", stationID, filter.Title, filter.Keyword)
+	}
+	return available, nil
+}
+
+// FindLatestProgram は検索条件に一致する直近の放送済み番組を返す
+func (c *Client) FindLatestProgram(stationID string, filter ProgramFilter, now time.Time) (Program, error) {
+	return c.FindLatestProgramContext(context.Background(), stationID, filter, now)
+}
+
+// FindLatestProgramContext はコンテキスト付きでFindLatestProgramを実行
+func (c *Client) FindLatestProgramContext(ctx context.Context, stationID string, filter ProgramFilter, now time.Time) (Program, error) {
+	programs, err := c.FindTimeFreeProgramsContext(ctx, stationID, filter, now)
+	if err != nil {
+		return Program{}, err
+	}
+	return programs[len(programs)-1], nil
+}
@@ -0,0 +1,153 @@
+package radiko
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newProgramServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/program/station/weekly/TBS.xml":
+			http.ServeFile(w, r, "testdata/weekly_TBS.xml")
+		case "/v3/program/station/date/20240607/TBS.xml":
+			http.ServeFile(w, r, "testdata/date_20240607_TBS.xml")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+}
+
+func TestGetWeeklyPrograms(t *testing.T) {
+	server := newProgramServer(t)
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	programs, err := c.GetWeeklyPrograms("TBS")
+	if err != nil {
+		t.Fatalf("GetWeeklyPrograms error: %v", err)
+	}
+	if len(programs) != 3 {
+		t.Fatalf("expected 3 programs, got %d", len(programs))
+	}
+
+	// 日付をまたいで開始時刻順に並んでいること
+	if programs[0].ID != "10000" || programs[1].ID != "10001" || programs[2].ID != "10002" {
+		t.Errorf("programs not sorted by start: %v, %v, %v", programs[0].ID, programs[1].ID, programs[2].ID)
+	}
+
+	p := programs[1]
+	jst := jstLocation()
+	if p.StationID != "TBS" {
+		t.Errorf("unexpected station: %s", p.StationID)
+	}
+	if p.Title != "アフター6ジャンクション2" {
+		t.Errorf("unexpected title: %s", p.Title)
+	}
+	if p.Performers != "宇多丸、宇垣美里" {
+		t.Errorf("unexpected performers: %s", p.Performers)
+	}
+	if !p.Start.Equal(time.Date(2024, 6, 7, 20, 0, 0, 0, jst)) {
+		t.Errorf("unexpected start: %v", p.Start)
+	}
+	if !p.End.Equal(time.Date(2024, 6, 7, 21, 30, 0, 0, jst)) {
+		t.Errorf("unexpected end: %v", p.End)
+	}
+	if p.Duration() != 90 {
+		t.Errorf("expected duration 90, got %d", p.Duration())
+	}
+	if p.Description != "カルチャーキュレーション番組" || p.Info != "<p>番組情報</p>" {
+		t.Errorf("unexpected description/info: %q %q", p.Description, p.Info)
+	}
+	if p.URL != "https://www.tbsradio.jp/a6j/" || p.Image == "" {
+		t.Errorf("unexpected url/image: %q %q", p.URL, p.Image)
+	}
+}
+
+func TestGetDailyPrograms(t *testing.T) {
+	server := newProgramServer(t)
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	programs, err := c.GetDailyPrograms("TBS", time.Date(2024, 6, 7, 12, 0, 0, 0, jstLocation()))
+	if err != nil {
+		t.Fatalf("GetDailyPrograms error: %v", err)
+	}
+	if len(programs) != 1 || programs[0].ID != "10001" {
+		t.Errorf("unexpected programs: %+v", programs)
+	}
+
+	if _, err := c.GetWeeklyPrograms("XXX"); err == nil {
+		t.Errorf("expected error for unknown station")
+	}
+}
+
+func TestProgramFilter(t *testing.T) {
+	p := Program{Title: "JUNK 爆笑問題カーボーイ", Performers: "爆笑問題", Description: "深夜の生放送"}
+
+	tests := []struct {
+		filter ProgramFilter
+		want   bool
+	}{
+		{ProgramFilter{Title: "junk"}, true},
+		{ProgramFilter{Title: "爆笑問題"}, true},
+		{ProgramFilter{Title: "深夜"}, false},
+		{ProgramFilter{Keyword: "深夜"}, true},
+		{ProgramFilter{Title: "JUNK", Keyword: "生放送"}, true},
+		{ProgramFilter{Title: "JUNK", Keyword: "再放送"}, false},
+		{ProgramFilter{}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(p); got != tt.want {
+			t.Errorf("Match(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFindTimeFreePrograms(t *testing.T) {
+	server := newProgramServer(t)
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	jst := jstLocation()
+
+	// JUNKの放送中はまだタイムフリーで録音できない
+	now := time.Date(2024, 6, 8, 2, 0, 0, 0, jst)
+	programs, err := c.FindTimeFreePrograms("TBS", ProgramFilter{Keyword: "TBSラジオ"}, now)
+	if err == nil {
+		t.Errorf("expected error for unmatched keyword, got %+v", programs)
+	}
+	if _, err := c.FindLatestProgram("TBS", ProgramFilter{Title: "JUNK"}, now); err == nil {
+		t.Errorf("expected error for program still on air")
+	}
+
+	latest, err := c.FindLatestProgram("TBS", ProgramFilter{}, now)
+	if err != nil {
+		t.Fatalf("FindLatestProgram error: %v", err)
+	}
+	if latest.ID != "10001" {
+		t.Errorf("expected latest finished program 10001, got %s", latest.ID)
+	}
+
+	// 1週間を過ぎた番組は対象外
+	now = time.Date(2024, 6, 13, 23, 0, 0, 0, jst)
+	programs, err = c.FindTimeFreePrograms("TBS", ProgramFilter{}, now)
+	if err != nil {
+		t.Fatalf("FindTimeFreePrograms error: %v", err)
+	}
+	if len(programs) != 2 || programs[0].ID != "10001" {
+		t.Errorf("unexpected programs in timefree window: %+v", programs)
+	}
+}
+
+func TestProgramBroadcastID(t *testing.T) {
+	// 日本時間以外の時刻でも日本時間の日時にする
+	start := time.Date(2024, 6, 7, 16, 0, 0, 0, time.UTC)
+	p := Program{StationID: "TBS", Start: start, End: start.Add(2 * time.Hour)}
+	if id := p.BroadcastID(); id != "TBS_20240608010000_20240608030000" {
+		t.Errorf("BroadcastID() = %s", id)
+	}
+}
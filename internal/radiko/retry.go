@@ -0,0 +1,186 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy はセグメントダウンロードのリトライ設定
+type RetryPolicy struct {
+	// MaxRetries は1セグメントあたりの最大リトライ回数
+	MaxRetries int
+	// BaseDelay は初回リトライまでの待ち時間（リトライごとに倍になる）
+	BaseDelay time.Duration
+	// MaxDelay は待ち時間の上限
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy はデフォルトのリトライ設定を返す
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   10 * time.Second,
+	}
+}
+
+// backoff はattempt回目（0始まり）のリトライまでの待ち時間を返す。
+// 指数バックオフの値の半分から全体までの範囲でジッターをかける
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int64N(int64(d-half)+1))
+}
+
+// StatusError はHTTPステータスが200以外だったことを表す
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Op は失敗した処理（空ならセグメントのダウンロード）
+	Op string
+}
+
+func (e *StatusError) Error() string {
+	op := e.Op
+	if op == "" {
+		op = "セグメントダウンロード"
+	}
+	return fmt.Sprintf("%s失敗: %s", op, e.Status)
+}
+
+// SegmentError は失敗セグメント数が許容数を超えて録音を中断したことを表す
+type SegmentError struct {
+	// Failed は失敗したセグメントの番号（0始まり、プレイリスト順）
+	Failed []int
+	// Total はプレイリストのセグメント総数
+	Total int
+	// Err は最後に発生したエラー
+	Err error
+}
+
+func (e *SegmentError) Error() string {
+	indexes := make([]string, len(e.Failed))
+	for i, n := range e.Failed {
+		indexes[i] = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("セグメントのダウンロードに失敗: %d/%dセグメント (番号: %s): %v",
+		len(e.Failed), e.Total, strings.Join(indexes, ", "), e.Err)
+}
+
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
+
+// reauthError は録音中の再認証に失敗したことを表す。
+// 以降のセグメントも取得できないため、失敗許容数に関係なく録音を中断する
+type reauthError struct {
+	err error
+}
+
+func (e *reauthError) Error() string {
+	return fmt.Sprintf("再認証に失敗: %v", e.err)
+}
+
+func (e *reauthError) Unwrap() error {
+	return e.err
+}
+
+// isTransient は再試行で回復する可能性のあるエラーかを返す
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// isAuthExpired は認証トークンの期限切れを示すエラーかを返す
+func isAuthExpired(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden)
+}
+
+// fetchSegmentWithRetry はセグメントをダウンロードし、一時的なエラーは指数バックオフで再試行する。
+// 401/403が返った場合はトークンの期限切れとみなして再認証してから再試行する
+func (c *Client) fetchSegmentWithRetry(ctx context.Context, index int, segURL string) ([]byte, error) {
+	reauthed := false
+	var lastErr error
+	for attempt := 0; attempt <= c.retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.retry.backoff(attempt - 1)
+			c.logger.Debug("セグメント%dを再試行 (%d/%d, %s後): %v", index, attempt, c.retry.MaxRetries, delay, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		usedToken := c.token()
+		var buf bytes.Buffer
+		err := c.copySegment(ctx, segURL, &buf)
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if isAuthExpired(err) && !reauthed {
+			reauthed = true
+			if err := c.reauth(ctx, usedToken); err != nil {
+				return nil, &reauthError{err: err}
+			}
+			continue
+		}
+		if !isTransient(err) {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// reauth は認証トークンを取り直す。
+// 並列ダウンロード中の複数のセグメントが同時に期限切れを検知しても再認証は1回で済ませる
+func (c *Client) reauth(ctx context.Context, usedToken string) error {
+	c.reauthMu.Lock()
+	defer c.reauthMu.Unlock()
+
+	if c.token() != usedToken {
+		// 他のセグメントがすでに再認証済み
+		return nil
+	}
+	c.logger.Info("認証トークンの期限切れを検知したため再認証します")
+	return c.authenticate(ctx)
+}
@@ -0,0 +1,187 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 20; i++ {
+			d := p.backoff(attempt)
+			if d < want/2 || d > want {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, d, want/2, want)
+			}
+		}
+	}
+	if d := (RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("expected zero delay for zero policy, got %s", d)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{StatusCode: 500, Status: "500 Internal Server Error"}, true},
+		{&StatusError{StatusCode: 503, Status: "503 Service Unavailable"}, true},
+		{&StatusError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{&StatusError{StatusCode: 404, Status: "404 Not Found"}, false},
+		{fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF), true},
+		{context.Canceled, false},
+		{errors.New("other"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func newRetryTestClient(server *fakeRadiko) *Client {
+	return &Client{
+		authToken:   "token1",
+		baseURL:     server.URL,
+		httpClient:  server.Client(),
+		logger:      NewLogger(false),
+		concurrency: 2,
+		retry:       RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+	}
+}
+
+func TestDownloadSegmentsRetry(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	server := newFakeRadiko(t)
+	server.Status = func(r *http.Request) int {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[r.URL.Path]++
+		// seg1は2回失敗してから成功する
+		if r.URL.Path == "/seg1" && attempts[r.URL.Path] <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}
+
+	c := newRetryTestClient(server)
+	segments := []string{server.URL + "/seg0", server.URL + "/seg1", server.URL + "/seg2"}
+	var out bytes.Buffer
+	if err := c.downloadSegments(context.Background(), segments, 0, &out, nil); err != nil {
+		t.Fatalf("downloadSegments error: %v", err)
+	}
+	if out.String() != "/seg0/seg1/seg2" {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	if attempts["/seg1"] != 3 {
+		t.Errorf("expected 3 attempts for seg1, got %d", attempts["/seg1"])
+	}
+}
+
+func TestDownloadSegmentsFailureBudget(t *testing.T) {
+	server := newFakeRadiko(t)
+	server.Status = func(r *http.Request) int {
+		switch r.URL.Path {
+		case "/seg1", "/seg3":
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}
+
+	var segments []string
+	for i := 0; i < 5; i++ {
+		segments = append(segments, fmt.Sprintf("%s/seg%d", server.URL, i))
+	}
+
+	// 失敗許容数内ならスキップして続行
+	c := newRetryTestClient(server)
+	c.failureBudget = 2
+	var out bytes.Buffer
+	if err := c.downloadSegments(context.Background(), segments, 0, &out, nil); err != nil {
+		t.Fatalf("expected failures within budget to be skipped, got: %v", err)
+	}
+	if out.String() != "/seg0/seg2/seg4" {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+
+	// 許容数を超えたら失敗したセグメント番号を含むエラーを返す
+	c.failureBudget = 1
+	out.Reset()
+	err := c.downloadSegments(context.Background(), segments, 0, &out, nil)
+	var segErr *SegmentError
+	if !errors.As(err, &segErr) {
+		t.Fatalf("expected *SegmentError, got %v", err)
+	}
+	if !reflect.DeepEqual(segErr.Failed, []int{1, 3}) || segErr.Total != 5 {
+		t.Errorf("unexpected SegmentError: %+v", segErr)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+		t.Errorf("expected wrapped StatusError, got %v", err)
+	}
+}
+
+func TestDownloadSegmentsReauth(t *testing.T) {
+	server := newFakeRadiko(t)
+	server.IssueToken = func(int) string { return "token2" }
+	// token1は期限切れ
+	server.Status = rejectTokens("token1")
+
+	c := newRetryTestClient(server)
+	var segments []string
+	for i := 0; i < 4; i++ {
+		segments = append(segments, fmt.Sprintf("%s/seg%d", server.URL, i))
+	}
+	var out bytes.Buffer
+	if err := c.downloadSegments(context.Background(), segments, 0, &out, nil); err != nil {
+		t.Fatalf("downloadSegments error: %v", err)
+	}
+	if out.String() != "/seg0/seg1/seg2/seg3" {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+	if server.Auths() != 1 {
+		t.Errorf("expected a single re-authentication, got %d", server.Auths())
+	}
+	if c.AreaID() != "JP13" {
+		t.Errorf("expected area to be refreshed, got %s", c.AreaID())
+	}
+}
+
+func TestDownloadSegmentsReauth_ConcurrentAreaID(t *testing.T) {
+	server := newFakeRadiko(t)
+	server.Area = "JP27"
+	server.Status = rejectTokens("token1")
+
+	// 並列ダウンロード中の再認証と並行してエリアIDを読んでも競合しない（go test -race で確認する）
+	c := newRetryTestClient(server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var out bytes.Buffer
+		segments := []string{server.URL + "/seg0", server.URL + "/seg1", server.URL + "/seg2", server.URL + "/seg3"}
+		if err := c.downloadSegments(context.Background(), segments, 0, &out, nil); err != nil {
+			t.Errorf("downloadSegments error: %v", err)
+		}
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+			c.AreaID()
+		}
+	}
+	if c.AreaID() != "JP27" {
+		t.Errorf("expected area to be refreshed, got %s", c.AreaID())
+	}
+}
@@ -0,0 +1,178 @@
+package radiko
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRadiko はradikoのAPIの代わりになるテスト用サーバー。
+// 認証（auth1/auth2）、プレミアムのログイン、タイムフリーのプレイリストとセグメントに応答する。
+// テストごとの違いはフィールドのフックで指定する
+type fakeRadiko struct {
+	*httptest.Server
+
+	// Area はauth2が返すエリアID（空ならJP13）。プレミアムのセッションを渡すとJP27を返す
+	Area string
+	// IssueToken はn回目の認証でauth1が発行するトークンを返す（nilなら "fresh-token-n"）
+	IssueToken func(n int) string
+	// Status はプレイリストとセグメントへのリクエストに返すステータスコードを決める。
+	// nilか0、200を返した場合は通常どおり応答する
+	Status func(r *http.Request) int
+	// Handler は認証以外のリクエストに応答する。nilならタイムフリーのプレイリストとセグメントを返す
+	Handler http.Handler
+
+	mu      sync.Mutex
+	auths   int
+	logins  int
+	logouts int
+	issued  string
+	headers map[string]http.Header
+}
+
+// newFakeRadiko はテスト用のradikoサーバーを起動する。テストの終了時に止める
+func newFakeRadiko(t *testing.T) *fakeRadiko {
+	t.Helper()
+	s := &fakeRadiko{headers: map[string]http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client はこのサーバーに接続するクライアントを作成してcfgを反映する
+func (s *fakeRadiko) client(cfg *Config) *Client {
+	c := NewClient()
+	c.baseURL = s.URL
+	c.httpClient = s.Client()
+	c.ApplyConfig(cfg)
+	return c
+}
+
+// Header はpathへの最後のリクエストのヘッダーを返す
+func (s *fakeRadiko) Header(path string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[path]
+}
+
+// Auths, Logins, Logouts はそれぞれauth1、ログイン、ログアウトのリクエスト数を返す
+func (s *fakeRadiko) Auths() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auths
+}
+
+func (s *fakeRadiko) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *fakeRadiko) Logouts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logouts
+}
+
+// ChunklistURL はタイムフリーのプレイリストが返すチャンクリストのURL。
+// クライアントはhttpsのURLだけをストリームとして扱うため、スキームを書き換える
+func (s *fakeRadiko) ChunklistURL() string {
+	return strings.Replace(s.URL, "http://", "https://", 1) + "/chunklist.m3u8"
+}
+
+func (s *fakeRadiko) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mu.Lock()
+	s.headers[r.URL.Path] = r.Header.Clone()
+	s.mu.Unlock()
+
+	cookie, _ := r.Cookie(sessionCookie)
+	switch r.URL.Path {
+	case "/v2/api/auth1":
+		s.mu.Lock()
+		s.auths++
+		token := fmt.Sprintf("fresh-token-%d", s.auths)
+		if s.IssueToken != nil {
+			token = s.IssueToken(s.auths)
+		}
+		s.issued = token
+		s.mu.Unlock()
+		w.Header().Set("X-Radiko-Authtoken", token)
+		w.Header().Set("X-Radiko-KeyLength", "4")
+		w.Header().Set("X-Radiko-KeyOffset", "2")
+	case "/v2/api/auth2":
+		// auth1で発行したトークンでなければ受け付けない
+		s.mu.Lock()
+		issued := s.issued
+		s.mu.Unlock()
+		if r.Header.Get("X-Radiko-AuthToken") != issued {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get(sessionCookie) == testSession {
+			fmt.Fprint(w, "JP27,大阪府,OSAKA JAPAN")
+			return
+		}
+		area := s.Area
+		if area == "" {
+			area = "JP13"
+		}
+		fmt.Fprintf(w, "%s,area,area\n", area)
+	case "/v4/api/member/login":
+		s.mu.Lock()
+		s.logins++
+		s.mu.Unlock()
+		if r.PostForm.Get("mail") != testEmail || r.PostForm.Get("pass") != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"radiko_session": %q, "areafree": "1"}`, testSession)
+	case "/v4/api/member/logout":
+		s.mu.Lock()
+		s.logouts++
+		s.mu.Unlock()
+		if r.PostForm.Get(sessionCookie) != testSession {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	case "/ap/member/webapi/member/login/check":
+		if cookie == nil || cookie.Value != testSession {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	default:
+		if s.Status != nil {
+			if code := s.Status(r); code != 0 && code != http.StatusOK {
+				w.WriteHeader(code)
+				return
+			}
+		}
+		if s.Handler != nil {
+			s.Handler.ServeHTTP(w, r)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/api/ts/playlist.m3u8":
+			fmt.Fprintf(w, "#EXTM3U\n%s\n", s.ChunklistURL())
+		case r.URL.Path == "/chunklist.m3u8":
+			fmt.Fprint(w, "#EXTM3U\nseg1.aac\nseg2.aac\n")
+		case strings.HasPrefix(r.URL.Path, "/seg"):
+			fmt.Fprint(w, r.URL.Path)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// rejectTokens はtokensの認証トークンを期限切れとみなして401を返すStatusフック
+func rejectTokens(tokens ...string) func(r *http.Request) int {
+	return func(r *http.Request) int {
+		for _, token := range tokens {
+			if r.Header.Get("X-Radiko-AuthToken") == token {
+				return http.StatusUnauthorized
+			}
+		}
+		return http.StatusOK
+	}
+}
@@ -0,0 +1,300 @@
+package radiko
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// stationCacheTTL は局一覧キャッシュの有効期間
+const stationCacheTTL = 24 * time.Hour
+
+// Station はradikoの放送局情報
+type Station struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AsciiName string `json:"ascii_name"`
+	AreaFree  bool   `json:"areafree"`
+	TimeFree  bool   `json:"timefree"`
+	Href      string `json:"href"`
+}
+
+// stationListXML は局一覧XMLのルート要素
+type stationListXML struct {
+	AreaID   string `xml:"area_id,attr"`
+	AreaName string `xml:"area_name,attr"`
+	Stations []struct {
+		ID        string `xml:"id"`
+		Name      string `xml:"name"`
+		AsciiName string `xml:"ascii_name"`
+		AreaFree  int    `xml:"areafree"`
+		TimeFree  int    `xml:"timefree"`
+		Href      string `xml:"href"`
+	} `xml:"station"`
+}
+
+// stationCache はディスクに保存する局一覧キャッシュ
+type stationCache struct {
+	AreaID    string    `json:"area_id"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Stations  []Station `json:"stations"`
+}
+
+// AreaID は認証で取得したエリアIDを返す
+func (c *Client) AreaID() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.areaID
+}
+
+// FetchStations は指定エリアの局一覧をradikoから取得
+func (c *Client) FetchStations(areaID string) ([]Station, error) {
+	return c.FetchStationsContext(context.Background(), areaID)
+}
+
+// FetchStationsContext はコンテキスト付きで指定エリアの局一覧を取得
+func (c *Client) FetchStationsContext(ctx context.Context, areaID string) ([]Station, error) {
+	url := c.apiURL(fmt.Sprintf("/v3/station/list/%s.xml", areaID))
+	c.logger.Debug("局一覧取得: %s", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("局一覧リクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("局一覧リクエストエラー: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("局一覧取得失敗: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("局一覧読み取りエラー: %w", err)
+	}
+
+	var doc stationListXML
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("局一覧解析エラー: %w", err)
+	}
+
+	stations := make([]Station, 0, len(doc.Stations))
+	for _, s := range doc.Stations {
+		stations = append(stations, Station{
+			ID:        s.ID,
+			Name:      s.Name,
+			AsciiName: s.AsciiName,
+			AreaFree:  s.AreaFree == 1,
+			TimeFree:  s.TimeFree == 1,
+			Href:      s.Href,
+		})
+	}
+	c.logger.Debug("局一覧取得完了: エリア=%s, %d局", areaID, len(stations))
+	return stations, nil
+}
+
+// ListStations は認証済みエリアの局一覧を返す。
+// cacheDirが指定されている場合は取得結果をディスクにキャッシュし、
+// 取得に失敗したときは期限切れのキャッシュも利用する
+func (c *Client) ListStations(cacheDir string) ([]Station, error) {
+	return c.ListStationsContext(context.Background(), cacheDir)
+}
+
+// ListStationsContext はコンテキスト付きで認証済みエリアの局一覧を返す
+func (c *Client) ListStationsContext(ctx context.Context, cacheDir string) ([]Station, error) {
+	areaID := c.AreaID()
+	if areaID == "" {
+		return nil, fmt.Errorf("エリアIDが不明です。先にAuth()を実行してください")
+	}
+
+	var cached *stationCache
+	cachePath := ""
+	if cacheDir != "" {
+		cachePath = filepath.Join(cacheDir, fmt.Sprintf("stations_%s.json", areaID))
+		cached = loadStationCache(cachePath)
+		if cached != nil && time.Since(cached.FetchedAt) < stationCacheTTL {
+			c.logger.Debug("局一覧キャッシュを使用: %s", cachePath)
+			return cached.Stations, nil
+		}
+	}
+
+	stations, err := c.FetchStationsContext(ctx, areaID)
+	if err != nil {
+		if cached != nil {
+			c.logger.Error("局一覧の取得に失敗したため古いキャッシュを使用: %v", err)
+			return cached.Stations, nil
+		}
+		return nil, err
+	}
+
+	if cachePath != "" {
+		if err := saveStationCache(cachePath, &stationCache{AreaID: areaID, FetchedAt: time.Now(), Stations: stations}); err != nil {
+			c.logger.Error("局一覧キャッシュの保存に失敗: %v", err)
+		}
+	}
+	return stations, nil
+}
+
+// StationNames は局IDと局名の対応表を返す
+func StationNames(stations []Station) map[string]string {
+	names := make(map[string]string, len(stations))
+	for _, s := range stations {
+		names[s.ID] = s.Name
+	}
+	return names
+}
+
+// loadStationCache は局一覧キャッシュを読み込む（存在しない・壊れている場合はnil）
+func loadStationCache(path string) *stationCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache stationCache
+	if err := json.Unmarshal(data, &cache); err != nil || len(cache.Stations) == 0 {
+		return nil
+	}
+	return &cache
+}
+
+// saveStationCache は局一覧キャッシュを保存
+func saveStationCache(path string, cache *stationCache) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ErrStationNotInArea は局が認証したエリアで配信されていないことを表す。
+// 詳しい情報は errors.As で *StationAreaError として取り出せる
+var ErrStationNotInArea = errors.New("局が現在のエリアで配信されていません")
+
+// StationAreaError は局が認証したエリアで配信されていないため録音できないことを表す
+type StationAreaError struct {
+	StationID string
+	// AreaID は認証で判定されたエリア
+	AreaID string
+	// Areas はその局を録音できるエリア
+	Areas []string
+}
+
+func (e *StationAreaError) Error() string {
+	return fmt.Sprintf("%s は現在のエリア %s では録音できません（録音できるエリア: %s）",
+		e.StationID, areaLabel(e.AreaID), strings.Join(areaLabels(e.Areas), ", "))
+}
+
+// Is は errors.Is(err, ErrStationNotInArea) で判定できるようにする
+func (e *StationAreaError) Is(target error) bool {
+	return target == ErrStationNotInArea
+}
+
+// areaLabel はエリアIDに都道府県名を添えた表示を返す
+func areaLabel(id string) string {
+	if a, err := LookupArea(id); err == nil {
+		return a.ID + " " + a.Name
+	}
+	return id
+}
+
+func areaLabels(ids []string) []string {
+	labels := make([]string, len(ids))
+	for i, id := range ids {
+		labels[i] = areaLabel(id)
+	}
+	return labels
+}
+
+// regionXML は全エリアの局一覧（/v3/station/region/full.xml）のルート要素
+type regionXML struct {
+	Stations []struct {
+		Station []struct {
+			ID     string `xml:"id"`
+			AreaID string `xml:"area_id"`
+		} `xml:"station"`
+	} `xml:"stations"`
+}
+
+// FetchStationAreasContext は局を配信しているエリアの一覧を全エリアの局一覧から取得する
+func (c *Client) FetchStationAreasContext(ctx context.Context, stationID string) ([]string, error) {
+	url := c.apiURL("/v3/station/region/full.xml")
+	c.logger.Debug("全エリアの局一覧取得: %s", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("全エリアの局一覧リクエスト作成エラー: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("全エリアの局一覧リクエストエラー: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("全エリアの局一覧取得失敗: HTTP %d", resp.StatusCode)
+	}
+
+	var doc regionXML
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("全エリアの局一覧解析エラー: %w", err)
+	}
+
+	var areas []string
+	for _, region := range doc.Stations {
+		for _, s := range region.Station {
+			if s.ID == stationID && s.AreaID != "" && !slices.Contains(areas, s.AreaID) {
+				areas = append(areas, s.AreaID)
+			}
+		}
+	}
+	return areas, nil
+}
+
+// CheckStationAreaContext は認証したエリアで局を録音できるかを録音の前に確認する。
+// 録音できない場合は局を配信しているエリアを添えた *StationAreaError を返す。
+// プレミアムにログインしている場合（エリアフリー）や、局一覧を取得できずに判断できない場合は確認しない
+func (c *Client) CheckStationAreaContext(ctx context.Context, stationID string) error {
+	areaID := c.AreaID()
+	if areaID == "" || c.Session() != "" {
+		return nil
+	}
+	stations, err := c.ListStationsContext(ctx, c.cacheDir)
+	if err != nil {
+		c.logger.Debug("局一覧を取得できないためエリアの確認を省略します: %v", err)
+		return nil
+	}
+	for _, s := range stations {
+		if s.ID == stationID {
+			return nil
+		}
+	}
+
+	areas, err := c.FetchStationAreasContext(ctx, stationID)
+	if err != nil {
+		c.logger.Debug("局のエリアを取得できないためエリアの確認を省略します: %v", err)
+		return nil
+	}
+	if len(areas) == 0 {
+		return fmt.Errorf("不明な局IDです: %s", stationID)
+	}
+	return &StationAreaError{StationID: stationID, AreaID: areaID, Areas: areas}
+}
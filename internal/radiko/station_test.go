@@ -0,0 +1,139 @@
+package radiko
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchStations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3/station/list/JP27.xml" {
+			http.ServeFile(w, r, "testdata/station_list_JP27.xml")
+			return
+		}
+		w.WriteHeader(404)
+	}))
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	stations, err := c.FetchStations("JP27")
+	if err != nil {
+		t.Fatalf("FetchStations error: %v", err)
+	}
+	if len(stations) != 3 {
+		t.Fatalf("expected 3 stations, got %d", len(stations))
+	}
+	if stations[0].ID != "ABC" || stations[0].Name != "ABCラジオ" || !stations[0].AreaFree || !stations[0].TimeFree {
+		t.Errorf("unexpected first station: %+v", stations[0])
+	}
+	if stations[2].AreaFree {
+		t.Errorf("expected OBC to be not areafree")
+	}
+	names := StationNames(stations)
+	if names["MBS"] != "MBSラジオ" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestListStationsCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeFile(w, r, "testdata/station_list_JP27.xml")
+	}))
+
+	cacheDir := t.TempDir()
+	c := &Client{areaID: "JP27", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	if _, err := c.ListStations(cacheDir); err != nil {
+		t.Fatalf("ListStations error: %v", err)
+	}
+	if _, err := c.ListStations(cacheDir); err != nil {
+		t.Fatalf("ListStations error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected cached result on second call, got %d requests", requests)
+	}
+
+	// 期限切れキャッシュはサーバー停止時のフォールバックとして使われる
+	path := filepath.Join(cacheDir, "stations_JP27.json")
+	cache := loadStationCache(path)
+	if cache == nil {
+		t.Fatalf("cache file not written")
+	}
+	cache.FetchedAt = time.Now().Add(-2 * stationCacheTTL)
+	if err := saveStationCache(path, cache); err != nil {
+		t.Fatalf("saveStationCache error: %v", err)
+	}
+	server.Close()
+
+	stations, err := c.ListStations(cacheDir)
+	if err != nil {
+		t.Fatalf("expected stale cache fallback, got error: %v", err)
+	}
+	if len(stations) != 3 {
+		t.Errorf("expected 3 cached stations, got %d", len(stations))
+	}
+
+	if _, err := (&Client{logger: NewLogger(false)}).ListStations(cacheDir); err == nil {
+		t.Errorf("expected error without area ID")
+	}
+}
+
+func TestCheckStationArea(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/station/list/JP27.xml":
+			http.ServeFile(w, r, "testdata/station_list_JP27.xml")
+		case "/v3/station/region/full.xml":
+			http.ServeFile(w, r, "testdata/station_region_full.xml")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := &Client{areaID: "JP27", baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	if err := c.CheckStationAreaContext(ctx, "ABC"); err != nil {
+		t.Errorf("ABC should be available in JP27: %v", err)
+	}
+
+	err := c.CheckStationAreaContext(ctx, "TBS")
+	var areaErr *StationAreaError
+	if !errors.Is(err, ErrStationNotInArea) || !errors.As(err, &areaErr) {
+		t.Fatalf("expected ErrStationNotInArea, got %v", err)
+	}
+	if areaErr.AreaID != "JP27" || len(areaErr.Areas) != 1 || areaErr.Areas[0] != "JP13" {
+		t.Errorf("unexpected error: %+v", areaErr)
+	}
+	if !strings.Contains(err.Error(), "JP27 大阪府") || !strings.Contains(err.Error(), "JP13 東京都") {
+		t.Errorf("error should name the areas: %v", err)
+	}
+
+	if err := c.CheckStationAreaContext(ctx, "XXX"); err == nil || errors.Is(err, ErrStationNotInArea) {
+		t.Errorf("expected unknown station error, got %v", err)
+	}
+
+	// 録音の前に確認し、プレイリストを取得しない
+	c.authToken = "token-0123456789"
+	if err := c.RecordTimeFreeContext(ctx, "TBS", time.Now().Add(-time.Hour), 30, filepath.Join(t.TempDir(), "out.aac")); !errors.Is(err, ErrStationNotInArea) {
+		t.Errorf("RecordTimeFree should fail before downloading, got %v", err)
+	}
+
+	// プレミアム（エリアフリー）や局一覧を取得できない場合は確認しない
+	c.session = "session"
+	if err := c.CheckStationAreaContext(ctx, "TBS"); err != nil {
+		t.Errorf("premium session should skip the check: %v", err)
+	}
+	c.session = ""
+	c.areaID = "JP13"
+	if err := c.CheckStationAreaContext(ctx, "TBS"); err != nil {
+		t.Errorf("unknown station list should skip the check: %v", err)
+	}
+}
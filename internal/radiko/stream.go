@@ -0,0 +1,161 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"time"
+)
+
+// pipeMuxers はパイプに出力するときのffmpegの出力フォーマット。
+// M4Aは最後にmoovを書き戻す必要があるためパイプには出力できない
+var pipeMuxers = map[string]string{
+	"mp3":  "mp3",
+	"aac":  "adts",
+	"opus": "opus",
+	"flac": "flac",
+}
+
+// CanStream は出力ファイルの形式が録音ファイルを作らずに変換できるかを返す
+func CanStream(output string) bool {
+	f, ok := FormatForPath(output)
+	if !ok {
+		f = outputFormats[DefaultFormat]
+	}
+	_, ok = pipeMuxers[f.Name]
+	return ok
+}
+
+// StreamTimeFreeContext はタイムフリー番組をADTS形式のままwに書き込む。
+// 録音ファイルを作らないため、中断した場合に続きから再開することはできない
+func (c *Client) StreamTimeFreeContext(ctx context.Context, stationID string, startTime time.Time, duration int, w io.Writer) error {
+	if err := c.CheckStationAreaContext(ctx, stationID); err != nil {
+		return err
+	}
+	endTime := startTime.Add(time.Duration(duration) * time.Minute)
+	streamURL, err := c.getTimeFreeURL(ctx, stationID, startTime, endTime)
+	if err != nil {
+		return fmt.Errorf("ストリーミングURL取得エラー: %w", err)
+	}
+	c.logger.Info("ストリーミングURL取得完了")
+
+	segments, err := c.fetchSegments(ctx, streamURL)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("プレイリストからセグメントを取得できませんでした")
+	}
+
+	c.logger.Info("ダウンロード開始（ストリーミング）...")
+	counter := &countingWriter{w: w}
+	if err := c.downloadSegments(ctx, segments, 0, counter, nil); err != nil {
+		return err
+	}
+	c.logger.Info("ダウンロード完了: %.2f MB", float64(counter.n)/(1024*1024))
+	return nil
+}
+
+// countingWriter は書き込んだバイト数を数える
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ConvertStream はADTS形式の音声を受け取り、outputの拡張子の形式に変換しながらwに書き込む。
+// 返されたio.WriteCloserのCloseで変換の完了を待つ。
+// AACでエンコーダー設定がない場合はffmpegを使わずにそのまま書き込む
+func ConvertStream(ctx context.Context, cfg *Config, output string, w io.Writer) (io.WriteCloser, error) {
+	f, ok := FormatForPath(output)
+	if !ok {
+		f = outputFormats[DefaultFormat]
+	}
+	muxer, ok := pipeMuxers[f.Name]
+	if !ok {
+		return nil, fmt.Errorf("%s は録音ファイルを作らずに変換できません", f.Name)
+	}
+	opts := cfg.Encoders[f.Name]
+	if f.copy && opts.IsZero() {
+		return nopWriteCloser{w}, nil
+	}
+
+	ffmpegPath := cfg.FFmpegPath
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	conv := &streamConverter{}
+	conv.cmd = exec.CommandContext(ctx, ffmpegPath, f.streamArgs(muxer, opts)...)
+	conv.cmd.Stdout = w
+	conv.cmd.Stderr = &conv.stderr
+	stdin, err := conv.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	conv.stdin = stdin
+	if err := conv.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffmpegの起動に失敗: %w", err)
+	}
+	return conv, nil
+}
+
+// streamArgs は標準入力のADTSを変換して標準出力に書き出すffmpegの引数を返す
+func (f OutputFormat) streamArgs(muxer string, opts EncoderOptions) []string {
+	f.container = muxer
+	args := f.ffmpegArgs("pipe:0", "pipe:1", opts)
+	// 入力はパイプのため形式を明示する
+	args = slices.Insert(args, 1, "-f", "aac")
+	if f.Name == "mp3" {
+		// タグは先頭に別途書き込み、長さの情報（Xing）は後から書き換えられないため付けない
+		args = slices.Insert(args, len(args)-1, "-id3v2_version", "0", "-write_xing", "0")
+	}
+	return args
+}
+
+// streamConverter はffmpegの標準入力に書き込み、標準出力を出力先に流す
+type streamConverter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+func (s *streamConverter) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+// Close は入力の終わりをffmpegに伝え、変換が終わるまで待つ
+func (s *streamConverter) Close() error {
+	s.stdin.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpegの実行に失敗: %w: %s", err, lastLine(s.stderr.Bytes()))
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// WriteStreamTags はストリームの先頭に書き込めるタグを書き込む。
+// MP3はID3v2タグを書き込み、その他の形式では何もしない
+func WriteStreamTags(w io.Writer, output string, md Metadata) error {
+	f, ok := FormatForPath(output)
+	if !ok {
+		f = outputFormats[DefaultFormat]
+	}
+	if f.Name != "mp3" {
+		return nil
+	}
+	_, err := w.Write(buildID3(md))
+	return err
+}
@@ -0,0 +1,104 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanStream(t *testing.T) {
+	for output, want := range map[string]bool{
+		"show.mp3":  true,
+		"show.aac":  true,
+		"show.opus": true,
+		"show.flac": true,
+		"show.m4a":  false,
+		"show":      true,
+	} {
+		if got := CanStream(output); got != want {
+			t.Errorf("CanStream(%q) = %v, want %v", output, got, want)
+		}
+	}
+}
+
+func TestConvertStream(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	// 引数を記録し、標準入力に印を付けて標準出力に流す
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\nprintf 'enc:'\ncat\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cfg := &Config{FFmpegPath: ffmpeg, Encoders: map[string]EncoderOptions{"mp3": {Bitrate: "64k"}}}
+	conv, err := ConvertStream(context.Background(), cfg, "show.mp3", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Write([]byte("adts"))
+	if err := conv.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if out.String() != "enc:adts" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	data, _ := os.ReadFile(argsFile)
+	want := "-y -f aac -i pipe:0 -vn -c:a libmp3lame -b:a 64k -f mp3 -id3v2_version 0 -write_xing 0 pipe:1"
+	if got := strings.TrimSpace(string(data)); got != want {
+		t.Errorf("ffmpeg args = %s, want %s", got, want)
+	}
+}
+
+func TestConvertStream_Failure(t *testing.T) {
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	os.WriteFile(ffmpeg, []byte("#!/bin/sh\ncat > /dev/null\necho 'Unknown encoder' >&2\nexit 1\n"), 0755)
+
+	conv, err := ConvertStream(context.Background(), &Config{FFmpegPath: ffmpeg}, "show.opus", &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Write([]byte("adts"))
+	if err := conv.Close(); err == nil || !strings.Contains(err.Error(), "Unknown encoder") {
+		t.Errorf("expected ffmpeg error, got %v", err)
+	}
+}
+
+func TestConvertStream_AACWithoutEncoder(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &Config{FFmpegPath: "missing-ffmpeg"}
+	conv, err := ConvertStream(context.Background(), cfg, "show.aac", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Write([]byte("adts"))
+	if err := conv.Close(); err != nil || out.String() != "adts" {
+		t.Errorf("AAC should pass through without ffmpeg: %q, %v", out.String(), err)
+	}
+
+	if _, err := ConvertStream(context.Background(), cfg, "show.m4a", &out); err == nil {
+		t.Error("expected error for M4A")
+	}
+}
+
+func TestWriteStreamTags(t *testing.T) {
+	md := Metadata{Title: "番組"}
+	var buf bytes.Buffer
+	if err := WriteStreamTags(&buf, "show.mp3", md); err != nil {
+		t.Fatal(err)
+	}
+	if frames := readID3Frames(t, buf.Bytes()); string(frames["TIT2"][1:]) != "番組" {
+		t.Errorf("unexpected tag: %q", buf.Bytes())
+	}
+
+	buf.Reset()
+	WriteStreamTags(&buf, "show.flac", md)
+	if buf.Len() != 0 {
+		t.Errorf("no tags should be written for FLAC: %q", buf.Bytes())
+	}
+}
@@ -0,0 +1,297 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata は出力ファイルに書き込むタグ情報
+type Metadata struct {
+	// Title はエピソードのタイトル（番組名と放送日）
+	Title string
+	// Album は番組名
+	Album string
+	// Artist は出演者
+	Artist string
+	// AlbumArtist は放送局名
+	AlbumArtist string
+	// Date は放送開始日時
+	Date time.Time
+	// Description は番組の説明
+	Description string
+	// Image は番組画像のURL
+	Image string
+	// Cover はカバー画像（JPEGまたはPNG）
+	Cover []byte
+	// Chapters はチャプター
+	Chapters []Chapter
+}
+
+// StationName は局IDに対応する局名を返す（不明な場合は局ID）
+func StationName(stationID string) string {
+	if name, ok := GetAvailableStations()[stationID]; ok {
+		return name
+	}
+	return stationID
+}
+
+// StationName は局IDに対応する局名を返す。
+// 組み込みの局名にない局（関東以外）は認証したエリアの局一覧から探し、見つからなければ局IDを返す
+func (c *Client) StationName(ctx context.Context, stationID string) string {
+	if name, ok := GetAvailableStations()[stationID]; ok {
+		return name
+	}
+	stations, err := c.ListStationsContext(ctx, c.cacheDir)
+	if err != nil {
+		c.logger.Debug("局一覧から局名を取得できませんでした: %v", err)
+		return stationID
+	}
+	if name, ok := StationNames(stations)[stationID]; ok {
+		return name
+	}
+	return stationID
+}
+
+// NewMetadata は番組表の番組からタグ情報を作る
+func NewMetadata(p Program) Metadata {
+	description := p.Description
+	if description == "" {
+		description = p.Info
+	}
+	return Metadata{
+		Title:       fmt.Sprintf("%s %s", p.Title, p.Start.Format("2006-01-02")),
+		Album:       p.Title,
+		Artist:      p.Performers,
+		AlbumArtist: StationName(p.StationID),
+		Date:        p.Start,
+		Description: description,
+		Image:       p.Image,
+	}
+}
+
+// FallbackMetadata は番組表が使えない場合に局・開始時刻・録音時間からタグ情報を作る
+func FallbackMetadata(stationID string, start time.Time, duration int) Metadata {
+	return fallbackMetadata(StationName(stationID), start, duration)
+}
+
+// fallbackMetadata は局名・開始時刻・録音時間からタグ情報を作る
+func fallbackMetadata(name string, start time.Time, duration int) Metadata {
+	return Metadata{
+		Title:       fmt.Sprintf("%s %s (%s)", name, start.Format("2006-01-02 15:04"), FormatDuration(duration)),
+		Album:       name,
+		AlbumArtist: name,
+		Date:        start,
+	}
+}
+
+// ResolveMetadata は録音する番組のタグ情報を返す。
+// 番組名が分からない場合は番組表から開始時刻に放送していた番組を探し、
+// それも見つからなければ局・開始時刻・録音時間からタグを作る
+func (c *Client) ResolveMetadata(ctx context.Context, p Program) Metadata {
+	if p.Title == "" {
+		found, err := c.programAt(ctx, p.StationID, p.Start)
+		if err != nil {
+			c.logger.Debug("番組表から番組情報を取得できませんでした: %v", err)
+			return fallbackMetadata(c.StationName(ctx, p.StationID), p.Start, p.Duration())
+		}
+		p = found
+	}
+
+	md := NewMetadata(p)
+	md.AlbumArtist = c.StationName(ctx, p.StationID)
+	if p.Image != "" {
+		cover, err := c.get(ctx, p.Image)
+		if err != nil {
+			c.logger.Debug("番組画像の取得に失敗: %v", err)
+		} else if mime := http.DetectContentType(cover); mime == "image/jpeg" || mime == "image/png" {
+			md.Cover = cover
+		} else {
+			c.logger.Debug("番組画像の形式に対応していません: %s", mime)
+		}
+	}
+	return md
+}
+
+// programAt は指定時刻に放送していた番組を番組表から探す
+func (c *Client) programAt(ctx context.Context, stationID string, t time.Time) (Program, error) {
+	// radikoの番組表は5時始まりのため、0〜5時の番組は前日分に含まれる
+	programs, err := c.GetDailyProgramsContext(ctx, stationID, t.Add(-5*time.Hour))
+	if err != nil {
+		return Program{}, err
+	}
+	for _, p := range programs {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return p, nil
+		}
+	}
+	return Program{}, fmt.Errorf("番組が見つかりません: 局=%s, 時刻=%s", stationID, t.Format("2006-01-02 15:04"))
+}
+
+// coverMIME はカバー画像のMIMEタイプを返す
+func (m Metadata) coverMIME() string {
+	return http.DetectContentType(m.Cover)
+}
+
+// TagFile は出力ファイルにタグを書き込む。
+// MP3はID3v2.4、M4AはMP4のメタデータアトムを使い、それ以外の形式では何もしない
+func TagFile(path string, md Metadata) error {
+	switch filepath.Ext(path) {
+	case ".mp3":
+		return writeID3(path, md)
+	case ".m4a":
+		return writeMP4Tags(path, md)
+	}
+	return nil
+}
+
+// writeID3 はMP3ファイルの先頭のID3v2タグを置き換える
+func writeID3(path string, md Metadata) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// ffmpegが付けた既存のタグは読み飛ばす
+	skip, err := id3Size(in)
+	if err != nil {
+		return err
+	}
+	if _, err := in.Seek(skip, io.SeekStart); err != nil {
+		return err
+	}
+
+	return replaceFile(path, func(w io.Writer) error {
+		if _, err := w.Write(buildID3(md)); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// id3Size はファイル先頭のID3v2タグの大きさを返す（タグがない場合は0）
+func id3Size(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+	size := int64(syncsafeDecode(header[6:10])) + 10
+	if header[5]&0x10 != 0 {
+		size += 10 // フッターあり
+	}
+	return size, nil
+}
+
+// buildID3 はID3v2.4タグを組み立てる
+func buildID3(md Metadata) []byte {
+	var frames bytes.Buffer
+	textFrame := func(id, value string) {
+		if value != "" {
+			writeID3Frame(&frames, id, append([]byte{0x03}, value...))
+		}
+	}
+	textFrame("TIT2", md.Title)
+	textFrame("TALB", md.Album)
+	textFrame("TPE1", md.Artist)
+	textFrame("TPE2", md.AlbumArtist)
+	if !md.Date.IsZero() {
+		textFrame("TDRC", md.Date.Format("2006-01-02T15:04"))
+	}
+	if md.Description != "" {
+		// エンコーディング(UTF-8) + 言語 + 空の短い説明 + 本文
+		body := append([]byte{0x03, 'j', 'p', 'n', 0x00}, md.Description...)
+		writeID3Frame(&frames, "COMM", body)
+	}
+	if len(md.Cover) > 0 {
+		// エンコーディング + MIMEタイプ + 画像の種類(表紙) + 空の説明 + 画像
+		body := append([]byte{0x03}, md.coverMIME()...)
+		body = append(body, 0x00, 0x03, 0x00)
+		writeID3Frame(&frames, "APIC", append(body, md.Cover...))
+	}
+	writeID3Chapters(&frames, md.Chapters)
+
+	header := []byte{'I', 'D', '3', 0x04, 0x00, 0x00}
+	header = append(header, syncsafeEncode(uint32(frames.Len()))...)
+	return append(header, frames.Bytes()...)
+}
+
+// writeID3Chapters はチャプターをCHAPフレームと目次のCTOCフレームとして書き込む
+func writeID3Chapters(w *bytes.Buffer, chapters []Chapter) {
+	if len(chapters) == 0 {
+		return
+	}
+
+	// CTOC: 要素ID + フラグ(最上位・順序あり) + 子要素の数 + 子要素のID
+	toc := []byte("toc\x00")
+	toc = append(toc, 0x03, byte(min(len(chapters), 255)))
+	for i, ch := range chapters[:min(len(chapters), 255)] {
+		id := fmt.Sprintf("chp%d", i)
+		toc = append(toc, id...)
+		toc = append(toc, 0x00)
+
+		// CHAP: 要素ID + 開始・終了時刻(ミリ秒) + 開始・終了のバイト位置(未使用) + タイトルのTIT2フレーム
+		var title bytes.Buffer
+		writeID3Frame(&title, "TIT2", append([]byte{0x03}, ch.Title...))
+		body := append([]byte(id), 0x00)
+		body = binary.BigEndian.AppendUint32(body, uint32(ch.Start.Milliseconds()))
+		body = binary.BigEndian.AppendUint32(body, uint32(ch.End.Milliseconds()))
+		body = binary.BigEndian.AppendUint32(body, 0xFFFFFFFF)
+		body = binary.BigEndian.AppendUint32(body, 0xFFFFFFFF)
+		writeID3Frame(w, "CHAP", append(body, title.Bytes()...))
+	}
+	writeID3Frame(w, "CTOC", toc)
+}
+
+// writeID3Frame はID3v2.4のフレームを書き込む
+func writeID3Frame(w *bytes.Buffer, id string, body []byte) {
+	w.WriteString(id)
+	w.Write(syncsafeEncode(uint32(len(body))))
+	w.Write([]byte{0x00, 0x00})
+	w.Write(body)
+}
+
+// syncsafeEncode は7ビットずつに分けた4バイトの整数を返す
+func syncsafeEncode(n uint32) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// syncsafeDecode は7ビットずつに分けた4バイトの整数を読む
+func syncsafeDecode(b []byte) uint32 {
+	return uint32(b[0])<<21 | uint32(b[1])<<14 | uint32(b[2])<<7 | uint32(b[3])
+}
+
+// replaceFile は一時ファイルに書き込んでから元のファイルと置き換える
+func replaceFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
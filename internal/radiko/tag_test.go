@@ -0,0 +1,216 @@
+package radiko
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pngCover はhttp.DetectContentTypeでPNGと判定される最小のデータ
+var pngCover = []byte("\x89PNG\r\n\x1a\nfake")
+
+// readID3Frames はID3v2.4タグのフレームを読み出す
+func readID3Frames(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	if string(data[:3]) != "ID3" || data[3] != 4 {
+		t.Fatalf("ID3v2.4 header not found: %q", data[:5])
+	}
+	size := int(syncsafeDecode(data[6:10]))
+	frames := map[string][]byte{}
+	for p := data[10 : 10+size]; len(p) >= 10; {
+		n := int(syncsafeDecode(p[4:8]))
+		frames[string(p[:4])] = p[10 : 10+n]
+		p = p[10+n:]
+	}
+	return frames
+}
+
+func TestNewMetadata(t *testing.T) {
+	jst := jstLocation()
+	p := Program{
+		StationID:   "TBS",
+		Title:       "アフター6ジャンクション2",
+		Performers:  "宇多丸",
+		Start:       time.Date(2024, 6, 7, 20, 0, 0, 0, jst),
+		End:         time.Date(2024, 6, 7, 21, 30, 0, 0, jst),
+		Description: "カルチャーキュレーション番組",
+	}
+	md := NewMetadata(p)
+	if md.Title != "アフター6ジャンクション2 2024-06-07" || md.Album != p.Title {
+		t.Errorf("unexpected title/album: %q / %q", md.Title, md.Album)
+	}
+	if md.AlbumArtist != "TBSラジオ" || md.Artist != "宇多丸" {
+		t.Errorf("unexpected artists: %q / %q", md.AlbumArtist, md.Artist)
+	}
+
+	fb := FallbackMetadata("XYZ", p.Start, 90)
+	if fb.Title != "XYZ 2024-06-07 20:00 (1時間30分)" || fb.AlbumArtist != "XYZ" {
+		t.Errorf("unexpected fallback metadata: %+v", fb)
+	}
+}
+
+func TestResolveMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/program/station/date/20240607/TBS.xml":
+			http.ServeFile(w, r, "testdata/date_20240607_TBS.xml")
+		case "/cover.png":
+			w.Write(pngCover)
+		case "/v3/station/list/JP27.xml":
+			http.ServeFile(w, r, "testdata/station_list_JP27.xml")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{baseURL: server.URL, httpClient: server.Client(), logger: NewLogger(false)}
+	jst := jstLocation()
+
+	// 番組表に一致する番組があれば番組情報を使う
+	md := c.ResolveMetadata(context.Background(), Program{
+		StationID: "TBS",
+		Start:     time.Date(2024, 6, 7, 20, 0, 0, 0, jst),
+		End:       time.Date(2024, 6, 7, 21, 0, 0, 0, jst),
+	})
+	if md.Album != "アフター6ジャンクション2" || md.Artist != "宇多丸、宇垣美里" {
+		t.Errorf("expected guide metadata, got %+v", md)
+	}
+
+	// 番組表が取得できなければ録音の引数から作る
+	md = c.ResolveMetadata(context.Background(), Program{
+		StationID: "TBS",
+		Start:     time.Date(2024, 6, 8, 20, 0, 0, 0, jst),
+		End:       time.Date(2024, 6, 8, 21, 0, 0, 0, jst),
+	})
+	if md.Title != "TBSラジオ 2024-06-08 20:00 (1時間)" {
+		t.Errorf("expected fallback metadata, got %+v", md)
+	}
+
+	// 関東以外の局名は認証したエリアの局一覧から取得する
+	c.areaID = "JP27"
+	md = c.ResolveMetadata(context.Background(), Program{
+		StationID: "ABC",
+		Start:     time.Date(2024, 6, 8, 20, 0, 0, 0, jst),
+		End:       time.Date(2024, 6, 8, 21, 0, 0, 0, jst),
+	})
+	if md.Title != "ABCラジオ 2024-06-08 20:00 (1時間)" || md.AlbumArtist != "ABCラジオ" {
+		t.Errorf("expected station name from the station list, got %+v", md)
+	}
+	if name := c.StationName(context.Background(), "XYZ"); name != "XYZ" {
+		t.Errorf("unknown station should fall back to its ID, got %q", name)
+	}
+
+	// 番組画像はカバーとして取得する
+	md = c.ResolveMetadata(context.Background(), Program{
+		StationID: "TBS",
+		Title:     "テスト",
+		Start:     time.Date(2024, 6, 7, 20, 0, 0, 0, jst),
+		Image:     server.URL + "/cover.png",
+	})
+	if !bytes.Equal(md.Cover, pngCover) {
+		t.Errorf("expected cover to be fetched")
+	}
+}
+
+func TestTagFile_MP3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "show.mp3")
+	audio := []byte("\xff\xfbmp3 frames")
+	// ffmpegが付けたタグは置き換えられる
+	old := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 4}, "junk"...)
+	os.WriteFile(path, append(old, audio...), 0644)
+
+	md := Metadata{
+		Title:       "番組 2024-06-07",
+		Album:       "番組",
+		AlbumArtist: "TBSラジオ",
+		Date:        time.Date(2024, 6, 7, 20, 0, 0, 0, jstLocation()),
+		Description: "説明",
+		Cover:       pngCover,
+	}
+	if err := TagFile(path, md); err != nil {
+		t.Fatalf("TagFile failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	frames := readID3Frames(t, data)
+	if got := string(frames["TIT2"][1:]); got != md.Title {
+		t.Errorf("TIT2 = %q", got)
+	}
+	if got := string(frames["TPE2"][1:]); got != "TBSラジオ" {
+		t.Errorf("TPE2 = %q", got)
+	}
+	if got := string(frames["TDRC"][1:]); got != "2024-06-07T20:00" {
+		t.Errorf("TDRC = %q", got)
+	}
+	if _, ok := frames["TPE1"]; ok {
+		t.Error("empty fields should not be written")
+	}
+	if !bytes.HasSuffix(frames["COMM"], []byte("説明")) {
+		t.Errorf("COMM = %q", frames["COMM"])
+	}
+	if !bytes.HasPrefix(frames["APIC"], []byte("\x03image/png\x00\x03\x00")) {
+		t.Errorf("APIC header = %q", frames["APIC"][:14])
+	}
+	if !bytes.HasSuffix(data, audio) || bytes.Contains(data, []byte("junk")) {
+		t.Error("audio data should follow the new tag and the old tag should be removed")
+	}
+}
+
+func TestTagFile_M4A(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.aac")
+	output := filepath.Join(dir, "show.m4a")
+
+	var stream, payloads bytes.Buffer
+	for i := 0; i < 70; i++ {
+		payload := bytes.Repeat([]byte{byte(i)}, 20)
+		payloads.Write(payload)
+		stream.Write(adtsFrame(payload))
+	}
+	os.WriteFile(input, stream.Bytes(), 0644)
+	if err := RemuxToM4A(input, output); err != nil {
+		t.Fatal(err)
+	}
+
+	md := Metadata{Title: "番組 2024-06-07", AlbumArtist: "TBSラジオ", Cover: pngCover}
+	// 2回書き込んでも既存のudtaが置き換えられる
+	for i := 0; i < 2; i++ {
+		if err := TagFile(output, md); err != nil {
+			t.Fatalf("TagFile failed: %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(output)
+	ilst := findBox(t, data, "moov", "udta", "meta")
+	// metaはフルボックスなのでバージョンとフラグを読み飛ばす
+	items := ilst[4:]
+	nam := findBox(t, items, "ilst", "\xa9nam", "data")
+	if got := string(nam[8:]); got != md.Title {
+		t.Errorf("©nam = %q", got)
+	}
+	covr := findBox(t, items, "ilst", "covr", "data")
+	if binary.BigEndian.Uint32(covr) != 14 || !bytes.Equal(covr[8:], pngCover) {
+		t.Errorf("unexpected covr data")
+	}
+	if strings.Count(string(findBox(t, data, "moov")), "udta") != 1 {
+		t.Error("expected exactly one udta box")
+	}
+
+	// moovが大きくなった分だけチャンクオフセットが補正されている
+	stco := findBox(t, data, "moov", "trak", "mdia", "minf", "stbl", "stco")
+	for i := 0; i < int(binary.BigEndian.Uint32(stco[4:])); i++ {
+		offset := binary.BigEndian.Uint32(stco[8+i*4:])
+		want := payloads.Bytes()[i*64*20 : i*64*20+20]
+		if !bytes.Equal(data[offset:offset+20], want) {
+			t.Errorf("chunk %d offset does not point at its first frame", i)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package radiko
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tokenTTL は保存した認証トークンを使い回す期間。
+// radikoのトークンは取得から約70分で無効になるため、録音の途中で切れにくいよう短めにする
+const tokenTTL = time.Hour
+
+// tokenCacheFileName は認証トークンを保存するファイル名（CacheDirの中）
+const tokenCacheFileName = "auth_token.json"
+
+// CachedToken は実行をまたいで使い回す認証トークン
+type CachedToken struct {
+	Token      string    `json:"token"`
+	AreaID     string    `json:"area_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	// Area はトークンを取得したときに指定したエリア、Premium はプレミアムのアカウントのハッシュ。
+	// 設定が変わった場合は使い回さない。保存先（S3など）にメールアドレスを残さないようハッシュにする
+	Area    string `json:"area,omitempty"`
+	Premium string `json:"premium,omitempty"`
+}
+
+// Valid はトークンが有効期間内で、指定したエリアとアカウントが取得時と同じかを返す
+func (t CachedToken) Valid(area, premium string, now time.Time) bool {
+	return t.Token != "" &&
+		now.Sub(t.AcquiredAt) >= 0 && now.Sub(t.AcquiredAt) < tokenTTL &&
+		strings.EqualFold(t.Area, area) && t.Premium == accountHash(premium)
+}
+
+// accountHash はプレミアムのアカウントを見分けるためのハッシュ（SHA-256の先頭8バイト）を返す。
+// プレミアムを使わない場合は空
+func accountHash(email string) string {
+	if email == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TokenCache は認証トークンの保存場所。
+// CLIではローカルのファイル、Lambdaでは保存先（S3など）に置いて次回の実行で使い回す
+type TokenCache interface {
+	LoadToken(ctx context.Context) (CachedToken, error)
+	SaveToken(ctx context.Context, t CachedToken) error
+}
+
+// FileTokenCache は認証トークンをローカルのファイルに保存する
+type FileTokenCache struct {
+	Path string
+}
+
+// NewFileTokenCache はpathに認証トークンを保存するTokenCacheを作成
+func NewFileTokenCache(path string) *FileTokenCache {
+	return &FileTokenCache{Path: path}
+}
+
+// LoadToken は保存した認証トークンを読み込む。まだない場合はos.ErrNotExistを返す
+func (f *FileTokenCache) LoadToken(ctx context.Context) (CachedToken, error) {
+	var t CachedToken
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
+
+// SaveToken は認証トークンを本人だけが読めるファイルに保存する
+func (f *FileTokenCache) SaveToken(ctx context.Context, t CachedToken) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path, data, 0600)
+}
+
+// TokenCachePath は認証トークンを保存するファイルのパスを返す（使わない設定なら空）
+func TokenCachePath(cfg *Config) string {
+	if cfg.CacheDir == "" || cfg.DisableTokenCache {
+		return ""
+	}
+	return filepath.Join(cfg.CacheDir, tokenCacheFileName)
+}
+
+// SetTokenCache は認証トークンの保存場所を設定する（nilで使わない）
+func (c *Client) SetTokenCache(tc TokenCache) {
+	c.tokenCache = tc
+}
+
+// useCachedToken は保存した認証トークンが使えればクライアントに設定してtrueを返す
+func (c *Client) useCachedToken(ctx context.Context) bool {
+	if c.tokenCache == nil {
+		return false
+	}
+	t, err := c.tokenCache.LoadToken(ctx)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Debug("保存した認証トークンを読み込めません: %v", err)
+		}
+		return false
+	}
+	if !t.Valid(c.area, c.premiumEmail, time.Now()) {
+		c.logger.Debug("保存した認証トークンは期限切れか設定が異なるため使いません")
+		return false
+	}
+
+	c.tokenMu.Lock()
+	c.authToken = t.Token
+	c.areaID = t.AreaID
+	c.tokenMu.Unlock()
+	c.logger.Info("保存した認証トークンを使います (エリア: %s, 取得: %s)", t.AreaID, t.AcquiredAt.Format("15:04"))
+	return true
+}
+
+// saveToken は取得した認証トークンを保存する。
+// 保存できなくても認証は成功しているため、ログを出すだけにする
+func (c *Client) saveToken(ctx context.Context) {
+	if c.tokenCache == nil {
+		return
+	}
+	t := CachedToken{
+		Token:      c.token(),
+		AreaID:     c.AreaID(),
+		AcquiredAt: time.Now(),
+		Area:       strings.ToUpper(c.area),
+		Premium:    accountHash(c.premiumEmail),
+	}
+	if err := c.tokenCache.SaveToken(ctx, t); err != nil {
+		c.logger.Error("認証トークンの保存に失敗: %v", err)
+	}
+}
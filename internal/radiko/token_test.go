@@ -0,0 +1,140 @@
+package radiko
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuth_TokenCache(t *testing.T) {
+	server := newFakeRadiko(t)
+	cfg := &Config{CacheDir: t.TempDir()}
+	ctx := context.Background()
+
+	if err := server.client(cfg).AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(TokenCachePath(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v", fi.Mode().Perm())
+	}
+
+	// 次回の実行では保存したトークンを使い、auth1/auth2を省略する
+	c := server.client(cfg)
+	if err := c.AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Auths() != 1 || c.token() != "fresh-token-1" || c.AreaID() != "JP13" {
+		t.Errorf("cached token should be reused: auths=%d token=%s area=%s", server.Auths(), c.token(), c.AreaID())
+	}
+
+	// エリアの指定が変わった場合は使い回さない
+	keyFile := filepath.Join(t.TempDir(), "key.bin")
+	os.WriteFile(keyFile, []byte("0123456789"), 0644)
+	c = server.client(cfg)
+	c.SetArea("JP13", keyFile)
+	if err := c.AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Auths() != 2 {
+		t.Errorf("token for another area should not be reused: auths=%d", server.Auths())
+	}
+
+	cfg.DisableTokenCache = true
+	if TokenCachePath(cfg) != "" {
+		t.Error("token cache should be disabled")
+	}
+}
+
+func TestAuth_TokenCacheExpired(t *testing.T) {
+	server := newFakeRadiko(t)
+	path := filepath.Join(t.TempDir(), "token.json")
+	cache := NewFileTokenCache(path)
+	cache.SaveToken(context.Background(), CachedToken{Token: "old-token", AreaID: "JP13", AcquiredAt: time.Now().Add(-2 * time.Hour)})
+
+	c := server.client(&Config{})
+	c.SetTokenCache(cache)
+	if err := c.AuthContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if server.Auths() != 1 || c.token() != "fresh-token-1" {
+		t.Errorf("expired token should be refreshed: auths=%d token=%s", server.Auths(), c.token())
+	}
+	saved, err := cache.LoadToken(context.Background())
+	if err != nil || saved.Token != "fresh-token-1" {
+		t.Errorf("refreshed token should be saved: %+v, %v", saved, err)
+	}
+}
+
+func TestGetTimeFreeURL_RefreshesRejectedToken(t *testing.T) {
+	server := newFakeRadiko(t)
+	server.Status = rejectTokens("revoked-token")
+	cache := NewFileTokenCache(filepath.Join(t.TempDir(), "token.json"))
+	cache.SaveToken(context.Background(), CachedToken{Token: "revoked-token", AreaID: "JP13", AcquiredAt: time.Now()})
+
+	c := server.client(&Config{})
+	c.SetTokenCache(cache)
+	ctx := context.Background()
+	if err := c.AuthContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	streamURL, err := c.getTimeFreeURL(ctx, "TBS", time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamURL != server.ChunklistURL() || server.Auths() != 1 || c.token() != "fresh-token-1" {
+		t.Errorf("rejected token should be refreshed once: url=%s auths=%d token=%s", streamURL, server.Auths(), c.token())
+	}
+}
+
+func TestFetchSegments_RefreshesRejectedToken(t *testing.T) {
+	server := newFakeRadiko(t)
+	server.Status = rejectTokens("revoked-token")
+	c := server.client(&Config{})
+	c.authToken = "revoked-token"
+
+	segments, err := c.fetchSegments(context.Background(), server.URL+"/chunklist.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || segments[0] != server.URL+"/seg1.aac" || server.Auths() != 1 {
+		t.Errorf("rejected chunklist should be fetched again after reauth: segments=%v auths=%d", segments, server.Auths())
+	}
+
+	// 認証以外のエラーは再認証せずに *StatusError のまま返す
+	c = server.client(&Config{})
+	c.authToken = "fresh-token-1"
+	_, err = c.fetchSegments(context.Background(), server.URL+"/missing.m3u8")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected *StatusError, got %v", err)
+	}
+}
+
+func TestCachedTokenValid(t *testing.T) {
+	now := time.Date(2025, 6, 9, 12, 0, 0, 0, time.UTC)
+	tok := CachedToken{Token: "token", AreaID: "JP27", AcquiredAt: now.Add(-30 * time.Minute), Area: "JP27", Premium: accountHash("a@example.com")}
+	tests := []struct {
+		area, premium string
+		now           time.Time
+		want          bool
+	}{
+		{"jp27", "a@example.com", now, true},
+		{"JP13", "a@example.com", now, false},
+		{"JP27", "", now, false},
+		{"JP27", "a@example.com", now.Add(time.Hour), false},
+		{"JP27", "a@example.com", now.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := tok.Valid(tt.area, tt.premium, tt.now); got != tt.want {
+			t.Errorf("Valid(%q, %q, %s) = %v, want %v", tt.area, tt.premium, tt.now, got, tt.want)
+		}
+	}
+}
@@ -1,15 +1,23 @@
 package radiko
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Logger はログ出力を管理
 type Logger struct {
 	verbose bool
+
+	mu sync.RWMutex
+	// secrets はログに出さない文字列（パスワードやセッションIDなど）
+	secrets []string
 }
 
 // NewLogger は新しいLoggerを作成
@@ -17,26 +25,47 @@ func NewLogger(verbose bool) *Logger {
 	return &Logger{verbose: verbose}
 }
 
+// AddSecret はログに出さない文字列を登録する。以降のログでは "****" に置き換える
+func (l *Logger) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.secrets = append(l.secrets, secret)
+}
+
+// redact はメッセージから登録された文字列を取り除く
+func (l *Logger) redact(format string, args []interface{}) string {
+	msg := fmt.Sprintf(format, args...)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, s := range l.secrets {
+		msg = strings.ReplaceAll(msg, s, "****")
+	}
+	return msg
+}
+
 // Info は情報ログを出力
 func (l *Logger) Info(format string, args ...interface{}) {
-	log.Printf("[INFO] "+format, args...)
+	log.Print("[INFO] " + l.redact(format, args))
 }
 
 // Debug はデバッグログを出力（verboseモードでのみ）
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if l.verbose {
-		log.Printf("[DEBUG] "+format, args...)
+		log.Print("[DEBUG] " + l.redact(format, args))
 	}
 }
 
 // Error はエラーログを出力
 func (l *Logger) Error(format string, args ...interface{}) {
-	log.Printf("[ERROR] "+format, args...)
+	log.Print("[ERROR] " + l.redact(format, args))
 }
 
 // Fatal はエラーログを出力して終了
 func (l *Logger) Fatal(format string, args ...interface{}) {
-	log.Fatalf("[FATAL] "+format, args...)
+	log.Fatal("[FATAL] " + l.redact(format, args))
 }
 
 // ValidateDateTime は日時の妥当性をチェック
@@ -57,6 +86,28 @@ func ValidateDateTime(startTime time.Time) error {
 	return nil
 }
 
+// ParsePeriod は "7d" や "48h" のような期間を解釈する。
+// 日数の "d" のほかは time.ParseDuration と同じ形式を受け付ける
+func ParsePeriod(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("期間の形式が正しくありません: %q (7d, 48h など)", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("期間の形式が正しくありません: %q (7d, 48h など)", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("期間は0より大きくしてください: %q", s)
+	}
+	return d, nil
+}
+
 // FormatDuration は時間を読みやすい形式に変換
 func FormatDuration(minutes int) string {
 	if minutes < 60 {
@@ -72,9 +123,14 @@ func FormatDuration(minutes int) string {
 
 // ConvertToMP3 uses ffmpeg to convert an AAC file to MP3 format.
 func ConvertToMP3(ffmpegPath, input, output string) error {
+	return ConvertToMP3Context(context.Background(), ffmpegPath, input, output)
+}
+
+// ConvertToMP3Context is like ConvertToMP3 but kills ffmpeg when ctx is done.
+func ConvertToMP3Context(ctx context.Context, ffmpegPath, input, output string) error {
 	if ffmpegPath == "" {
 		ffmpegPath = "ffmpeg"
 	}
-	cmd := exec.Command(ffmpegPath, "-y", "-i", input, output)
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-y", "-i", input, output)
 	return cmd.Run()
 }
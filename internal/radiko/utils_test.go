@@ -29,3 +29,22 @@ func TestFormatDuration(t *testing.T) {
 		t.Errorf("unexpected result: %s", got)
 	}
 }
+
+func TestParsePeriod(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":    7 * 24 * time.Hour,
+		"48h":   48 * time.Hour,
+		"1h30m": 90 * time.Minute,
+	}
+	for s, want := range tests {
+		got, err := ParsePeriod(s)
+		if err != nil || got != want {
+			t.Errorf("ParsePeriod(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "d", "1w", "0d", "-2h"} {
+		if _, err := ParsePeriod(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+// RecordFunc は1回の放送を録音する。エラーを返すと再試行する
+type RecordFunc func(ctx context.Context, job Job, start time.Time) error
+
+// Runner はスケジュールに従って放送がタイムフリーで聴けるようになるのを待ち、順番に録音する
+type Runner struct {
+	Schedule *Schedule
+	Record   RecordFunc
+	Logger   *radiko.Logger
+
+	// テストで時刻を差し替えるために使う
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRunner はRunnerを作る
+func NewRunner(s *Schedule, record RecordFunc, logger *radiko.Logger) *Runner {
+	return &Runner{
+		Schedule: s,
+		Record:   record,
+		Logger:   logger,
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+// pending は次に録音する放送
+type pending struct {
+	job     Job
+	start   time.Time
+	readyAt time.Time
+	attempt int
+}
+
+// Run はctxがキャンセルされるまで録音を続ける
+func (r *Runner) Run(ctx context.Context) error {
+	now := r.now()
+	queue := make([]*pending, len(r.Schedule.Jobs))
+	for i, job := range r.Schedule.Jobs {
+		queue[i] = r.plan(job, job.Next(now))
+		r.Logger.Info("%s: 次の放送 %s", job.Name, queue[i].start.Format("2006-01-02 15:04"))
+	}
+
+	for {
+		p := queue[0]
+		for _, q := range queue[1:] {
+			if q.readyAt.Before(p.readyAt) {
+				p = q
+			}
+		}
+
+		if wait := p.readyAt.Sub(r.now()); wait > 0 {
+			r.Logger.Debug("%s: %s まで待機します", p.job.Name, p.readyAt.Format("2006-01-02 15:04"))
+			if err := r.sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+
+		p.attempt++
+		r.Logger.Info("%s: %s の放送を録音します（%d回目）", p.job.Name, p.start.Format("2006-01-02 15:04"), p.attempt)
+		err := r.Record(ctx, p.job, p.start)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			retryAt := r.now().Add(time.Duration(r.Schedule.RetryInterval) * time.Minute)
+			if p.attempt < r.Schedule.MaxAttempts && retryAt.Before(p.start.Add(timeFreeWindow)) {
+				r.Logger.Error("%s: 録音に失敗したため %s に再試行します: %v", p.job.Name, retryAt.Format("15:04"), err)
+				p.readyAt = retryAt
+				continue
+			}
+			r.Logger.Error("%s: %s の放送の録音をあきらめます: %v", p.job.Name, p.start.Format("2006-01-02 15:04"), err)
+		}
+
+		*p = *r.plan(p.job, p.job.Next(p.start.Add(p.job.Length())))
+		r.Logger.Info("%s: 次の放送 %s", p.job.Name, p.start.Format("2006-01-02 15:04"))
+	}
+}
+
+// plan は放送が終わってタイムフリーで聴けるようになる時刻を計算する
+func (r *Runner) plan(job Job, start time.Time) *pending {
+	delay := time.Duration(r.Schedule.Delay) * time.Minute
+	return &pending{job: job, start: start, readyAt: start.Add(job.Length() + delay)}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+// Package schedule は定期録音のスケジュールファイルを扱う
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// デフォルトの待ち時間と再試行
+const (
+	DefaultDelay         = 5
+	DefaultRetryInterval = 15
+	DefaultMaxAttempts   = 8
+)
+
+// timeFreeWindow はタイムフリーで録音できる期間
+const timeFreeWindow = 7 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Job は毎週（または毎日）決まった時刻に放送される番組の録音設定
+type Job struct {
+	// Name はログと出力ファイル名の {program} に使う名前
+	Name    string `json:"name"`
+	Station string `json:"station"`
+	// Weekdays は放送する曜日（"mon" など）。空の場合は毎日
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Time は放送開始時刻（日本時間の "HH:MM"）。深夜番組は "25:00" のように前日の曜日で書ける
+	Time string `json:"time"`
+	// Duration は録音時間（分）
+	Duration int `json:"duration"`
+	// Output は出力ファイル名のテンプレート（{station}, {program}, {yyyy} など）
+	Output string `json:"output,omitempty"`
+
+	days   map[time.Weekday]bool
+	offset time.Duration
+}
+
+// Schedule はスケジュールファイルの内容
+type Schedule struct {
+	// Delay は放送終了からタイムフリーで聴けるようになるまでの待ち時間（分）
+	Delay int `json:"delay"`
+	// RetryInterval は録音に失敗したときに再試行するまでの間隔（分）
+	RetryInterval int `json:"retry_interval"`
+	// MaxAttempts は1回の放送を録音する試行回数の上限
+	MaxAttempts int   `json:"max_attempts"`
+	Jobs        []Job `json:"jobs"`
+}
+
+// Load はスケジュールファイルを読み込んで内容を確認する
+func Load(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("スケジュールファイルの読み込みに失敗: %w", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse はJSON形式のスケジュールを読み込んで内容を確認する
+func Parse(data []byte) (*Schedule, error) {
+	s := &Schedule{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("スケジュールファイルの形式が正しくありません: %w", err)
+	}
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ResolveStations は設定の局IDのエイリアス（大文字小文字は区別しない）を各ジョブの局に反映し、局IDを大文字にそろえる。
+// 同じ局の放送が書き方の違いで別の放送として扱われないよう、読み込んだ直後に呼ぶ
+func (s *Schedule) ResolveStations(cfg *radiko.Config) {
+	for i := range s.Jobs {
+		station := s.Jobs[i].Station
+		if alias, ok := cfg.StationAliases[strings.ToLower(station)]; ok {
+			station = alias
+		}
+		s.Jobs[i].Station = strings.ToUpper(station)
+	}
+}
+
+// init は省略された値を補い、各ジョブの曜日と時刻を解釈する
+func (s *Schedule) init() error {
+	if s.Delay <= 0 {
+		s.Delay = DefaultDelay
+	}
+	if s.RetryInterval <= 0 {
+		s.RetryInterval = DefaultRetryInterval
+	}
+	if s.MaxAttempts <= 0 {
+		s.MaxAttempts = DefaultMaxAttempts
+	}
+	if len(s.Jobs) == 0 {
+		return fmt.Errorf("録音するジョブがありません")
+	}
+	for i := range s.Jobs {
+		if err := s.Jobs[i].init(); err != nil {
+			return fmt.Errorf("ジョブ%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (j *Job) init() error {
+	if j.Station == "" {
+		return fmt.Errorf("stationを指定してください")
+	}
+	if j.Duration <= 0 {
+		return fmt.Errorf("durationを指定してください")
+	}
+	var hour, minute int
+	if _, err := fmt.Sscanf(j.Time, "%d:%d", &hour, &minute); err != nil || hour < 0 || hour > 29 || minute < 0 || minute > 59 {
+		return fmt.Errorf("timeは HH:MM の形式で指定してください (00:00〜29:59): %q", j.Time)
+	}
+	j.offset = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+
+	j.days = map[time.Weekday]bool{}
+	for _, name := range j.Weekdays {
+		d, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("曜日が正しくありません: %q (sun, mon, tue, wed, thu, fri, sat)", name)
+		}
+		j.days[d] = true
+	}
+	if j.Name == "" {
+		j.Name = fmt.Sprintf("%s %s", j.Station, j.Time)
+	}
+	return nil
+}
+
+// Length は録音時間を返す
+func (j Job) Length() time.Duration {
+	return time.Duration(j.Duration) * time.Minute
+}
+
+// Next はafterの時点でまだ放送が終わっていない最初の回の開始時刻を返す
+func (j Job) Next(after time.Time) time.Time {
+	after = after.In(radiko.JST())
+	// 25:00 のような時刻は前日の曜日で指定されているため前日から探す
+	day := time.Date(after.Year(), after.Month(), after.Day()-1, 0, 0, 0, 0, after.Location())
+	for {
+		if len(j.days) == 0 || j.days[day.Weekday()] {
+			start := day.Add(j.offset)
+			if start.Add(j.Length()).After(after) {
+				return start
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+// OutputPath はジョブの出力ファイル名のテンプレートから出力ファイルのパスを決める。
+// テンプレートがない場合は通常の録音と同じ名前にする
+func (j Job) OutputPath(cfg *radiko.Config, stationID string, start time.Time) (string, error) {
+	outputFile, err := radiko.BuildOutputPath(cfg, stationID, "", start)
+	if err != nil || j.Output == "" {
+		return outputFile, err
+	}
+	rec := storage.Recording{StationID: stationID, Program: j.Name, Start: start, Duration: j.Length()}
+	name, err := storage.ExpandKey(j.Output, rec, outputFile)
+	if err != nil {
+		return "", err
+	}
+	return radiko.BuildOutputPath(cfg, stationID, filepath.FromSlash(name), start)
+}
+
+// Broadcast はジョブの1回の放送
+type Broadcast struct {
+	Job   Job
+	Start time.Time
+}
+
+// End は放送の終了時刻を返す
+func (b Broadcast) End() time.Time {
+	return b.Start.Add(b.Job.Length())
+}
+
+// ID は放送を区別する文字列（局ID_開始日時、日時は日本時間）を返す。
+// 局のエイリアスはResolveStationsで局IDにしておく
+func (b Broadcast) ID() string {
+	return strings.ToUpper(b.Job.Station) + "_" + b.Start.In(radiko.JST()).Format("20060102_1504")
+}
+
+// Due はsinceより後に終わり、nowの時点で終了からDelay分が過ぎている放送を開始時刻順に返す
+func (s *Schedule) Due(now, since time.Time) []Broadcast {
+	delay := time.Duration(s.Delay) * time.Minute
+	var due []Broadcast
+	for _, job := range s.Jobs {
+		for start := job.Next(since); !start.Add(job.Length() + delay).After(now); start = job.Next(start.Add(job.Length())) {
+			due = append(due, Broadcast{Job: job, Start: start})
+		}
+	}
+	sort.SliceStable(due, func(i, k int) bool { return due[i].Start.Before(due[k].Start) })
+	return due
+}
@@ -0,0 +1,227 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+func writeSchedule(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load(writeSchedule(t, `{
+  "jobs": [
+    {"name": "JUNK", "station": "TBS", "weekdays": ["Mon", "tue"], "time": "25:00", "duration": 120, "output": "{program}/{start}.mp3"}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Delay != DefaultDelay || s.RetryInterval != DefaultRetryInterval || s.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("defaults not applied: %+v", s)
+	}
+	job := s.Jobs[0]
+	if job.offset != 25*time.Hour || !job.days[time.Monday] || !job.days[time.Tuesday] || len(job.days) != 2 {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	for content, want := range map[string]string{
+		`{"jobs": []}`: "ジョブがありません",
+		`{"jobs": [{"time": "20:00", "duration": 60}]}`:                                           "station",
+		`{"jobs": [{"station": "TBS", "time": "20:00"}]}`:                                         "duration",
+		`{"jobs": [{"station": "TBS", "time": "30:00", "duration": 60}]}`:                         "HH:MM",
+		`{"jobs": [{"station": "TBS", "time": "8pm", "duration": 60}]}`:                           "HH:MM",
+		`{"jobs": [{"station": "TBS", "time": "20:00", "duration": 60, "weekdays": ["monday"]}]}`: "曜日",
+		`{"jobs": `: "形式",
+	} {
+		if _, err := Load(writeSchedule(t, content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load(%s) error = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestJobNext(t *testing.T) {
+	loc := radiko.JST()
+	at := func(day, hour, minute int) time.Time {
+		// 2025-06-09 は月曜日
+		return time.Date(2025, 6, day, hour, minute, 0, 0, loc)
+	}
+	job := Job{Station: "TBS", Weekdays: []string{"mon"}, Time: "25:00", Duration: 120}
+	if err := job.init(); err != nil {
+		t.Fatal(err)
+	}
+	daily := Job{Station: "TBS", Time: "20:00", Duration: 60}
+	if err := daily.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		job   Job
+		after time.Time
+		want  time.Time
+	}{
+		// 月曜 25:00 は火曜 1:00
+		{job, at(9, 12, 0), at(10, 1, 0)},
+		// 放送中はその回
+		{job, at(10, 2, 0), at(10, 1, 0)},
+		// 放送が終わった時点で翌週
+		{job, at(10, 3, 0), at(17, 1, 0)},
+		{daily, at(9, 20, 30), at(9, 20, 0)},
+		{daily, at(9, 21, 0), at(10, 20, 0)},
+	}
+	for _, tt := range tests {
+		if got := tt.job.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestRunner(t *testing.T) {
+	loc := radiko.JST()
+	now := time.Date(2025, 6, 9, 12, 0, 0, 0, loc)
+	s := &Schedule{
+		Delay:         5,
+		RetryInterval: 10,
+		MaxAttempts:   2,
+		Jobs: []Job{
+			{Name: "night", Station: "TBS", Time: "25:00", Duration: 120, Weekdays: []string{"mon"}},
+			{Name: "evening", Station: "LFR", Time: "20:00", Duration: 60},
+		},
+	}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type call struct {
+		job   string
+		start string
+		at    string
+	}
+	var calls []call
+	r := NewRunner(s, func(ctx context.Context, job Job, start time.Time) error {
+		calls = append(calls, call{job.Name, start.Format("01-02 15:04"), now.Format("01-02 15:04")})
+		if len(calls) == 5 {
+			cancel()
+		}
+		if job.Name == "night" {
+			return errors.New("タイムフリーでまだ聴けません")
+		}
+		return nil
+	}, radiko.NewLogger(false))
+	r.now = func() time.Time { return now }
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return nil
+	}
+
+	if err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v, want context.Canceled", err)
+	}
+	want := []call{
+		{"evening", "06-09 20:00", "06-09 21:05"},
+		{"night", "06-10 01:00", "06-10 03:05"},
+		// 失敗したため10分後に再試行し、上限の2回であきらめる
+		{"night", "06-10 01:00", "06-10 03:15"},
+		{"evening", "06-10 20:00", "06-10 21:05"},
+		{"evening", "06-11 20:00", "06-11 21:05"},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %v, want %v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	s, err := Parse([]byte(`{
+  "delay": 10,
+  "jobs": [
+    {"name": "night", "station": "TBS", "weekdays": ["mon"], "time": "25:00", "duration": 120},
+    {"name": "evening", "station": "LFR", "time": "20:00", "duration": 60}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := radiko.JST()
+	now := time.Date(2025, 6, 10, 21, 5, 0, 0, loc)
+	due := s.Due(now, now.Add(-25*time.Hour))
+
+	var got []string
+	for _, b := range due {
+		got = append(got, b.ID())
+	}
+	// 火曜 20:00 の回は終了から10分経っていないため含まない
+	want := []string{"LFR_20250609_2000", "TBS_20250610_0100"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Due() = %v, want %v", got, want)
+	}
+	if len(due) != 2 {
+		t.FailNow()
+	}
+	if end := due[1].End(); !end.Equal(time.Date(2025, 6, 10, 3, 0, 0, 0, loc)) {
+		t.Errorf("unexpected end: %s", end)
+	}
+}
+
+func TestJobOutputPath(t *testing.T) {
+	cfg := radiko.DefaultConfig()
+	cfg.DefaultOutputDir = t.TempDir()
+	start := time.Date(2025, 6, 10, 1, 0, 0, 0, radiko.JST())
+
+	job := Job{Name: "JUNK", Station: "TBS", Time: "25:00", Duration: 120}
+	got, err := job.OutputPath(cfg, "TBS", start)
+	if err != nil || got != filepath.Join(cfg.DefaultOutputDir, "TBS_20250610_0100.mp3") {
+		t.Errorf("default output = %s, %v", got, err)
+	}
+
+	job.Output = "{program}/{program}_{start}"
+	got, err = job.OutputPath(cfg, "TBS", start)
+	if err != nil || got != filepath.Join(cfg.DefaultOutputDir, "JUNK", "JUNK_20250610_0100.mp3") {
+		t.Errorf("template output = %s, %v", got, err)
+	}
+}
+
+func TestScheduleResolveStations(t *testing.T) {
+	s, err := Parse([]byte(`{
+  "jobs": [
+    {"name": "alias", "station": "Nippon", "time": "20:00", "duration": 60},
+    {"name": "lower", "station": "lfr", "time": "20:00", "duration": 60},
+    {"name": "upper", "station": "LFR", "time": "20:00", "duration": 60}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ResolveStations(radiko.DefaultConfig())
+
+	// 書き方が違っても同じ局の同じ放送は同じIDにする
+	start := time.Date(2025, 6, 9, 11, 0, 0, 0, time.UTC)
+	for _, job := range s.Jobs {
+		if job.Station != "LFR" {
+			t.Errorf("%s: station = %s, want LFR", job.Name, job.Station)
+		}
+		if id := (Broadcast{Job: job, Start: start}).ID(); id != "LFR_20250609_2000" {
+			t.Errorf("%s: ID() = %s", job.Name, id)
+		}
+	}
+}
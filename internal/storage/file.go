@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix は書き込み途中の一時ファイルの接頭辞
+const tempPrefix = ".upload-"
+
+// File はローカルディレクトリの保存先
+type File struct {
+	dir string
+}
+
+// NewFile はdirを保存先とするFileを返す
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+func (f *File) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+// Put は一時ファイルに書き込んでから置き換える（書き込み途中のファイルを読ませない）
+func (f *File) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *File) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, f.URL(key))
+	}
+	return file, err
+}
+
+func (f *File) Stat(ctx context.Context, key string) (Object, error) {
+	fi, err := os.Stat(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, f.URL(key))
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (f *File) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *File) List(ctx context.Context, dir string) ([]Object, error) {
+	entries, err := os.ReadDir(f.path(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), tempPrefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, Object{Key: joinKey(dir, e.Name()), Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	return objects, nil
+}
+
+func (f *File) Walk(ctx context.Context, dir string) ([]Object, error) {
+	root := f.path(dir)
+	var objects []Object
+	err := filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == root {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if e.IsDir() || strings.HasPrefix(e.Name(), tempPrefix) {
+			return nil
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: joinKey(dir, filepath.ToSlash(rel)), Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+func (f *File) URL(key string) string {
+	abs, err := filepath.Abs(f.path(key))
+	if err != nil {
+		abs = f.path(key)
+	}
+	return "file://" + filepath.ToSlash(abs)
+}
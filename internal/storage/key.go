@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+// Recording はアップロードする録音の情報（キーのテンプレートとメタデータに使う）
+type Recording struct {
+	StationID string
+	// Program は番組名
+	Program  string
+	Start    time.Time
+	Duration time.Duration
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// ExpandKey はキーのテンプレートに録音の情報を埋め込んで保存先のキーを返す。
+// テンプレートが空の場合は録音ファイル名をそのまま使う。
+//
+//	{station}  局ID
+//	{program}  番組名（"/" などは "_" に置き換える）
+//	{yyyy} {mm} {dd} {hh} {mi}  開始日時
+//	{date}     開始日（20060102）
+//	{start}    開始日時（20060102_1504）
+//	{file}     録音ファイル名（拡張子なし）
+//	{ext}      録音ファイルの拡張子（"." なし）
+//
+// 展開したキーに音声の拡張子がなければ録音ファイルの拡張子を付ける
+func ExpandKey(tmpl string, rec Recording, file string) (string, error) {
+	base := filepath.Base(file)
+	if tmpl == "" {
+		return base, nil
+	}
+	ext := filepath.Ext(base)
+	program := rec.Program
+	if program == "" {
+		program = rec.StationID
+	}
+	values := map[string]string{
+		"station": rec.StationID,
+		"program": program,
+		"yyyy":    rec.Start.Format("2006"),
+		"mm":      rec.Start.Format("01"),
+		"dd":      rec.Start.Format("02"),
+		"hh":      rec.Start.Format("15"),
+		"mi":      rec.Start.Format("04"),
+		"date":    rec.Start.Format("20060102"),
+		"start":   rec.Start.Format("20060102_1504"),
+		"file":    strings.TrimSuffix(base, ext),
+		"ext":     strings.TrimPrefix(ext, "."),
+	}
+
+	var unknown []string
+	key := placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		v, ok := values[name]
+		if !ok {
+			unknown = append(unknown, m)
+			return m
+		}
+		return keySegment(v)
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("キーのテンプレートに不明な項目があります: %s", strings.Join(unknown, ", "))
+	}
+
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if key == "" {
+		return "", fmt.Errorf("キーのテンプレートからキーを作れません: %s", tmpl)
+	}
+	if _, ok := radiko.FormatForPath(key); !ok {
+		key += ext
+	}
+	return key, nil
+}
+
+// ValidateKeyTemplate はキーのテンプレートに不明な項目がないかを確認する
+func ValidateKeyTemplate(tmpl string) error {
+	_, err := ExpandKey(tmpl, Recording{StationID: "TBS", Start: time.Now()}, "show.mp3")
+	return err
+}
+
+// keySegment はキーに埋め込む値からパスの区切りや制御文字を取り除く
+func keySegment(v string) string {
+	v = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(v))
+	if v == "" || v == "." || v == ".." {
+		return "_"
+	}
+	return v
+}
+
+// RecordingTarget は設定のキーのテンプレートと番組のタグ情報から、録音の保存先のキーとアップロード時の付加情報を決める。
+// アップロードと録音済みかの確認で同じキーになるよう、どちらもこの関数を使う
+func RecordingTarget(cfg *radiko.Config, md radiko.Metadata, p radiko.Program, file string) (string, PutOptions, error) {
+	rec := Recording{
+		StationID: p.StationID,
+		Program:   md.Album,
+		Start:     p.Start,
+		Duration:  p.End.Sub(p.Start),
+	}
+	key, err := ExpandKey(cfg.UploadKey, rec, file)
+	if err != nil {
+		return "", PutOptions{}, err
+	}
+	return key, RecordingOptions(cfg, rec, file), nil
+}
+
+// RecordingOptions は設定と録音の情報からアップロード時の付加情報を作る。
+// Content-Typeは設定の形式ごとの指定を優先し、なければ拡張子から決める
+func RecordingOptions(cfg *radiko.Config, rec Recording, file string) PutOptions {
+	contentType := ContentType(file)
+	if f, ok := radiko.FormatForPath(file); ok && cfg.ContentTypes[f.Name] != "" {
+		contentType = cfg.ContentTypes[f.Name]
+	}
+	metadata := map[string]string{
+		"station":  rec.StationID,
+		"start":    rec.Start.Format(time.RFC3339),
+		"duration": strconv.Itoa(int(rec.Duration / time.Second)),
+	}
+	if rec.Program != "" {
+		metadata["program"] = rec.Program
+	}
+	return PutOptions{
+		ContentType:  contentType,
+		Metadata:     metadata,
+		Tags:         cfg.UploadTags,
+		StorageClass: cfg.StorageClass,
+		KMSKeyID:     cfg.KMSKeyID,
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+func TestExpandKey(t *testing.T) {
+	rec := Recording{
+		StationID: "TBS",
+		Program:   "ジャンク/深夜",
+		Start:     time.Date(2025, 6, 8, 1, 0, 0, 0, time.FixedZone("JST", 9*60*60)),
+		Duration:  2 * time.Hour,
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"", "TBS_20250608_0100.mp3"},
+		{"{station}/{yyyy}/{mm}/{program}_{start}.mp3", "TBS/2025/06/ジャンク_深夜_20250608_0100.mp3"},
+		{"{station}/{date}/{hh}{mi}", "TBS/20250608/0100.mp3"},
+		{"/archive/{file}.{ext}", "archive/TBS_20250608_0100.mp3"},
+		{"../{station}/{file}", "TBS/TBS_20250608_0100.mp3"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandKey(tt.tmpl, rec, "/tmp/radiko/TBS_20250608_0100.mp3")
+		if err != nil {
+			t.Errorf("ExpandKey(%q) error: %v", tt.tmpl, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandKey(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+
+	rec.Program = ""
+	if got, _ := ExpandKey("{program}/{start}", rec, "show.opus"); got != "TBS/20250608_0100.opus" {
+		t.Errorf("program should fall back to station: %q", got)
+	}
+	if _, err := ExpandKey("{station}/{year}", rec, "show.mp3"); err == nil {
+		t.Error("expected error for unknown placeholder")
+	}
+	if err := ValidateKeyTemplate("{station}/{title}"); err == nil {
+		t.Error("expected validation error")
+	}
+}
+
+func TestRecordingOptions(t *testing.T) {
+	cfg := radiko.DefaultConfig()
+	cfg.ContentTypes = map[string]string{"opus": "audio/opus"}
+	cfg.UploadTags = map[string]string{"project": "radio"}
+	cfg.StorageClass = "STANDARD_IA"
+	cfg.KMSKeyID = "alias/radio"
+	rec := Recording{StationID: "TBS", Program: "番組", Start: time.Date(2025, 6, 8, 20, 0, 0, 0, time.UTC), Duration: time.Hour}
+
+	opts := RecordingOptions(cfg, rec, "show.opus")
+	if opts.ContentType != "audio/opus" {
+		t.Errorf("content type override not applied: %s", opts.ContentType)
+	}
+	if opts.Metadata["station"] != "TBS" || opts.Metadata["program"] != "番組" ||
+		opts.Metadata["start"] != "2025-06-08T20:00:00Z" || opts.Metadata["duration"] != "3600" {
+		t.Errorf("unexpected metadata: %v", opts.Metadata)
+	}
+	if opts.Tags["project"] != "radio" || opts.StorageClass != "STANDARD_IA" || opts.KMSKeyID != "alias/radio" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+
+	if opts := RecordingOptions(cfg, rec, "show.mp3"); opts.ContentType != "audio/mpeg" {
+		t.Errorf("default content type expected, got %s", opts.ContentType)
+	}
+}
+
+func TestRecordingTarget(t *testing.T) {
+	cfg := radiko.DefaultConfig()
+	cfg.UploadKey = "{station}/{yyyy}/{mm}/{program}_{start}"
+	cfg.StorageClass = "GLACIER_IR"
+	start := time.Date(2025, 6, 8, 20, 0, 0, 0, radiko.JST())
+	p := radiko.Program{StationID: "TBS", Title: "アフター6ジャンクション", Start: start, End: start.Add(time.Hour)}
+
+	key, opts, err := RecordingTarget(cfg, radiko.NewMetadata(p), p, "/tmp/radiko/TBS_20250608_2000.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "TBS/2025/06/アフター6ジャンクション_20250608_2000.mp3" {
+		t.Errorf("unexpected key: %s", key)
+	}
+	if opts.ContentType != "audio/mpeg" || opts.StorageClass != "GLACIER_IR" || opts.Metadata["duration"] != "3600" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+}
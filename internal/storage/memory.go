@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory はメモリ上の保存先（テスト用）
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	opts    PutOptions
+	modTime time.Time
+}
+
+// NewMemory は空のMemoryを返す
+func NewMemory() *Memory {
+	return &Memory{objects: map[string]memoryObject{}}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{data: data, opts: opts, modTime: time.Now()}
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, _, ok := m.Object(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, m.URL(key))
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, m.URL(key))
+	}
+	return Object{Key: key, Size: int64(len(o.data)), ModTime: o.modTime}, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, dir string) ([]Object, error) {
+	return m.list(dir, false), nil
+}
+
+func (m *Memory) Walk(ctx context.Context, dir string) ([]Object, error) {
+	return m.list(dir, true), nil
+}
+
+// list はdirの直下（recursiveならサブディレクトリも含む）のファイルを返す
+func (m *Memory) list(dir string, recursive bool) []Object {
+	prefix := dirPrefix(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var objects []Object
+	for key, o := range m.objects {
+		name, ok := strings.CutPrefix(key, prefix)
+		if !ok || (!recursive && strings.Contains(name, "/")) {
+			continue
+		}
+		objects = append(objects, Object{Key: key, Size: int64(len(o.data)), ModTime: o.modTime})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects
+}
+
+func (m *Memory) URL(key string) string {
+	return "mem://" + key
+}
+
+// Object は保存された内容と付加情報を返す
+func (m *Memory) Object(key string) ([]byte, PutOptions, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, PutOptions{}, false
+	}
+	return bytes.Clone(o.data), o.opts, true
+}
+
+// Keys は保存されているすべてのキーを返す
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
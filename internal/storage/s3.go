@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// gcsEndpoint はGCSのS3互換（XML API）のエンドポイント
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// s3PartSize はマルチパートアップロードの1パートの大きさ（最後以外のパートは5MiB以上が必要）
+var s3PartSize = 8 << 20
+
+// S3 はS3（またはS3互換）のバケットの保存先
+type S3 struct {
+	client *s3.Client
+	scheme string
+	bucket string
+	// prefix はバケット内の保存先（空文字または "/" で終わる）
+	prefix string
+	// gcs はGCSのS3互換APIか（チェックサム、タグ、SSE-KMSは使えない）
+	gcs bool
+}
+
+// newS3 はs3://bucket/prefix または gs://bucket/prefix のURLからS3を作る。
+// クエリのendpointを指定するとパス形式でアクセスする（MinIOやLocalStack向け）
+func newS3(ctx context.Context, u *url.URL, gcs bool) (*S3, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("保存先のURLにバケット名がありません: %s", u.Redacted())
+	}
+	q := u.Query()
+	endpoint := q.Get("endpoint")
+	region := q.Get("region")
+
+	var opts []func(*config.LoadOptions) error
+	if gcs {
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+		if region == "" {
+			region = "auto"
+		}
+		// GCSはHMACキーで認証する
+		if id := os.Getenv("GCS_ACCESS_KEY_ID"); id != "" {
+			secret := os.Getenv("GCS_SECRET_ACCESS_KEY")
+			opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(id, secret, "")))
+		}
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("AWSの設定読み込みに失敗: %w", err)
+	}
+	if cfg.Region == "" && endpoint != "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = q.Get("path_style") != "false"
+		}
+		if gcs {
+			// GCSは新しいチェックサムのヘッダーに対応していない
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	})
+
+	return &S3{
+		client: client,
+		scheme: u.Scheme,
+		bucket: u.Host,
+		prefix: dirPrefix(u.Path),
+		gcs:    gcs,
+	}, nil
+}
+
+// Put はファイルなど読み直せる内容はそのまま、ストリームはマルチパートアップロードで保存する
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	if s.gcs && (len(opts.Tags) > 0 || opts.KMSKeyID != "") {
+		return fmt.Errorf("GCSの保存先ではタグとSSE-KMSを指定できません")
+	}
+	if _, ok := r.(io.Seeker); !ok {
+		return s.putMultipart(ctx, key, r, opts)
+	}
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.prefix + key),
+		Body:     r,
+		Metadata: encodeMetadata(opts.Metadata),
+		Tagging:  tagging(opts.Tags),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+	if opts.KMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+	}
+	_, err := s.client.PutObject(ctx, input)
+	return err
+}
+
+// encodeMetadata はASCII以外を含むメタデータの値をRFC 2047の形式にする（HTTPヘッダーで送るため）
+func encodeMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	encoded := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		encoded[k] = mime.BEncoding.Encode("UTF-8", v)
+	}
+	return encoded
+}
+
+// tagging はタグをx-amz-taggingヘッダーの形式（URLのクエリ形式）にする
+func tagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return aws.String(values.Encode())
+}
+
+// putMultipart は長さのわからないストリームをパートに分けてアップロードする。
+// メモリに保持するのは1パート分だけで、失敗した場合はアップロードを中止する
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s.prefix + key),
+		Metadata: encodeMetadata(opts.Metadata),
+		Tagging:  tagging(opts.Tags),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+	if opts.KMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(opts.KMSKeyID)
+	}
+	if !s.gcs {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+	created, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	err = s.uploadParts(ctx, key, created.UploadId, r)
+	if err != nil {
+		// キャンセルされた場合も中止のリクエストは送る
+		if _, abortErr := s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(s.prefix + key),
+			UploadId: created.UploadId,
+		}); abortErr != nil {
+			return fmt.Errorf("%w (アップロードの中止にも失敗: %v)", err, abortErr)
+		}
+	}
+	return err
+}
+
+// uploadParts はrの内容をパートごとにアップロードして完了させる
+func (s *S3) uploadParts(ctx context.Context, key string, uploadID *string, r io.Reader) error {
+	var parts []types.CompletedPart
+	buf := make([]byte, s3PartSize)
+	for number := int32(1); ; number++ {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+		// 空のストリームでもパートが1つは必要
+		if n > 0 || number == 1 {
+			input := &s3.UploadPartInput{
+				Bucket:     aws.String(s.bucket),
+				Key:        aws.String(s.prefix + key),
+				UploadId:   uploadID,
+				PartNumber: aws.Int32(number),
+				Body:       bytes.NewReader(buf[:n]),
+			}
+			if !s.gcs {
+				input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+			}
+			out, err := s.client.UploadPart(ctx, input)
+			if err != nil {
+				return fmt.Errorf("パート%dのアップロードに失敗: %w", number, err)
+			}
+			parts = append(parts, types.CompletedPart{
+				ETag:          out.ETag,
+				PartNumber:    aws.Int32(number),
+				ChecksumCRC32: out.ChecksumCRC32,
+			})
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(s.prefix + key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		var notFound *types.NoSuchKey
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, s.URL(key))
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Stat はHeadObjectでオブジェクトの情報を取得する
+func (s *S3) Stat(ctx context.Context, key string) (Object, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return Object{}, fmt.Errorf("%w: %s", ErrNotFound, s.URL(key))
+		}
+		return Object{}, err
+	}
+	return Object{Key: key, Size: aws.ToInt64(out.ContentLength), ModTime: aws.ToTime(out.LastModified)}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	return err
+}
+
+// List はdirの直下のオブジェクトを返す（さらに下のプレフィックスは含めない）
+func (s *S3) List(ctx context.Context, dir string) ([]Object, error) {
+	return s.list(ctx, dir, aws.String("/"))
+}
+
+// Walk は区切り文字を指定せずに一覧を取得し、サブディレクトリ（プレフィックス）の中も返す
+func (s *S3) Walk(ctx context.Context, dir string) ([]Object, error) {
+	return s.list(ctx, dir, nil)
+}
+
+func (s *S3) list(ctx context.Context, dir string, delimiter *string) ([]Object, error) {
+	var objects []Object
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(s.prefix + dirPrefix(dir)),
+		Delimiter: delimiter,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			objects = append(objects, Object{
+				Key:     strings.TrimPrefix(aws.ToString(o.Key), s.prefix),
+				Size:    aws.ToInt64(o.Size),
+				ModTime: aws.ToTime(o.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3) URL(key string) string {
+	return s.scheme + "://" + s.bucket + "/" + s.prefix + key
+}
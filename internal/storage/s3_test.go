@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 はアップロードとHEADだけに対応したテスト用のS3互換サーバー
+type fakeS3 struct {
+	mu      sync.Mutex
+	parts   map[int]string
+	objects map[string]string
+	types   map[string]string
+	// headers は最後に受け取ったオブジェクト作成リクエストのヘッダー
+	headers http.Header
+	aborted bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.parts = map[int]string{}
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		f.headers = r.Header.Clone()
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Get("uploadId") == "upload-1":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		data, _ := io.ReadAll(r.Body)
+		f.parts[n] = string(data)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && q.Get("uploadId") == "upload-1":
+		var numbers []int
+		for n := range f.parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var b strings.Builder
+		for _, n := range numbers {
+			b.WriteString(f.parts[n])
+		}
+		f.objects[r.URL.Path] = b.String()
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut && !q.Has("uploadId"):
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(data)
+		f.headers = r.Header.Clone()
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	case r.Method == http.MethodDelete && q.Get("uploadId") == "upload-1":
+		f.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func openFakeS3(t *testing.T) (*fakeS3, Storage) {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+
+	fake := &fakeS3{objects: map[string]string{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	st, err := Open(context.Background(), "s3://radio/rec?endpoint="+server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partSize := s3PartSize
+	s3PartSize = 4
+	t.Cleanup(func() { s3PartSize = partSize })
+	return fake, st
+}
+
+func TestS3_StreamMultipart(t *testing.T) {
+	fake, st := openFakeS3(t)
+
+	err := Stream(context.Background(), st, "show.mp3", PutOptions{ContentType: "audio/mpeg"}, func(w io.Writer) error {
+		for _, chunk := range []string{"0123", "45", "6789"} {
+			if _, err := io.WriteString(w, chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := fake.objects["/radio/rec/show.mp3"]; got != "0123456789" {
+		t.Errorf("uploaded %q", got)
+	}
+	if len(fake.parts) != 3 || fake.parts[3] != "89" {
+		t.Errorf("unexpected parts: %v", fake.parts)
+	}
+	if got := fake.types["/radio/rec/show.mp3"]; got != "audio/mpeg" {
+		t.Errorf("content type = %q", got)
+	}
+}
+
+func TestS3_Exists(t *testing.T) {
+	fake, st := openFakeS3(t)
+	fake.objects["/radio/rec/TBS/show.mp3"] = "audio"
+
+	ctx := context.Background()
+	if o, err := st.Stat(ctx, "TBS/show.mp3"); err != nil || o.Size != 5 {
+		t.Errorf("Stat = %+v, %v", o, err)
+	}
+	if _, err := st.Stat(ctx, "TBS/missing.mp3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if ok, err := Exists(ctx, st, "TBS/show.mp3"); err != nil || !ok {
+		t.Errorf("Exists = %v, %v", ok, err)
+	}
+}
+
+func TestS3_StreamAborted(t *testing.T) {
+	fake, st := openFakeS3(t)
+
+	recordErr := errors.New("録音に失敗")
+	err := Stream(context.Background(), st, "show.mp3", PutOptions{}, func(w io.Writer) error {
+		io.WriteString(w, "0123456789")
+		return recordErr
+	})
+	if !errors.Is(err, recordErr) {
+		t.Fatalf("expected the recording error, got %v", err)
+	}
+	if !fake.aborted {
+		t.Error("multipart upload should be aborted")
+	}
+	if _, ok := fake.objects["/radio/rec/show.mp3"]; ok {
+		t.Error("no object should be created")
+	}
+}
+
+func TestStream_Memory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	err := Stream(ctx, m, "show.aac", PutOptions{ContentType: "audio/aac"}, func(w io.Writer) error {
+		_, err := io.WriteString(w, "adts")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, opts, _ := m.Object("show.aac"); string(data) != "adts" || opts.ContentType != "audio/aac" {
+		t.Errorf("unexpected object: %q, %+v", data, opts)
+	}
+
+	err = Stream(ctx, m, "failed.aac", PutOptions{}, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("中断")
+	})
+	if err == nil {
+		t.Error("expected error")
+	}
+	if _, _, ok := m.Object("failed.aac"); ok {
+		t.Error("partial stream should not be stored")
+	}
+}
+
+func TestS3_PutOptions(t *testing.T) {
+	opts := PutOptions{
+		ContentType:  "audio/mpeg",
+		Metadata:     map[string]string{"station": "TBS", "program": "番組"},
+		Tags:         map[string]string{"project": "radio"},
+		StorageClass: "STANDARD_IA",
+		KMSKeyID:     "alias/radio",
+	}
+	check := func(t *testing.T, h http.Header) {
+		t.Helper()
+		if h.Get("X-Amz-Meta-Station") != "TBS" {
+			t.Errorf("metadata missing: %v", h)
+		}
+		if got := h.Get("X-Amz-Meta-Program"); got != mime.BEncoding.Encode("UTF-8", "番組") {
+			t.Errorf("non-ASCII metadata should be encoded: %q", got)
+		}
+		if h.Get("X-Amz-Tagging") != "project=radio" || h.Get("X-Amz-Storage-Class") != "STANDARD_IA" {
+			t.Errorf("tagging or storage class missing: %v", h)
+		}
+		if h.Get("X-Amz-Server-Side-Encryption") != "aws:kms" || h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != "alias/radio" {
+			t.Errorf("SSE-KMS headers missing: %v", h)
+		}
+	}
+
+	t.Run("PutObject", func(t *testing.T) {
+		fake, st := openFakeS3(t)
+		if err := st.Put(context.Background(), "show.mp3", strings.NewReader("mp3"), opts); err != nil {
+			t.Fatal(err)
+		}
+		check(t, fake.headers)
+	})
+	t.Run("Multipart", func(t *testing.T) {
+		fake, st := openFakeS3(t)
+		err := Stream(context.Background(), st, "show.mp3", opts, func(w io.Writer) error {
+			_, err := io.WriteString(w, "mp3")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, fake.headers)
+	})
+}
+
+func TestGCS_UnsupportedOptions(t *testing.T) {
+	t.Setenv("GCS_ACCESS_KEY_ID", "test")
+	t.Setenv("GCS_SECRET_ACCESS_KEY", "test")
+	st, err := Open(context.Background(), "gs://radio/rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Put(context.Background(), "show.mp3", strings.NewReader("mp3"), PutOptions{KMSKeyID: "alias/radio"})
+	if err == nil || !strings.Contains(err.Error(), "GCS") {
+		t.Errorf("expected GCS option error, got %v", err)
+	}
+}
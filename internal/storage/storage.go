@@ -0,0 +1,216 @@
+// Package storage は録音ファイルの保存先（ローカル、S3、GCS、WebDAV）を扱う
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+// ErrNotFound は保存先に指定したファイルがない場合のエラー
+var ErrNotFound = errors.New("ファイルが見つかりません")
+
+// Object は保存先にあるファイル
+type Object struct {
+	// Key は保存先の中でのパス（区切りは "/"）
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// PutOptions はファイルを保存するときの付加情報。
+// ContentType以外はS3とGCSの保存先でのみ使われ、その他の保存先では無視される
+type PutOptions struct {
+	ContentType string
+	// Metadata はオブジェクトのユーザー定義メタデータ
+	Metadata map[string]string
+	// Tags はオブジェクトのタグ（S3のみ）
+	Tags map[string]string
+	// StorageClass はストレージクラス（STANDARD_IA など）
+	StorageClass string
+	// KMSKeyID を指定するとSSE-KMSで暗号化する（S3のみ）
+	KMSKeyID string
+}
+
+// Storage は録音ファイルの保存先
+type Storage interface {
+	// Put はrの内容をkeyに保存する
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get はkeyの内容を返す。ない場合はErrNotFoundを返す
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat はkeyのファイルの情報を返す。ない場合はErrNotFoundを返す
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete はkeyを削除する。ない場合もエラーにしない
+	Delete(ctx context.Context, key string) error
+	// List はdirの直下にあるファイルの一覧を返す（dirが空文字なら保存先の直下）
+	List(ctx context.Context, dir string) ([]Object, error)
+	// Walk はdir以下のサブディレクトリも含めたすべてのファイルの一覧を返す
+	Walk(ctx context.Context, dir string) ([]Object, error)
+	// URL はkeyの場所を表すURLを返す（ログ表示用）
+	URL(key string) string
+}
+
+// Open はURLのスキームに対応する保存先を返す。
+//
+//	file:///path/to/dir または /path/to/dir    ローカルディレクトリ
+//	s3://bucket/prefix?endpoint=...&region=...   S3（MinIOやLocalStackはendpointを指定）
+//	gs://bucket/prefix                           GCS（XML APIとHMACキー）
+//	webdav://host/path, webdav+http://host/path  WebDAV（https / http）
+func Open(ctx context.Context, rawURL string) (Storage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("保存先のURLが正しくありません: %w", err)
+	}
+
+	switch u.Scheme {
+	case "":
+		return NewFile(rawURL), nil
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("保存先のURLが正しくありません: %s (file:///path の形式で指定してください)", rawURL)
+		}
+		return NewFile(filepath.FromSlash(u.Path)), nil
+	case "s3":
+		return newS3(ctx, u, false)
+	case "gs":
+		return newS3(ctx, u, true)
+	case "webdav", "webdav+http":
+		return newWebDAV(u)
+	}
+	if len(u.Scheme) == 1 {
+		// Windowsのドライブ文字（C:\...）
+		return NewFile(rawURL), nil
+	}
+	return nil, fmt.Errorf("未対応の保存先です: %s (file, s3, gs, webdav)", rawURL)
+}
+
+// UploadFile はローカルのファイルを保存先のkeyにアップロードする。
+// opts.ContentTypeが空の場合はファイルの拡張子から決める
+func UploadFile(ctx context.Context, st Storage, key, path string, opts PutOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.ContentType == "" {
+		opts.ContentType = ContentType(path)
+	}
+	if err := st.Put(ctx, key, f, opts); err != nil {
+		return fmt.Errorf("%s へのアップロードに失敗: %w", st.URL(key), err)
+	}
+	return nil
+}
+
+// Stream はwriteが書き込んだ内容をローカルにファイルを作らずに保存先のkeyへ書き込む。
+// writeがエラーを返した場合は保存を中止し、途中までの内容は残さない
+func Stream(ctx context.Context, st Storage, key string, opts PutOptions, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := st.Put(ctx, key, pr, opts)
+		if err != nil {
+			// 書き込み側を止める
+			pr.CloseWithError(fmt.Errorf("%s へのアップロードに失敗: %w", st.URL(key), err))
+		} else {
+			pr.Close()
+		}
+		done <- err
+	}()
+
+	writeErr := write(pw)
+	// writeErrがnilなら保存先にはEOFとして伝わる
+	pw.CloseWithError(writeErr)
+	putErr := <-done
+
+	switch {
+	case writeErr != nil && putErr != nil && !errors.Is(putErr, writeErr):
+		return fmt.Errorf("%w (アップロード: %v)", writeErr, putErr)
+	case writeErr != nil:
+		return writeErr
+	case putErr != nil:
+		return fmt.Errorf("%s へのアップロードに失敗: %w", st.URL(key), putErr)
+	}
+	return nil
+}
+
+// DownloadFile は保存先のkeyをローカルのファイルにダウンロードする
+func DownloadFile(ctx context.Context, st Storage, key, path string) error {
+	r, err := st.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("%s のダウンロードに失敗: %w", st.URL(key), err)
+	}
+	return f.Close()
+}
+
+// ReadAll は保存先のkeyの内容をすべて読み込む
+func ReadAll(ctx context.Context, st Storage, key string) ([]byte, error) {
+	r, err := st.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Exists は保存先にkeyのファイルがあるかを返す
+func Exists(ctx context.Context, st Storage, key string) (bool, error) {
+	_, err := st.Stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ContentType はファイルの拡張子に対応するContent-Typeを返す
+func ContentType(path string) string {
+	if f, ok := radiko.FormatForPath(path); ok {
+		return f.ContentType
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return "application/rss+xml"
+	case ".json":
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
+
+// joinKey は保存先の中のディレクトリとファイル名をつなぐ
+func joinKey(dir, name string) string {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// dirPrefix はList用にディレクトリ名の末尾に "/" を付ける（空文字はそのまま）
+func dirPrefix(dir string) string {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+
+	"go-radio/internal/radiko"
+)
+
+// TokenCache は認証トークンを保存先のkeyに置くradiko.TokenCache。
+// Lambdaのように実行ごとにファイルが消える環境で、呼び出しをまたいでトークンを使い回す
+type TokenCache struct {
+	st  Storage
+	key string
+}
+
+// NewTokenCache は保存先stのkeyに認証トークンを保存するTokenCacheを作成
+func NewTokenCache(st Storage, key string) *TokenCache {
+	return &TokenCache{st: st, key: key}
+}
+
+// OpenTokenCache はファイルのURL（s3://bucket/radiko/token.json など）にトークンを保存するTokenCacheを作成
+func OpenTokenCache(ctx context.Context, rawURL string) (*TokenCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("トークンの保存先のURLが正しくありません: %w", err)
+	}
+	dir, name := path.Split(u.Path)
+	if name == "" {
+		return nil, fmt.Errorf("トークンの保存先にはファイル名まで指定してください: %s", rawURL)
+	}
+	u.Path = dir
+	st, err := Open(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenCache(st, name), nil
+}
+
+// LoadToken は保存した認証トークンを読み込む。まだない場合はos.ErrNotExistを返す
+func (c *TokenCache) LoadToken(ctx context.Context) (radiko.CachedToken, error) {
+	var t radiko.CachedToken
+	data, err := ReadAll(ctx, c.st, c.key)
+	if errors.Is(err, ErrNotFound) {
+		return t, os.ErrNotExist
+	}
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
+
+// SaveToken は認証トークンを保存する
+func (c *TokenCache) SaveToken(ctx context.Context, t radiko.CachedToken) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return c.st.Put(ctx, c.key, bytes.NewReader(data), PutOptions{ContentType: "application/json"})
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// propfindBody はList で取得するプロパティ
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+// WebDAV はWebDAVサーバーの保存先
+type WebDAV struct {
+	client   *http.Client
+	base     *url.URL
+	username string
+	password string
+
+	// collections は作成済みのコレクション（ディレクトリ）
+	collections sync.Map
+}
+
+// newWebDAV はwebdav://host/path（https）または webdav+http://host/path のURLからWebDAVを作る。
+// 認証情報はURLまたは環境変数 WEBDAV_USERNAME / WEBDAV_PASSWORD で指定する
+func newWebDAV(u *url.URL) (*WebDAV, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("保存先のURLにホスト名がありません: %s", u.Redacted())
+	}
+	base := *u
+	base.Scheme = "https"
+	if u.Scheme == "webdav+http" {
+		base.Scheme = "http"
+	}
+	base.User = nil
+	base.RawQuery = ""
+	base.Path = "/" + dirPrefix(u.Path)
+	base.RawPath = ""
+
+	w := &WebDAV{
+		client:   http.DefaultClient,
+		base:     &base,
+		username: os.Getenv("WEBDAV_USERNAME"),
+		password: os.Getenv("WEBDAV_PASSWORD"),
+	}
+	if u.User != nil {
+		w.username = u.User.Username()
+		w.password, _ = u.User.Password()
+	}
+	return w, nil
+}
+
+// do はkeyに対してリクエストを送る
+func (w *WebDAV) do(ctx context.Context, method, key string, body io.Reader, header http.Header) (*http.Response, error) {
+	u := *w.base
+	u.Path = path.Join(u.Path, key)
+	if strings.HasSuffix(key, "/") || key == "" {
+		u.Path += "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(req)
+}
+
+// mkcol はkeyの親のコレクションを作成する（既にある場合はそのまま）
+func (w *WebDAV) mkcol(ctx context.Context, key string) error {
+	dir := ""
+	for _, name := range strings.Split(path.Dir(key), "/") {
+		if name == "." || name == "" {
+			continue
+		}
+		dir += name + "/"
+		if _, ok := w.collections.Load(dir); ok {
+			continue
+		}
+		resp, err := w.do(ctx, "MKCOL", dir, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 405 は既に存在する場合
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("WebDAVのディレクトリ作成に失敗: %s (%s)", dir, resp.Status)
+		}
+		w.collections.Store(dir, true)
+	}
+	return nil
+}
+
+func (w *WebDAV) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	if err := w.mkcol(ctx, key); err != nil {
+		return err
+	}
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	resp, err := w.do(ctx, http.MethodPut, key, r, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("WebDAVへのアップロードに失敗: %s (%s)", w.URL(key), resp.Status)
+	}
+	return nil
+}
+
+func (w *WebDAV) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := w.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, w.URL(key))
+	case resp.StatusCode/100 != 2:
+		resp.Body.Close()
+		return nil, fmt.Errorf("WebDAVからのダウンロードに失敗: %s (%s)", w.URL(key), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Stat はHEADリクエストでファイルの大きさと更新日時を取得する
+func (w *WebDAV) Stat(ctx context.Context, key string) (Object, error) {
+	resp, err := w.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Object{}, fmt.Errorf("%w: %s", ErrNotFound, w.URL(key))
+	case resp.StatusCode/100 != 2:
+		return Object{}, fmt.Errorf("WebDAVのファイル情報取得に失敗: %s (%s)", w.URL(key), resp.Status)
+	}
+	obj := Object{Key: key, Size: resp.ContentLength}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = t
+	}
+	return obj, nil
+}
+
+func (w *WebDAV) Delete(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("WebDAVのファイル削除に失敗: %s (%s)", w.URL(key), resp.Status)
+	}
+	return nil
+}
+
+// multistatus はPROPFINDのレスポンス
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// List はPROPFIND（Depth: 1）でdirの直下のファイルを返す
+func (w *WebDAV) List(ctx context.Context, dir string) ([]Object, error) {
+	objects, _, err := w.propfind(ctx, dir)
+	return objects, err
+}
+
+// Walk はサブディレクトリを1階層ずつたどる（Depth: infinity は多くのサーバーで無効なため）
+func (w *WebDAV) Walk(ctx context.Context, dir string) ([]Object, error) {
+	objects, dirs, err := w.propfind(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range dirs {
+		children, err := w.Walk(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, children...)
+	}
+	return objects, nil
+}
+
+// propfind はdirの直下のファイルとサブディレクトリを返す
+func (w *WebDAV) propfind(ctx context.Context, dir string) ([]Object, []string, error) {
+	header := http.Header{}
+	header.Set("Depth", "1")
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := w.do(ctx, "PROPFIND", dirPrefix(dir), strings.NewReader(propfindBody), header)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, nil, fmt.Errorf("WebDAVのファイル一覧取得に失敗: %s (%s)", w.URL(dir), resp.Status)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, nil, fmt.Errorf("WebDAVのファイル一覧の解析に失敗: %w", err)
+	}
+
+	var objects []Object
+	var dirs []string
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		key, ok := strings.CutPrefix(href.Path, w.base.Path)
+		if !ok || key == "" {
+			continue
+		}
+		obj := Object{Key: key}
+		collection := false
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				collection = true
+			}
+			obj.Size = ps.Prop.ContentLength
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				obj.ModTime = t
+			}
+		}
+		if collection || strings.HasSuffix(key, "/") {
+			// 直下のサブディレクトリだけをたどる（dir自身は除く）
+			sub := strings.TrimSuffix(key, "/")
+			if name, ok := strings.CutPrefix(sub, dirPrefix(dir)); ok && name != "" && !strings.Contains(name, "/") {
+				dirs = append(dirs, sub)
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, dirs, nil
+}
+
+func (w *WebDAV) URL(key string) string {
+	u := *w.base
+	u.Path = path.Join(u.Path, key)
+	return u.String()
+}
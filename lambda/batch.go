@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-radio/internal/batch"
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// handleBatch はイベントのrecordingsの番組を1回の認証でまとめて録音し、1件ごとの結果をJSONで返す。
+// 一部が失敗しても結果を返し、すべて失敗した場合だけエラーにする
+func handleBatch(ctx, recCtx context.Context, e Event, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, lib *library.Library) (string, error) {
+	if err := client.AuthContext(recCtx); err != nil {
+		return "", fmt.Errorf("クライアント初期化に失敗: %w", err)
+	}
+
+	logger.Info("%d件の番組をまとめて録音します（同時に%d件）", len(e.Recordings), batchConcurrency(config))
+	results := batch.Run(recCtx, e.Recordings, config.BatchConcurrency, func(recCtx context.Context, item batch.Item) (string, error) {
+		program, err := item.Program(config)
+		if err != nil {
+			return "", err
+		}
+		return recordTimeFree(ctx, recCtx, e, config, client, logger, st, lib, program, item.Output)
+	})
+	return batchReport(logger, results)
+}
+
+// batchReport は結果をログに出力し、JSONの報告を返す
+func batchReport(logger *radiko.Logger, results []batch.Result) (string, error) {
+	for _, r := range results {
+		if r.OK() {
+			logger.Info("[成功] %s %s: %s", r.Station, r.Start, r.Result)
+		} else {
+			logger.Error("[失敗] %s %s: %s", r.Station, r.Start, r.Error)
+		}
+	}
+	summary := batch.Summary(results)
+	logger.Info("まとめて録音: %s", summary)
+
+	data, err := json.Marshal(struct {
+		Summary string         `json:"summary"`
+		Results []batch.Result `json:"results"`
+	}{summary, results})
+	if err != nil {
+		return "", err
+	}
+	if err := batch.Err(results); err != nil && !anyOK(results) {
+		return "", fmt.Errorf("すべての録音に失敗しました: %w", err)
+	}
+	return string(data), nil
+}
+
+func anyOK(results []batch.Result) bool {
+	for _, r := range results {
+		if r.OK() {
+			return true
+		}
+	}
+	return false
+}
+
+func batchConcurrency(config *radiko.Config) int {
+	if config.BatchConcurrency > 0 {
+		return config.BatchConcurrency
+	}
+	return batch.DefaultConcurrency
+}
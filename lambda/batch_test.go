@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go-radio/internal/batch"
+	"go-radio/internal/radiko"
+)
+
+func TestEvent_RecordingsJSON(t *testing.T) {
+	var e Event
+	data := `{"recordings": [{"station": "TBS", "start": "2025-06-08 20:00", "duration": 60}, {"station": "LFR", "start": "2025-06-09 01:00", "output": "ann.mp3"}], "config": {"batch_concurrency": 3}}`
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Recordings) != 2 || e.Recordings[1].Output != "ann.mp3" || e.Config.BatchConcurrency != 3 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
+
+func TestBatchReport(t *testing.T) {
+	logger := radiko.NewLogger(false)
+	results := []batch.Result{
+		{Item: batch.Item{Station: "TBS", Start: "2025-06-08 20:00"}, Result: "録音完了: /tmp/radiko/TBS_20250608_2000.mp3"},
+		{Item: batch.Item{Station: "LFR", Start: "2025-06-09 01:00"}, Error: "番組が見つかりません"},
+	}
+
+	report, err := batchReport(logger, results)
+	if err != nil {
+		t.Fatalf("partial failure should not be an error: %v", err)
+	}
+	var parsed struct {
+		Summary string         `json:"summary"`
+		Results []batch.Result `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(report), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Summary != "成功 1件, 失敗 1件" || len(parsed.Results) != 2 || parsed.Results[1].Error == "" {
+		t.Errorf("unexpected report: %s", report)
+	}
+
+	if _, err := batchReport(logger, results[1:]); err == nil || !strings.Contains(err.Error(), "LFR") {
+		t.Errorf("expected error when all recordings fail, got %v", err)
+	}
+}
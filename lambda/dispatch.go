@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+	"go-radio/internal/schedule"
+	"go-radio/internal/storage"
+)
+
+// scheduleStatePrefix は放送ごとの録音の状態を保存する保存先のプレフィックス
+const scheduleStatePrefix = ".schedule/"
+
+const (
+	// dispatchLookback より前に終わった放送は録音しない（初めて動かしたときに古い放送をまとめて録音しないため）
+	dispatchLookback = 24 * time.Hour
+	// dispatchMinRemaining より実行時間の残りが少なければ、残りの番組は次回の実行に回す
+	dispatchMinRemaining = 5 * time.Minute
+	// staleRecording より前から録音中のままの放送は、実行が打ち切られたものとして録音し直す
+	staleRecording = 15 * time.Minute
+)
+
+// 放送ごとの録音の状態
+const (
+	stateRecording = "recording"
+	stateDone      = "done"
+	stateFailed    = "failed"
+)
+
+// dispatchState は放送ごとの録音の状態
+type dispatchState struct {
+	Status   string    `json:"status"`
+	Attempts int       `json:"attempts"`
+	Updated  time.Time `json:"updated"`
+	Result   string    `json:"result,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// ready は放送をこの実行で録音するかを返す
+func (d dispatchState) ready(now time.Time, s *schedule.Schedule) bool {
+	switch d.Status {
+	case "":
+		return true
+	case stateDone:
+		return false
+	case stateRecording:
+		return d.Attempts < s.MaxAttempts && now.Sub(d.Updated) > staleRecording
+	}
+	retryAt := d.Updated.Add(time.Duration(s.RetryInterval) * time.Minute)
+	return d.Attempts < s.MaxAttempts && !now.Before(retryAt)
+}
+
+// handleDispatch はスケジュールの番組のうち、放送が終わってまだ録音していないものを録音する。
+// EventBridgeのスケジュールで定期的に呼び出すことを想定している
+func handleDispatch(ctx, recCtx context.Context, e Event, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, lib *library.Library) (string, error) {
+	if st == nil {
+		return "", fmt.Errorf("dispatchには録音の状態を保存する保存先（UPLOAD_URL または UPLOAD_BUCKET）が必要です")
+	}
+	s, err := loadSchedule(ctx, e)
+	if err != nil {
+		return "", err
+	}
+	s.ResolveStations(config)
+	for _, job := range s.Jobs {
+		if err := storage.ValidateKeyTemplate(job.Output); err != nil {
+			return "", fmt.Errorf("%s: %w", job.Name, err)
+		}
+	}
+
+	authenticated := false
+	return dispatch(ctx, recCtx, s, st, logger, time.Now, func(b schedule.Broadcast) (string, error) {
+		// 録音する放送がある場合だけ認証する
+		if !authenticated {
+			if err := client.AuthContext(recCtx); err != nil {
+				return "", fmt.Errorf("クライアント初期化に失敗: %w", err)
+			}
+			authenticated = true
+		}
+		if err := radiko.ValidateDateTime(b.Start); err != nil {
+			return "", err
+		}
+		stationID := b.Job.Station
+		output, err := b.Job.OutputPath(config, stationID, b.Start)
+		if err != nil {
+			return "", fmt.Errorf("出力パス生成に失敗: %w", err)
+		}
+		program := radiko.Program{StationID: stationID, Title: b.Job.Name, Start: b.Start, End: b.End()}
+		return recordTimeFree(ctx, recCtx, e, config, client, logger, st, lib, program, output)
+	})
+}
+
+// dispatch は録音する時期になった放送を順番に録音し、放送ごとの状態を保存先に記録する
+func dispatch(ctx, recCtx context.Context, s *schedule.Schedule, st storage.Storage, logger *radiko.Logger, now func() time.Time, record func(schedule.Broadcast) (string, error)) (string, error) {
+	var recorded int
+	var errs []error
+	start := now()
+	for _, b := range s.Due(start, start.Add(-dispatchLookback)) {
+		if deadline, ok := recCtx.Deadline(); ok && time.Until(deadline) < dispatchMinRemaining {
+			logger.Info("実行時間の残りが少ないため、残りの番組は次回の実行で録音します")
+			break
+		}
+
+		key := scheduleStatePrefix + b.ID() + ".json"
+		state, err := loadState(ctx, st, key)
+		if err != nil {
+			logger.Error("%s: 録音の状態を読み込めません: %v", b.Job.Name, err)
+			continue
+		}
+		if !state.ready(now(), s) {
+			logger.Debug("%s: %s の放送はスキップします（%s, %d回目）", b.Job.Name, b.Start.Format("2006-01-02 15:04"), state.Status, state.Attempts)
+			continue
+		}
+
+		state.Status = stateRecording
+		state.Attempts++
+		state.Updated = now()
+		if err := saveState(ctx, st, key, state); err != nil {
+			// 状態を保存できないと同じ放送を何度も録音するおそれがあるため録音しない
+			logger.Error("%s: 録音の状態を保存できません: %v", b.Job.Name, err)
+			continue
+		}
+
+		logger.Info("%s: %s の放送を録音します（%d回目）", b.Job.Name, b.Start.Format("2006-01-02 15:04"), state.Attempts)
+		result, err := record(b)
+		state.Updated = now()
+		if err != nil {
+			logger.Error("%s: 録音に失敗: %v", b.Job.Name, err)
+			state.Status = stateFailed
+			state.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s (%s): %w", b.Job.Name, b.Start.Format("2006-01-02 15:04"), err))
+		} else {
+			state.Status = stateDone
+			state.Result = result
+			state.Error = ""
+			recorded++
+		}
+		if err := saveState(ctx, st, key, state); err != nil {
+			logger.Error("%s: 録音の状態を保存できません: %v", b.Job.Name, err)
+		}
+		if recCtx.Err() != nil {
+			break
+		}
+	}
+
+	summary := fmt.Sprintf("dispatch完了: 録音 %d件, 失敗 %d件", recorded, len(errs))
+	if len(errs) > 0 {
+		return summary, errors.Join(errs...)
+	}
+	return summary, nil
+}
+
+// loadSchedule はイベントのconfig.schedule、config.schedule_url、環境変数SCHEDULE_URLの順にスケジュールを読み込む
+func loadSchedule(ctx context.Context, e Event) (*schedule.Schedule, error) {
+	location := os.Getenv("SCHEDULE_URL")
+	if e.Config != nil {
+		if len(e.Config.Schedule) > 0 {
+			return schedule.Parse(e.Config.Schedule)
+		}
+		if e.Config.ScheduleURL != "" {
+			location = e.Config.ScheduleURL
+		}
+	}
+	if location == "" {
+		return nil, fmt.Errorf("dispatchには config.schedule または schedule_url（SCHEDULE_URL）を指定してください")
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("スケジュールのURLが正しくありません: %w", err)
+	}
+	dir, name := path.Split(u.Path)
+	u.Path = dir
+	st, err := storage.Open(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	data, err := storage.ReadAll(ctx, st, name)
+	if err != nil {
+		return nil, fmt.Errorf("スケジュールの読み込みに失敗: %w", err)
+	}
+	s, err := schedule.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return s, nil
+}
+
+// loadState は放送の録音の状態を読み込む。まだない場合は空の状態を返す
+func loadState(ctx context.Context, st storage.Storage, key string) (dispatchState, error) {
+	var state dispatchState
+	data, err := storage.ReadAll(ctx, st, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// saveState は放送の録音の状態を保存する
+func saveState(ctx context.Context, st storage.Storage, key string, state dispatchState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.Put(ctx, key, bytes.NewReader(data), storage.PutOptions{ContentType: "application/json"})
+}
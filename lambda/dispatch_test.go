@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/schedule"
+	"go-radio/internal/storage"
+)
+
+const testSchedule = `{
+  "retry_interval": 30,
+  "max_attempts": 2,
+  "jobs": [
+    {"name": "evening", "station": "LFR", "time": "20:00", "duration": 60},
+    {"name": "night", "station": "TBS", "time": "25:00", "duration": 120}
+  ]
+}`
+
+func TestDispatch(t *testing.T) {
+	s, err := schedule.Parse([]byte(testSchedule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jst := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, jst)
+	clock := func() time.Time { return now }
+	st := storage.NewMemory()
+	logger := radiko.NewLogger(false)
+	ctx := context.Background()
+
+	var recorded []string
+	record := func(b schedule.Broadcast) (string, error) {
+		recorded = append(recorded, b.ID())
+		if b.Job.Name == "night" {
+			return "", errors.New("タイムフリーでまだ聴けません")
+		}
+		return "録音完了: " + b.ID(), nil
+	}
+
+	// 過去24時間に終わった2つの放送を録音する
+	summary, err := dispatch(ctx, ctx, s, st, logger, clock, record)
+	if err == nil || !strings.Contains(err.Error(), "night") {
+		t.Errorf("expected failure of night, got %v", err)
+	}
+	if summary != "dispatch完了: 録音 1件, 失敗 1件" {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+	if strings.Join(recorded, ",") != "LFR_20250609_2000,TBS_20250610_0100" {
+		t.Errorf("unexpected recordings: %v", recorded)
+	}
+	state, _ := loadState(ctx, st, ".schedule/LFR_20250609_2000.json")
+	if state.Status != stateDone || state.Attempts != 1 || state.Result == "" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+
+	// 再試行の間隔が過ぎるまでは録音しない
+	recorded = nil
+	now = now.Add(10 * time.Minute)
+	if _, err := dispatch(ctx, ctx, s, st, logger, clock, record); err != nil || len(recorded) != 0 {
+		t.Errorf("nothing should be recorded yet: %v, %v", recorded, err)
+	}
+
+	// 再試行して上限の2回目で失敗したらそれ以上は録音しない
+	now = now.Add(30 * time.Minute)
+	dispatch(ctx, ctx, s, st, logger, clock, record)
+	now = now.Add(time.Hour)
+	dispatch(ctx, ctx, s, st, logger, clock, record)
+	if strings.Join(recorded, ",") != "TBS_20250610_0100" {
+		t.Errorf("night should be retried once: %v", recorded)
+	}
+	state, _ = loadState(ctx, st, ".schedule/TBS_20250610_0100.json")
+	if state.Status != stateFailed || state.Attempts != 2 || state.Error == "" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
+
+func TestDispatchState_Ready(t *testing.T) {
+	s := &schedule.Schedule{RetryInterval: 15, MaxAttempts: 3}
+	now := time.Now()
+	tests := []struct {
+		state dispatchState
+		want  bool
+	}{
+		{dispatchState{}, true},
+		{dispatchState{Status: stateDone, Attempts: 1, Updated: now.Add(-time.Hour)}, false},
+		{dispatchState{Status: stateRecording, Attempts: 1, Updated: now.Add(-time.Minute)}, false},
+		// 実行が打ち切られたまま残った録音中の状態
+		{dispatchState{Status: stateRecording, Attempts: 1, Updated: now.Add(-time.Hour)}, true},
+		{dispatchState{Status: stateFailed, Attempts: 1, Updated: now.Add(-10 * time.Minute)}, false},
+		{dispatchState{Status: stateFailed, Attempts: 1, Updated: now.Add(-20 * time.Minute)}, true},
+		{dispatchState{Status: stateFailed, Attempts: 3, Updated: now.Add(-time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.state.ready(now, s); got != tt.want {
+			t.Errorf("ready(%+v) = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSchedule(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("SCHEDULE_URL", "")
+
+	if _, err := loadSchedule(ctx, Event{Mode: modeDispatch}); err == nil {
+		t.Error("expected error without schedule")
+	}
+
+	s, err := loadSchedule(ctx, Event{Config: &ConfigOverride{Schedule: []byte(testSchedule)}})
+	if err != nil || len(s.Jobs) != 2 {
+		t.Fatalf("inline schedule: %v, %v", s, err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "schedule.json"), []byte(testSchedule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SCHEDULE_URL", "file://"+filepath.ToSlash(dir)+"/schedule.json")
+	if s, err := loadSchedule(ctx, Event{}); err != nil || s.MaxAttempts != 2 {
+		t.Errorf("SCHEDULE_URL: %v, %v", s, err)
+	}
+	if _, err := loadSchedule(ctx, Event{Config: &ConfigOverride{ScheduleURL: "file://" + filepath.ToSlash(dir) + "/missing.json"}}); err == nil {
+		t.Error("expected error for missing schedule")
+	}
+}
+
+func TestHandler_DispatchRequiresStorage(t *testing.T) {
+	setupTestEnv()
+	defer cleanupTestEnv()
+	t.Setenv("UPLOAD_URL", "")
+
+	_, err := Handler(context.Background(), Event{Mode: modeDispatch})
+	if err == nil || !strings.Contains(err.Error(), "保存先") {
+		t.Errorf("Expected storage error, got: %v", err)
+	}
+}
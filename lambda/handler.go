@@ -2,20 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"go-radio/internal/batch"
+	"go-radio/internal/feed"
+	"go-radio/internal/library"
 	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
 
 	"github.com/aws/aws-lambda-go/lambda"
-
-	// S3 upload
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // Event defines input parameters for the Lambda function
@@ -26,18 +28,64 @@ type Event struct {
 	Output   string `json:"output"`
 	Verbose  bool   `json:"verbose"`
 
+	// 番組表から録音対象を検索する場合に指定（startの代わり）
+	Title   string `json:"title,omitempty"`
+	Keyword string `json:"keyword,omitempty"`
+
+	// 録音モード: "timefree"（デフォルト）、"live" または "dispatch"（スケジュールの番組を録音）
+	Mode string `json:"mode,omitempty"`
+
+	// 複数の番組をまとめて録音する場合に指定（station/startの代わり）
+	Recordings []batch.Item `json:"recordings,omitempty"`
+
+	// ライブラリに録音済みとして登録されている番組も録音し直す
+	Force bool `json:"force,omitempty"`
+
 	// 追加の設定オプション
 	Config *ConfigOverride `json:"config,omitempty"`
 }
 
 // ConfigOverride allows overriding default configuration
 type ConfigOverride struct {
-	DefaultOutputDir string            `json:"default_output_dir,omitempty"`
-	DefaultDuration  int               `json:"default_duration,omitempty"`
-	StationAliases   map[string]string `json:"station_aliases,omitempty"`
-	FFmpegPath       string            `json:"ffmpeg_path,omitempty"`
+	DefaultOutputDir string                           `json:"default_output_dir,omitempty"`
+	DefaultDuration  int                              `json:"default_duration,omitempty"`
+	StationAliases   map[string]string                `json:"station_aliases,omitempty"`
+	FFmpegPath       string                           `json:"ffmpeg_path,omitempty"`
+	Concurrency      int                              `json:"concurrency,omitempty"`
+	SegmentRetries   *int                             `json:"segment_retries,omitempty"`
+	FailureBudget    *int                             `json:"failure_budget,omitempty"`
+	OutputFormat     string                           `json:"output_format,omitempty"`
+	Encoders         map[string]radiko.EncoderOptions `json:"encoders,omitempty"`
+	Chapters         string                           `json:"chapters,omitempty"`
+	UploadURL        string                           `json:"upload_url,omitempty"`
+	FeedBaseURL      string                           `json:"feed_base_url,omitempty"`
+	FeedBy           string                           `json:"feed_by,omitempty"`
+	StreamUpload     *bool                            `json:"stream_upload,omitempty"`
+	UploadKey        string                           `json:"upload_key,omitempty"`
+	ContentTypes     map[string]string                `json:"content_types,omitempty"`
+	UploadTags       map[string]string                `json:"upload_tags,omitempty"`
+	StorageClass     string                           `json:"storage_class,omitempty"`
+	KMSKeyID         string                           `json:"kms_key_id,omitempty"`
+	BatchConcurrency int                              `json:"batch_concurrency,omitempty"`
+	// Area は認証で指定するエリアID（JP1〜JP47）
+	Area string `json:"area,omitempty"`
+	// Schedule はdispatchで録音するスケジュール（スケジュールファイルと同じ形式）
+	Schedule json.RawMessage `json:"schedule,omitempty"`
+	// ScheduleURL はスケジュールファイルの場所（s3://bucket/schedule.json など）
+	ScheduleURL string `json:"schedule_url,omitempty"`
 }
 
+// timeoutMargin はLambdaの実行時間上限より前に録音を打ち切る余裕。
+// この間に途中経過の保存とエラーの報告を行う
+const timeoutMargin = 60 * time.Second
+
+// 録音モード
+const (
+	modeTimeFree = "timefree"
+	modeLive     = "live"
+	modeDispatch = "dispatch"
+)
+
 // Handler is the Lambda entry point
 func Handler(ctx context.Context, e Event) (string, error) {
 	// 環境変数からverboseを取得（イベントで上書き可能）
@@ -48,6 +96,10 @@ func Handler(ctx context.Context, e Event) (string, error) {
 
 	logger := radiko.NewLogger(verbose)
 
+	// ランタイムに強制終了される前に録音を止められるよう期限を早める
+	recCtx, cancel := withTimeoutMargin(ctx)
+	defer cancel()
+
 	// 設定を読み込み（環境変数も反映）
 	config, err := radiko.LoadConfigWithEnv()
 	if err != nil {
@@ -65,6 +117,69 @@ func Handler(ctx context.Context, e Event) (string, error) {
 		if e.Config.FFmpegPath != "" {
 			config.FFmpegPath = e.Config.FFmpegPath
 		}
+		if e.Config.Concurrency > 0 {
+			config.Concurrency = e.Config.Concurrency
+		}
+		if e.Config.SegmentRetries != nil {
+			config.SegmentRetries = *e.Config.SegmentRetries
+		}
+		if e.Config.FailureBudget != nil {
+			config.FailureBudget = *e.Config.FailureBudget
+		}
+		if e.Config.OutputFormat != "" {
+			config.OutputFormat = e.Config.OutputFormat
+		}
+		if e.Config.Chapters != "" {
+			config.Chapters = e.Config.Chapters
+		}
+		if e.Config.UploadURL != "" {
+			config.UploadURL = e.Config.UploadURL
+		}
+		if e.Config.FeedBaseURL != "" {
+			config.FeedBaseURL = e.Config.FeedBaseURL
+		}
+		if e.Config.FeedBy != "" {
+			config.FeedBy = e.Config.FeedBy
+		}
+		if e.Config.BatchConcurrency > 0 {
+			config.BatchConcurrency = e.Config.BatchConcurrency
+		}
+		if e.Config.Area != "" {
+			config.Area = e.Config.Area
+		}
+		if e.Config.UploadKey != "" {
+			config.UploadKey = e.Config.UploadKey
+		}
+		if e.Config.StorageClass != "" {
+			config.StorageClass = e.Config.StorageClass
+		}
+		if e.Config.KMSKeyID != "" {
+			config.KMSKeyID = e.Config.KMSKeyID
+		}
+		if e.Config.ContentTypes != nil {
+			if config.ContentTypes == nil {
+				config.ContentTypes = map[string]string{}
+			}
+			for k, v := range e.Config.ContentTypes {
+				config.ContentTypes[k] = v
+			}
+		}
+		if e.Config.UploadTags != nil {
+			if config.UploadTags == nil {
+				config.UploadTags = map[string]string{}
+			}
+			for k, v := range e.Config.UploadTags {
+				config.UploadTags[k] = v
+			}
+		}
+		if e.Config.Encoders != nil {
+			if config.Encoders == nil {
+				config.Encoders = map[string]radiko.EncoderOptions{}
+			}
+			for k, v := range e.Config.Encoders {
+				config.Encoders[k] = v
+			}
+		}
 		if e.Config.StationAliases != nil {
 			for k, v := range e.Config.StationAliases {
 				config.StationAliases[k] = v
@@ -72,9 +187,20 @@ func Handler(ctx context.Context, e Event) (string, error) {
 		}
 	}
 
-	if e.Station == "" {
+	if e.Station == "" && e.Mode != modeDispatch && len(e.Recordings) == 0 {
 		return "", fmt.Errorf("station is required")
 	}
+	if _, err := radiko.ParseChapterOptions(config.Chapters); err != nil {
+		return "", err
+	}
+	if err := storage.ValidateKeyTemplate(config.UploadKey); err != nil {
+		return "", err
+	}
+	if config.Area != "" {
+		if _, err := radiko.LookupArea(config.Area); err != nil {
+			return "", err
+		}
+	}
 
 	stationID := e.Station
 	if alias, ok := config.StationAliases[strings.ToLower(stationID)]; ok {
@@ -87,14 +213,60 @@ func Handler(ctx context.Context, e Event) (string, error) {
 	}
 
 	var startTime time.Time
+	var program radiko.Program
 	jst, tzErr := time.LoadLocation("Asia/Tokyo")
 	if tzErr != nil {
 		jst = time.FixedZone("JST", 9*60*60)
 	}
 
+	client := radiko.NewClient()
+	client.SetLogger(logger)
+	client.ApplyConfig(config)
+	if location := os.Getenv("TOKEN_CACHE_URL"); location != "" {
+		// /tmpはコールドスタートや別の実行環境では残っていないため、トークンは保存先に置いて使い回す
+		tc, err := storage.OpenTokenCache(ctx, location)
+		if err != nil {
+			return "", err
+		}
+		client.SetTokenCache(tc)
+	}
+
+	st, err := uploadStorage(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	lib, err := library.OpenConfigured(ctx, "", st)
+	if err != nil {
+		return "", err
+	}
+
+	if e.Mode == modeDispatch {
+		return handleDispatch(ctx, recCtx, e, config, client, logger, st, lib)
+	}
+	if len(e.Recordings) > 0 {
+		return handleBatch(ctx, recCtx, e, config, client, logger, st, lib)
+	}
+	if e.Mode == modeLive {
+		return handleLive(ctx, recCtx, e, config, client, logger, st, stationID, duration)
+	}
+	if e.Mode != "" && e.Mode != modeTimeFree {
+		return "", fmt.Errorf("不明なmodeです: %s", e.Mode)
+	}
+
+	filter := radiko.ProgramFilter{Title: e.Title, Keyword: e.Keyword}
 	if e.Start == "" {
-		now := time.Now().In(jst)
-		startTime = time.Date(now.Year(), now.Month(), now.Day(), 20, 0, 0, 0, jst)
+		if filter.IsEmpty() {
+			return "", fmt.Errorf("start または title/keyword を指定してください")
+		}
+		found, err := client.FindLatestProgramContext(recCtx, stationID, filter, time.Now().In(jst))
+		if err != nil {
+			return "", fmt.Errorf("番組検索に失敗: %w", err)
+		}
+		program = found
+		logger.Info("録音対象の番組: %s (%s - %s)", program.Title, program.Start.Format("2006-01-02 15:04"), program.End.Format("15:04"))
+		startTime = program.Start
+		duration = program.Duration()
 	} else {
 		var err error
 		startTime, err = time.ParseInLocation("2006-01-02 15:04", e.Start, jst)
@@ -106,67 +278,240 @@ func Handler(ctx context.Context, e Event) (string, error) {
 	if err := radiko.ValidateDateTime(startTime); err != nil {
 		return "", err
 	}
+	if err := client.AuthContext(recCtx); err != nil {
+		return "", fmt.Errorf("クライアント初期化に失敗: %w", err)
+	}
+
+	program.StationID = stationID
+	program.Start = startTime
+	program.End = startTime.Add(time.Duration(duration) * time.Minute)
+	return recordTimeFree(ctx, recCtx, e, config, client, logger, st, lib, program, e.Output)
+}
+
+// recordTimeFree は認証済みのclientでタイムフリー番組を録音して変換し、保存先があればアップロードする。
+// ライブラリに録音済みとして登録されている番組は録音しない
+func recordTimeFree(ctx, recCtx context.Context, e Event, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, lib *library.Library, program radiko.Program, output string) (string, error) {
+	if entry, ok := lib.Find(program); ok && !e.Force {
+		logger.Info("録音済みのためスキップします: %s", entry.Location())
+		return fmt.Sprintf("録音済み: %s", entry.Location()), nil
+	}
 
 	// 出力ファイルパスを決定
-	outputFile, err := radiko.BuildOutputPath(config, stationID, e.Output, startTime)
+	outputFile, err := radiko.BuildOutputPath(config, program.StationID, output, program.Start)
 	if err != nil {
 		return "", fmt.Errorf("出力パス生成に失敗: %w", err)
 	}
 
-	client := radiko.NewClient()
-	client.SetLogger(logger)
-	if err := client.Auth(); err != nil {
+	if st != nil && streamUpload(e) {
+		if radiko.CanStream(outputFile) {
+			return streamRecording(ctx, recCtx, config, client, logger, st, lib, program, outputFile)
+		}
+		logger.Info("%s は録音ファイルを作らずに変換できないため、ファイルに録音してからアップロードします", filepath.Ext(outputFile))
+	}
+
+	recFile := radiko.RecordingPath(outputFile)
+	if st != nil {
+		restoreProgress(recCtx, st, recFile, program, logger)
+	}
+	if err := client.RecordTimeFreeContext(recCtx, program.StationID, program.Start, program.Duration(), recFile); err != nil {
+		if st != nil {
+			saveProgress(ctx, st, recFile, program, logger)
+		}
+		return "", recordError(err)
+	}
+	if st != nil {
+		clearProgress(ctx, st, recFile, program, logger)
+	}
+
+	return finish(ctx, config, client, logger, st, lib, program, recFile, outputFile)
+}
+
+// handleLive はライブストリームを現在時刻から録音する
+func handleLive(ctx, recCtx context.Context, e Event, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, stationID string, duration int) (string, error) {
+	start := time.Now()
+	outputFile, err := radiko.BuildOutputPath(config, stationID, e.Output, start)
+	if err != nil {
+		return "", fmt.Errorf("出力パス生成に失敗: %w", err)
+	}
+
+	if err := client.AuthContext(recCtx); err != nil {
 		return "", fmt.Errorf("クライアント初期化に失敗: %w", err)
 	}
 
-	recFile := outputFile
-	if strings.HasSuffix(outputFile, ".mp3") {
-		recFile = strings.TrimSuffix(outputFile, ".mp3") + ".aac"
+	recFile := radiko.RecordingPath(outputFile)
+	recErr := client.RecordLive(recCtx, stationID, time.Duration(duration)*time.Minute, recFile)
+	var partial *radiko.PartialRecordingError
+	if recErr != nil && !errors.As(recErr, &partial) {
+		return "", recordError(recErr)
 	}
 
-	if err := client.RecordTimeFree(stationID, startTime, duration, recFile); err != nil {
-		return "", fmt.Errorf("録音に失敗: %w", err)
+	program := radiko.Program{StationID: stationID, Start: start, End: time.Now()}
+	result, err := finish(ctx, config, client, logger, st, nil, program, recFile, outputFile)
+	if err != nil {
+		return "", err
 	}
+	if partial != nil {
+		// 途中までの録音はアップロードしたうえで失敗として報告する
+		return result, recordError(partial)
+	}
+	return result, nil
+}
 
-	if recFile != outputFile {
-		if err := radiko.ConvertToMP3(config.FFmpegPath, recFile, outputFile); err != nil {
-			return "", fmt.Errorf("変換に失敗: %w", err)
+// uploadStorage は録音のアップロード先を開く。未設定ならnilを返す。
+// UPLOAD_URLがなくUPLOAD_BUCKETがあればそのS3バケットを使う
+func uploadStorage(ctx context.Context, config *radiko.Config) (storage.Storage, error) {
+	location := config.UploadURL
+	if location == "" {
+		if bucket := os.Getenv("UPLOAD_BUCKET"); bucket != "" {
+			location = "s3://" + bucket
 		}
-		os.Remove(recFile)
 	}
+	if location == "" {
+		return nil, nil
+	}
+	return storage.Open(ctx, location)
+}
 
-	// Upload to S3 if bucket is specified
-	bucket := os.Getenv("UPLOAD_BUCKET")
-	if bucket != "" {
-		key := filepath.Base(outputFile)
-		if err := uploadFileToS3(ctx, bucket, key, outputFile); err != nil {
-			return "", fmt.Errorf("S3アップロード失敗: %w", err)
-		}
+// streamUpload は録音ファイルを作らずにアップロードするかを返す。
+// STREAM_UPLOAD=true で有効になり、イベントのconfig.stream_uploadで上書きできる
+func streamUpload(e Event) bool {
+	if e.Config != nil && e.Config.StreamUpload != nil {
+		return *e.Config.StreamUpload
+	}
+	return os.Getenv("STREAM_UPLOAD") == "true"
+}
+
+// withTimeoutMargin はLambdaの実行期限からtimeoutMarginを差し引いた期限のコンテキストを返す
+func withTimeoutMargin(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
 	}
+	return context.WithDeadline(ctx, deadline.Add(-timeoutMargin))
+}
 
-	return fmt.Sprintf("録音完了: %s", outputFile), nil
+// recordError は録音エラーを利用者向けのメッセージに変換する
+func recordError(err error) error {
+	var partial *radiko.PartialRecordingError
+	if errors.As(err, &partial) {
+		return fmt.Errorf("Lambdaの実行時間上限のため途中までの録音を保存しました: %w", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("Lambdaの実行時間上限が近づいたため録音を中断しました（再実行すると続きから録音します）: %w", err)
+	}
+	var areaErr *radiko.StationAreaError
+	if errors.As(err, &areaErr) && len(areaErr.Areas) > 0 {
+		return fmt.Errorf("録音に失敗: %w。イベントの config.area（RADIKO_AREA）に %s を指定するか、RADIKO_EMAIL / RADIKO_PASSWORD でradikoプレミアムにログインすると録音できます", err, areaErr.Areas[0])
+	}
+	return fmt.Errorf("録音に失敗: %w", err)
 }
 
-func uploadFileToS3(ctx context.Context, bucket, key, path string) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return err
+// finish は録音ファイルを変換して番組情報のタグを書き込み、保存先があればアップロードする
+func finish(ctx context.Context, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, lib *library.Library, program radiko.Program, recFile, outputFile string) (string, error) {
+	if err := radiko.ConvertAudioContext(ctx, config, recFile, outputFile); err != nil {
+		return "", fmt.Errorf("変換に失敗: %w", err)
+	}
+	os.Remove(recFile)
+
+	md := programMetadata(ctx, config, client, logger, program)
+	if err := radiko.TagFile(outputFile, md); err != nil {
+		logger.Error("タグの書き込みに失敗: %v", err)
 	}
-	client := s3.NewFromConfig(cfg)
 
-	f, err := os.Open(path)
+	key, opts, err := storage.RecordingTarget(config, md, program, outputFile)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if st != nil {
+		if err := storage.UploadFile(ctx, st, key, outputFile, opts); err != nil {
+			return "", fmt.Errorf("アップロード失敗: %w", err)
+		}
+		lib.TryRecord(ctx, logger, program, md.Album, outputFile, st.URL(key))
 	}
-	defer f.Close()
+	publishInfo(ctx, config, logger, st, md, program, outputFile, key, opts)
+	if st == nil {
+		return fmt.Sprintf("録音完了: %s", outputFile), nil
+	}
+
+	// ウォームスタートでは/tmpが次の呼び出しに残るため、アップロードした録音は消しておく
+	// （dispatchやbatchで1回に何本も録音すると/tmpの容量を使い切る）
+	os.Remove(outputFile)
+	return fmt.Sprintf("録音完了: %s", st.URL(key)), nil
+}
+
+// streamRecording はタイムフリー番組を録音ファイルを作らずに変換しながら保存先へアップロードする。
+// /tmpには番組情報のファイルしか書き込まないため、長時間の番組も録音できる
+func streamRecording(ctx, recCtx context.Context, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, st storage.Storage, lib *library.Library, program radiko.Program, outputFile string) (string, error) {
+	// タグはストリームの先頭に書き込むため、録音の前に番組情報を取得する
+	md := programMetadata(recCtx, config, client, logger, program)
 
-	_, err = client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(bucket),
-		Key:         aws.String(key),
-		Body:        f,
-		ContentType: aws.String("audio/mpeg"),
+	key, opts, err := storage.RecordingTarget(config, md, program, outputFile)
+	if err != nil {
+		return "", err
+	}
+	logger.Info("録音しながらアップロードします: %s", st.URL(key))
+	err = storage.Stream(ctx, st, key, opts, func(w io.Writer) error {
+		if err := radiko.WriteStreamTags(w, outputFile, md); err != nil {
+			return err
+		}
+		conv, err := radiko.ConvertStream(ctx, config, outputFile, w)
+		if err != nil {
+			return fmt.Errorf("変換に失敗: %w", err)
+		}
+		duration := int(program.End.Sub(program.Start) / time.Minute)
+		recErr := client.StreamTimeFreeContext(recCtx, program.StationID, program.Start, duration, conv)
+		if err := conv.Close(); err != nil && recErr == nil {
+			return fmt.Errorf("変換に失敗: %w", err)
+		}
+		if recErr != nil {
+			if errors.Is(recErr, context.DeadlineExceeded) {
+				return fmt.Errorf("Lambdaの実行時間上限が近づいたため録音を中断しました（ストリーミングでは続きから再開できません）: %w", recErr)
+			}
+			return recordError(recErr)
+		}
+		return nil
 	})
-	return err
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		logger.Error("番組情報の保存に失敗: %v", err)
+	} else {
+		publishInfo(ctx, config, logger, st, md, program, outputFile, key, opts)
+	}
+	lib.TryRecord(ctx, logger, program, md.Album, outputFile, st.URL(key))
+	return fmt.Sprintf("録音完了: %s", st.URL(key)), nil
+}
+
+// programMetadata は番組表から番組情報とチャプターを取得する
+func programMetadata(ctx context.Context, config *radiko.Config, client *radiko.Client, logger *radiko.Logger, program radiko.Program) radiko.Metadata {
+	md := client.ResolveMetadata(ctx, program)
+	if opts, err := radiko.ParseChapterOptions(config.Chapters); err != nil {
+		logger.Error("%v", err)
+	} else {
+		md.Chapters = client.Chapters(ctx, program, opts)
+	}
+	return md
+}
+
+// publishInfo は録音ファイルの横に番組情報を保存し、保存先があれば録音のkeyの横にアップロードして
+// フィードを更新する。失敗した場合はログに残して続ける
+func publishInfo(ctx context.Context, config *radiko.Config, logger *radiko.Logger, st storage.Storage, md radiko.Metadata, program radiko.Program, outputFile, key string, opts storage.PutOptions) {
+	infoFile := feed.InfoPath(outputFile)
+	info := feed.NewEpisodeInfo(md, program.StationID, program.End.Sub(program.Start))
+	if err := feed.WriteInfo(infoFile, info); err != nil {
+		logger.Error("番組情報の保存に失敗: %v", err)
+	}
+	if st == nil {
+		return
+	}
+	opts.ContentType = storage.ContentType(infoFile)
+	if err := storage.UploadFile(ctx, st, feed.InfoPath(key), infoFile, opts); err != nil {
+		logger.Error("番組情報のアップロードに失敗: %v", err)
+	}
+	os.Remove(infoFile)
+	feed.TryUpdate(ctx, logger, st, config, key, info)
 }
 
 func main() {
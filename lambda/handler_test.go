@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-radio/internal/library"
 	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
 	"os"
 	"path/filepath"
 	"strings"
@@ -119,6 +122,112 @@ func TestHandler_MissingStation(t *testing.T) {
 	}
 }
 
+func TestHandler_MissingStartAndTitle(t *testing.T) {
+	setupTestEnv()
+	defer cleanupTestEnv()
+
+	event := Event{
+		Station:  "TBS",
+		Duration: 60,
+	}
+
+	_, err := Handler(context.Background(), event)
+	if err == nil {
+		t.Fatal("Expected error when neither start nor title is specified")
+	}
+
+	if !strings.Contains(err.Error(), "title/keyword") {
+		t.Errorf("Expected start/title error, got: %v", err)
+	}
+}
+
+func TestHandler_UnknownMode(t *testing.T) {
+	setupTestEnv()
+	defer cleanupTestEnv()
+
+	_, err := Handler(context.Background(), Event{Station: "TBS", Mode: "podcast"})
+	if err == nil || !strings.Contains(err.Error(), "mode") {
+		t.Errorf("Expected unknown mode error, got: %v", err)
+	}
+}
+
+func TestHandler_InvalidUploadKey(t *testing.T) {
+	setupTestEnv()
+	defer cleanupTestEnv()
+
+	_, err := Handler(context.Background(), Event{
+		Station: "TBS",
+		Start:   "2025-06-08 20:00",
+		Config:  &ConfigOverride{UploadKey: "{station}/{title}.mp3"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "{title}") {
+		t.Errorf("Expected key template error, got: %v", err)
+	}
+}
+
+func TestHandler_InvalidArea(t *testing.T) {
+	setupTestEnv()
+	defer cleanupTestEnv()
+
+	_, err := Handler(context.Background(), Event{
+		Station: "ABC",
+		Start:   "2025-06-08 20:00",
+		Config:  &ConfigOverride{Area: "JP99"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "JP99") {
+		t.Errorf("Expected area error, got: %v", err)
+	}
+}
+
+func TestWithTimeoutMargin(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Minute)
+	parent, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	ctx, cancelRec := withTimeoutMargin(parent)
+	defer cancelRec()
+
+	got, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("Expected deadline to be set")
+	}
+	if !got.Equal(deadline.Add(-timeoutMargin)) {
+		t.Errorf("Expected deadline %v, got %v", deadline.Add(-timeoutMargin), got)
+	}
+
+	noDeadline, cancelNone := withTimeoutMargin(context.Background())
+	defer cancelNone()
+	if _, ok := noDeadline.Deadline(); ok {
+		t.Error("Expected no deadline without a parent deadline")
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	err := recordError(fmt.Errorf("download: %w", context.DeadlineExceeded))
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "実行時間上限") {
+		t.Errorf("Expected timeout message, got: %v", err)
+	}
+	if err := recordError(errors.New("boom")); !strings.Contains(err.Error(), "録音に失敗") {
+		t.Errorf("Expected generic message, got: %v", err)
+	}
+	areaErr := &radiko.StationAreaError{StationID: "TBS", AreaID: "JP27", Areas: []string{"JP13"}}
+	err = recordError(fmt.Errorf("download: %w", areaErr))
+	if !errors.Is(err, radiko.ErrStationNotInArea) || !strings.Contains(err.Error(), "config.area") || !strings.Contains(err.Error(), "JP13") {
+		t.Errorf("Expected area hint, got: %v", err)
+	}
+}
+
+func TestEvent_TitleJSON(t *testing.T) {
+	var event Event
+	data := `{"station":"TBS","title":"JUNK","keyword":"深夜"}`
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if event.Title != "JUNK" || event.Keyword != "深夜" {
+		t.Errorf("Expected title/keyword to be set, got %q/%q", event.Title, event.Keyword)
+	}
+}
+
 func TestHandler_EnvironmentVariables(t *testing.T) {
 	// 環境変数の設定
 	os.Setenv("DEFAULT_DURATION", "120")
@@ -298,6 +407,158 @@ func TestHandler_OutputFileGeneration(t *testing.T) {
 	}
 }
 
+func TestUploadStorage(t *testing.T) {
+	config := radiko.DefaultConfig()
+	t.Setenv("UPLOAD_BUCKET", "")
+	if st, err := uploadStorage(context.Background(), config); err != nil || st != nil {
+		t.Errorf("expected no storage, got %v, %v", st, err)
+	}
+
+	t.Setenv("UPLOAD_BUCKET", "radio-transcribe")
+	st, err := uploadStorage(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.URL("a.mp3"); got != "s3://radio-transcribe/a.mp3" {
+		t.Errorf("UPLOAD_BUCKET should select S3, got %s", got)
+	}
+
+	config.UploadURL = "file://" + filepath.ToSlash(t.TempDir())
+	if st, err = uploadStorage(context.Background(), config); err != nil || !strings.HasPrefix(st.URL("a.mp3"), "file://") {
+		t.Errorf("upload_url should take precedence over UPLOAD_BUCKET: %v, %v", st, err)
+	}
+}
+
+func TestStreamUpload(t *testing.T) {
+	t.Setenv("STREAM_UPLOAD", "")
+	if streamUpload(Event{}) {
+		t.Error("streaming should be disabled by default")
+	}
+
+	t.Setenv("STREAM_UPLOAD", "true")
+	if !streamUpload(Event{}) {
+		t.Error("STREAM_UPLOAD=true should enable streaming")
+	}
+	off := false
+	if streamUpload(Event{Config: &ConfigOverride{StreamUpload: &off}}) {
+		t.Error("config.stream_upload should take precedence over STREAM_UPLOAD")
+	}
+}
+
+func TestRecordTimeFree_Recorded(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	lib, err := library.OpenConfigured(ctx, "", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Minute)
+	program := radiko.Program{StationID: "TBS", Start: start, End: start.Add(time.Hour)}
+	if err := lib.Record(ctx, program, "JUNK", "", "mem://TBS.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := st.Object(library.StorageKey); !ok {
+		t.Fatalf("library should be saved at %s", library.StorageKey)
+	}
+
+	// 録音済みの番組はクライアントを使わずにスキップする
+	result, err := recordTimeFree(ctx, ctx, Event{}, radiko.DefaultConfig(), nil, radiko.NewLogger(false), st, lib, program, "")
+	if err != nil || result != "録音済み: mem://TBS.mp3" {
+		t.Errorf("recordTimeFree() = %q, %v", result, err)
+	}
+}
+
+func TestFinish_RemovesUploadedFiles(t *testing.T) {
+	ctx := context.Background()
+	st := storage.NewMemory()
+	config := radiko.DefaultConfig()
+	config.Chapters = ""
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "TBS_20240101_2000.aac")
+	recFile := radiko.RecordingPath(outputFile)
+	os.WriteFile(recFile, []byte("audio"), 0644)
+
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	program := radiko.Program{StationID: "TBS", Title: "JUNK", Start: start, End: start.Add(time.Hour)}
+	result, err := finish(ctx, config, radiko.NewClient(), radiko.NewLogger(false), st, nil, program, recFile, outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "録音完了: mem://TBS_20240101_2000.aac" {
+		t.Errorf("finish() = %q", result)
+	}
+	if _, _, ok := st.Object("TBS_20240101_2000.aac"); !ok {
+		t.Fatalf("recording should be uploaded: %v", st.Keys())
+	}
+	// ウォームスタートで/tmpが埋まらないよう、アップロードした録音と番組情報は残さない
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("uploaded files should be removed from /tmp: %v", entries)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	logger := radiko.NewLogger(false)
+	st := storage.NewMemory()
+
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, radiko.JST())
+	program := radiko.Program{StationID: "TBS", Start: start, End: start.Add(time.Hour)}
+	recFile := filepath.Join(t.TempDir(), "junk.aac")
+	os.WriteFile(recFile, []byte("partial"), 0644)
+	os.WriteFile(radiko.ManifestPath(recFile), []byte("{}"), 0644)
+	saveProgress(ctx, st, recFile, program, logger)
+	if keys := st.Keys(); len(keys) != 2 || !strings.HasPrefix(keys[0], progressPrefix) {
+		t.Fatalf("unexpected saved keys: %v", keys)
+	}
+
+	// 別の実行環境で続きから録音する場合
+	restored := filepath.Join(t.TempDir(), "junk.aac")
+	restoreProgress(ctx, st, restored, program, logger)
+	if data, err := os.ReadFile(restored); err != nil || string(data) != "partial" {
+		t.Errorf("recording should be restored: %q, %v", data, err)
+	}
+	if _, err := os.Stat(radiko.ManifestPath(restored)); err != nil {
+		t.Errorf("manifest should be restored: %v", err)
+	}
+
+	// 出力ファイル名が同じでも別の放送の途中経過は復元しない
+	next := radiko.Program{StationID: "TBS", Start: start.AddDate(0, 0, 7), End: start.AddDate(0, 0, 7).Add(time.Hour)}
+	other := filepath.Join(t.TempDir(), "junk.aac")
+	restoreProgress(ctx, st, other, next, logger)
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Errorf("progress of another broadcast should not be restored: %v", err)
+	}
+
+	clearProgress(ctx, st, recFile, program, logger)
+	if keys := st.Keys(); len(keys) != 0 {
+		t.Errorf("progress should be cleared: %v", keys)
+	}
+
+	// 途中経過がなければ何も復元しない
+	fresh := filepath.Join(t.TempDir(), "junk.aac")
+	restoreProgress(ctx, st, fresh, program, logger)
+	if _, err := os.Stat(radiko.ManifestPath(fresh)); err == nil {
+		t.Error("manifest should not exist without saved progress")
+	}
+
+	// マニフェストのない録音ファイルは復元せず、/tmpに残さない
+	files := progressFiles(fresh, program)
+	st.Put(ctx, files[1].key, strings.NewReader("orphan"), storage.PutOptions{})
+	os.WriteFile(fresh, []byte("stale"), 0644)
+	restoreProgress(ctx, st, fresh, program, logger)
+	if _, err := os.Stat(fresh); !os.IsNotExist(err) {
+		t.Errorf("orphan recording should not be left in /tmp: %v", err)
+	}
+
+	// 録音ファイルを復元できなければマニフェストも残さない
+	st.Delete(ctx, files[1].key)
+	st.Put(ctx, files[0].key, strings.NewReader("{}"), storage.PutOptions{})
+	restoreProgress(ctx, st, fresh, program, logger)
+	if _, err := os.Stat(radiko.ManifestPath(fresh)); !os.IsNotExist(err) {
+		t.Errorf("manifest without a recording should be removed: %v", err)
+	}
+}
+
 func TestEvent_JSONMarshaling(t *testing.T) {
 	event := Event{
 		Station:  "TBS",
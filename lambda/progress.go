@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
+)
+
+// progressPrefix は途中までの録音を保存する保存先のプレフィックス
+const progressPrefix = ".partial/"
+
+// progressFile は途中経過のファイルのローカルパスと保存先のキー
+type progressFile struct {
+	path string
+	key  string
+}
+
+// progressFiles は途中経過のマニフェストと録音ファイルを、マニフェスト、録音ファイルの順に返す。
+// マニフェストのない録音ファイルは続きから録音できないため、マニフェストを先に復元する。
+// 出力ファイル名が同じ別の放送の途中経過を取り違えないよう、保存先のキーは放送のIDにする
+func progressFiles(recFile string, p radiko.Program) []progressFile {
+	key := progressPrefix + p.BroadcastID() + filepath.Ext(recFile)
+	return []progressFile{
+		{path: radiko.ManifestPath(recFile), key: radiko.ManifestPath(key)},
+		{path: recFile, key: key},
+	}
+}
+
+// restoreProgress は前回のタイムアウトなどで中断された録音を保存先から/tmpに復元する。
+// マニフェストがないか復元に失敗した場合は、/tmpに取り残さないよう復元したファイルを削除する
+func restoreProgress(ctx context.Context, st storage.Storage, recFile string, p radiko.Program, logger *radiko.Logger) {
+	if _, err := os.Stat(radiko.ManifestPath(recFile)); err == nil {
+		// 同じ実行環境に再開用のファイルが残っている
+		return
+	}
+
+	files := progressFiles(recFile, p)
+	for _, f := range files {
+		if err := storage.DownloadFile(ctx, st, f.key, f.path); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				logger.Error("途中までの録音の復元に失敗: %v", err)
+			}
+			for _, f := range files {
+				os.Remove(f.path)
+			}
+			return
+		}
+	}
+	logger.Info("保存先から途中までの録音を復元しました: %s", st.URL(files[1].key))
+}
+
+// saveProgress は途中までの録音とマニフェストを保存先に保存する。
+// 途中で失敗しても録音ファイルだけが残るよう、マニフェストは最後に保存する
+func saveProgress(ctx context.Context, st storage.Storage, recFile string, p radiko.Program, logger *radiko.Logger) {
+	if _, err := os.Stat(radiko.ManifestPath(recFile)); err != nil {
+		return
+	}
+	files := progressFiles(recFile, p)
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := storage.UploadFile(ctx, st, files[i].key, files[i].path, storage.PutOptions{}); err != nil {
+			logger.Error("途中までの録音の保存に失敗: %v", err)
+			return
+		}
+	}
+	logger.Info("途中までの録音を保存先に保存しました。再実行すると続きから録音します")
+}
+
+// clearProgress は録音完了後に保存先の途中経過を削除する（マニフェストから先に削除する）
+func clearProgress(ctx context.Context, st storage.Storage, recFile string, p radiko.Program, logger *radiko.Logger) {
+	for _, f := range progressFiles(recFile, p) {
+		if err := st.Delete(ctx, f.key); err != nil {
+			logger.Error("途中までの録音の削除に失敗: %v", err)
+		}
+	}
+}
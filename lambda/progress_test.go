@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go-radio/internal/radiko"
+)
+
+func TestProgressFiles(t *testing.T) {
+	start := time.Date(2024, 6, 7, 20, 0, 0, 0, radiko.JST())
+	p := radiko.Program{StationID: "TBS", Start: start, End: start.Add(2 * time.Hour)}
+	files := progressFiles("/tmp/radiko/TBS_20240607_2000.aac", p)
+	expected := []progressFile{
+		{"/tmp/radiko/TBS_20240607_2000.aac.manifest.json", ".partial/TBS_20240607200000_20240607220000.aac.manifest.json"},
+		{"/tmp/radiko/TBS_20240607_2000.aac", ".partial/TBS_20240607200000_20240607220000.aac"},
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d files, got %d", len(expected), len(files))
+	}
+	for i, f := range expected {
+		if files[i] != f {
+			t.Errorf("Expected %+v at %d, got %+v", f, i, files[i])
+		}
+	}
+
+	// 出力ファイル名が同じでも放送が違えば別のキーにする
+	next := radiko.Program{StationID: "TBS", Start: start.AddDate(0, 0, 7), End: start.AddDate(0, 0, 7).Add(2 * time.Hour)}
+	if other := progressFiles("/tmp/radiko/TBS_20240607_2000.aac", next); other[1].key == files[1].key {
+		t.Errorf("different broadcasts should not share the progress key: %s", other[1].key)
+	}
+}
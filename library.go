@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"go-radio/internal/library"
+	"go-radio/internal/radiko"
+)
+
+// runLibrary は録音済みの番組の一覧（ライブラリ）を表示・検索・削除する
+func runLibrary(args []string) {
+	config, err := radiko.LoadConfigWithEnv()
+
+	fs := flag.NewFlagSet("library", flag.ExitOnError)
+	var (
+		path    = fs.String("library", config.Library, "ライブラリのファイル")
+		verbose = fs.Bool("verbose", false, "詳細なログを表示")
+	)
+	fs.Parse(args)
+
+	logger := radiko.NewLogger(*verbose)
+	if err != nil {
+		logger.Error("設定読み込み警告: %v", err)
+	}
+	config.Library = *path
+
+	command, rest := fs.Arg(0), fs.Args()
+	if len(rest) > 0 {
+		rest = rest[1:]
+	}
+	if config.Library == "" || (command != "list" && command != "search" && command != "remove") ||
+		(command == "search" && len(rest) != 1) || (command == "remove" && len(rest) == 0) {
+		logger.Info("使用方法:")
+		logger.Info("  go run . library list  # 録音済みの番組の一覧")
+		logger.Info("  go run . library search \"JUNK\"  # 局ID・番組名・ファイル名で検索")
+		logger.Info("  go run . library remove TBS_20250609010000_20250609030000  # 一覧から削除（再び録音できるようになる）")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	lib, err := library.OpenConfigured(ctx, config.Library, nil)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	switch command {
+	case "list", "search":
+		entries := lib.List()
+		if command == "search" {
+			entries = lib.Search(rest[0])
+		}
+		for _, e := range entries {
+			logger.Info("%s  %s  %s", e.ID(), e.Title, e.Location())
+		}
+		logger.Info("%d件", len(entries))
+	case "remove":
+		for _, id := range rest {
+			removed, err := lib.Remove(ctx, id)
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			if !removed {
+				logger.Error("ライブラリにありません: %s", id)
+				continue
+			}
+			logger.Info("ライブラリから削除しました: %s (録音ファイルは削除していません)", id)
+		}
+	}
+}
+
+// alreadyRecorded は番組がライブラリに録音済みとして登録されていればログを出してtrueを返す
+func alreadyRecorded(lib *library.Library, logger *radiko.Logger, p radiko.Program) bool {
+	e, ok := lib.Find(p)
+	if !ok {
+		return false
+	}
+	title := e.Title
+	if title == "" {
+		title = e.Station + " " + p.Start.Format("2006-01-02 15:04")
+	}
+	logger.Info("録音済みのためスキップします: %s (%s)", title, e.Location())
+	return true
+}
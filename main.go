@@ -1,21 +1,55 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 
+	"go-radio/internal/library"
 	"go-radio/internal/radiko"
+	"go-radio/internal/storage"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "feed":
+			runFeed(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "catchup":
+			runCatchup(os.Args[2:])
+			return
+		case "library":
+			runLibrary(os.Args[2:])
+			return
+		}
+	}
+
 	var (
 		stationID  = flag.String("station", "", "ラジオ局ID (例: TBS, LFR)")
 		startTime  = flag.String("start", "", "開始時間 (YYYY-MM-DD HH:MM 形式)")
 		duration   = flag.Int("duration", 0, "録音時間（分）")
-		output     = flag.String("output", "", "出力ファイル名 (.mp3拡張子)")
+		output     = flag.String("output", "", "出力ファイル名 (拡張子で出力形式を判定)")
+		format     = flag.String("format", "", "出力形式 ("+strings.Join(radiko.FormatNames(), ", ")+")")
+		chapters   = flag.String("chapters", "", "チャプターの付け方 (program: 番組の区切り, 30m など: 一定間隔)")
+		upload     = flag.String("upload", "", "録音後にアップロードする保存先 (s3://bucket/prefix, gs://, webdav://, file:///dir)")
+		area       = flag.String("area", "", "認証で指定するエリアID (JP1〜JP47。そのエリアの局を録音)")
+		title      = flag.String("title", "", "番組名で検索して録音 (-startの代わりに指定)")
+		keyword    = flag.String("keyword", "", "番組名・出演者・説明のキーワードで検索して録音")
+		allFlag    = flag.Bool("all", false, "-title/-keyword に一致するタイムフリー期間内の番組をすべて録音")
+		force      = flag.Bool("force", false, "ライブラリに録音済みとして登録されている番組も録音し直す")
+		liveFlag   = flag.Bool("live", false, "ライブストリームを現在時刻から-durationの時間だけ録音")
+		batchFile  = flag.String("batch", "", "まとめて録音する番組の一覧 (JSONファイル)")
 		listFlag   = flag.Bool("list", false, "利用可能な局の一覧を表示")
+		logoutFlag = flag.Bool("logout", false, "radikoプレミアムからログアウトし、保存したセッションを削除")
 		configFlag = flag.Bool("config", false, "設定ファイルを生成")
 		verbose    = flag.Bool("verbose", false, "詳細なログを表示")
 	)
@@ -29,6 +63,30 @@ func main() {
 	if err != nil {
 		logger.Error("設定読み込み警告: %v", err)
 	}
+	if *format != "" {
+		config.OutputFormat = *format
+	}
+	if *chapters != "" {
+		config.Chapters = *chapters
+	}
+	if *upload != "" {
+		config.UploadURL = *upload
+	}
+	if *area != "" {
+		config.Area = *area
+	}
+	if config.Area != "" {
+		if _, err := radiko.LookupArea(config.Area); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+	chapterOpts, err := radiko.ParseChapterOptions(config.Chapters)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if err := storage.ValidateKeyTemplate(config.UploadKey); err != nil {
+		logger.Fatal("%v", err)
+	}
 	logger.Debug("設定を読み込みました: %+v", config)
 
 	if *configFlag {
@@ -40,20 +98,38 @@ func main() {
 	}
 
 	if *listFlag {
-		stations := radiko.GetAvailableStations()
-		logger.Info("利用可能なラジオ局:")
-		for id, name := range stations {
-			logger.Info("  %s: %s", id, name)
+		listStations(config, logger)
+		return
+	}
+
+	if *logoutFlag {
+		client := radiko.NewClient()
+		client.SetLogger(logger)
+		client.ApplyConfig(config)
+		if err := client.LogoutContext(context.Background()); err != nil {
+			logger.Fatal("%v", err)
 		}
 		return
 	}
 
-	if *stationID == "" || *startTime == "" {
+	filter := radiko.ProgramFilter{Title: *title, Keyword: *keyword}
+	if *batchFile == "" && (*stationID == "" || (*startTime == "" && filter.IsEmpty() && !*liveFlag)) {
 		logger.Info("使用方法:")
-		logger.Info("  go run main.go -station=TBS -start=\"2024-06-07 20:00\" -duration=60 -output=program.mp3")
-		logger.Info("  go run main.go -list  # 利用可能な局の一覧")
-		logger.Info("  go run main.go -config  # 設定ファイル生成")
-		logger.Info("  go run main.go -verbose  # 詳細ログを表示")
+		logger.Info("  go run . -station=TBS -start=\"2024-06-07 20:00\" -duration=60 -output=program.mp3")
+		logger.Info("  go run . -station=TBS -title=\"JUNK\"  # 番組名で検索して直近の放送を録音")
+		logger.Info("  go run . -station=TBS -keyword=\"深夜\" -all  # 一致する番組をすべて録音")
+		logger.Info("  go run . -station=TBS -live -duration=30  # ライブストリームを30分録音")
+		logger.Info("  go run . -list  # 利用可能な局の一覧")
+		logger.Info("  go run . -station=ABC -title=\"ラジオ\" -area=JP27  # 大阪のエリアとして認証して録音")
+		logger.Info("  go run . -logout  # radikoプレミアムからログアウト")
+		logger.Info("  go run . -config  # 設定ファイル生成")
+		logger.Info("  go run . -verbose  # 詳細ログを表示")
+		logger.Info("  go run . -station=TBS -title=\"JUNK\" -upload=s3://bucket/radio  # 録音後にアップロード")
+		logger.Info("  go run . feed -base-url=https://example.com/radio  # ポッドキャスト用のRSSフィードを生成")
+		logger.Info("  go run . -batch=recordings.json  # 一覧の番組をまとめて録音")
+		logger.Info("  go run . daemon -schedule=schedule.json  # スケジュールに従って定期的に録音")
+		logger.Info("  go run . library list  # 録音済みの番組の一覧")
+		logger.Info("  go run . catchup -station=TBS -keyword=\"深夜\" -since=7d  # 録音していない回をまとめて録音")
 		os.Exit(1)
 	}
 
@@ -64,65 +140,241 @@ func main() {
 		logger.Debug("局IDエイリアス: %s -> %s", originalStationID, *stationID)
 	}
 
-	// デフォルト録音時間の設定
-	if *duration == 0 {
-		*duration = config.DefaultDuration
-		logger.Debug("デフォルト録音時間を使用: %d分", *duration)
+	// Radikoクライアントを作成
+	client := radiko.NewClient()
+	client.SetLogger(logger)
+	client.ApplyConfig(config)
+
+	// Ctrl+Cで録音を中断できるようにする（途中までのファイルは削除される）
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var st storage.Storage
+	if config.UploadURL != "" {
+		if st, err = storage.Open(ctx, config.UploadURL); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+
+	lib, err := library.OpenConfigured(ctx, config.Library, nil)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	if *batchFile != "" {
+		recordBatch(ctx, client, config, logger, chapterOpts, st, lib, *batchFile)
+		return
+	}
+
+	if *liveFlag {
+		recordLive(ctx, client, config, logger, chapterOpts, st, *stationID, *duration, *output)
+		return
+	}
+
+	// 録音対象の番組を決定
+	var programs []radiko.Program
+	if *startTime == "" {
+		logger.Info("番組表を検索中: 番組名=%q, キーワード=%q", filter.Title, filter.Keyword)
+		found, err := client.FindTimeFreeProgramsContext(ctx, *stationID, filter, time.Now())
+		if err != nil {
+			logger.Fatal("番組検索に失敗: %v", err)
+		}
+		if !*allFlag {
+			found = found[len(found)-1:]
+		}
+		if len(found) > 1 && *output != "" && !strings.HasPrefix(*output, "yyyymmdd_hhmm.") {
+			logger.Fatal("複数番組を録音する場合は -output を省略するか yyyymmdd_hhmm.mp3 などを指定してください")
+		}
+		programs = found
+	} else {
+		// デフォルト録音時間の設定
+		if *duration == 0 {
+			*duration = config.DefaultDuration
+			logger.Debug("デフォルト録音時間を使用: %d分", *duration)
+		}
+
+		// 開始時間をパース（常に日本時間として解釈）
+		jst, tzErr := time.LoadLocation("Asia/Tokyo")
+		if tzErr != nil {
+			jst = time.FixedZone("JST", 9*60*60)
+		}
+		startDateTime, err := time.ParseInLocation("2006-01-02 15:04", *startTime, jst)
+		if err != nil {
+			logger.Fatal("時間の形式が正しくありません: %v", err)
+		}
+
+		// 時間の妥当性をチェック
+		if err := radiko.ValidateDateTime(startDateTime); err != nil {
+			logger.Fatal("時間の妥当性チェックエラー: %v", err)
+		}
+
+		programs = []radiko.Program{{
+			StationID: *stationID,
+			Start:     startDateTime,
+			End:       startDateTime.Add(time.Duration(*duration) * time.Minute),
+		}}
+	}
+
+	// 認証
+	logger.Info("radikoクライアント初期化...")
+	if err := client.AuthContext(ctx); err != nil {
+		logger.Fatal("クライアント初期化に失敗: %v", err)
+	}
+	logger.Info("初期化完了")
+
+	for _, p := range programs {
+		if !*force && alreadyRecorded(lib, logger, p) {
+			continue
+		}
+
+		// 出力ファイルパスを決定
+		outputFile, err := radiko.BuildOutputPath(config, *stationID, *output, p.Start)
+		if err != nil {
+			logger.Fatal("出力パス生成に失敗: %v", err)
+		}
+
+		logger.Info("録音設定:")
+		logger.Info("  局: %s", *stationID)
+		if p.Title != "" {
+			logger.Info("  番組: %s", p.Title)
+		}
+		logger.Info("  開始時間: %s", p.Start.Format("2006-01-02 15:04"))
+		logger.Info("  録音時間: %s", radiko.FormatDuration(p.Duration()))
+		logger.Info("  出力ファイル: %s", outputFile)
+
+		if err := record(ctx, client, config, logger, chapterOpts, st, lib, p, outputFile); err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		logger.Info("録音完了: %s", outputFile)
 	}
+}
+
+// listStations は認証で判定されたエリアの局一覧を表示する。
+// 取得できない場合は組み込みの関東エリア一覧を表示する
+func listStations(config *radiko.Config, logger *radiko.Logger) {
+	client := radiko.NewClient()
+	client.SetLogger(logger)
+	client.ApplyConfig(config)
 
-	// 開始時間をパース（常に日本時間として解釈）
-	jst, tzErr := time.LoadLocation("Asia/Tokyo")
-	if tzErr != nil {
-		jst = time.FixedZone("JST", 9*60*60)
+	var stations []radiko.Station
+	err := client.Auth()
+	if err == nil {
+		stations, err = client.ListStations(config.CacheDir)
 	}
-	startDateTime, err := time.ParseInLocation("2006-01-02 15:04", *startTime, jst)
 	if err != nil {
-		logger.Fatal("時間の形式が正しくありません: %v", err)
+		logger.Error("局一覧の取得に失敗したため組み込みの一覧を表示します: %v", err)
+		logger.Info("利用可能なラジオ局:")
+		for id, name := range radiko.GetAvailableStations() {
+			logger.Info("  %s: %s", id, name)
+		}
+		return
 	}
 
-	// 時間の妥当性をチェック
-	if err := radiko.ValidateDateTime(startDateTime); err != nil {
-		logger.Fatal("時間の妥当性チェックエラー: %v", err)
+	logger.Info("利用可能なラジオ局 (エリア: %s):", client.AreaID())
+	for _, s := range stations {
+		logger.Info("  %s: %s", s.ID, s.Name)
+	}
+}
+
+// recordLive はライブストリームを現在時刻から録音する
+func recordLive(ctx context.Context, client *radiko.Client, config *radiko.Config, logger *radiko.Logger, chapterOpts radiko.ChapterOptions, st storage.Storage, stationID string, duration int, output string) {
+	if duration == 0 {
+		duration = config.DefaultDuration
+		logger.Debug("デフォルト録音時間を使用: %d分", duration)
 	}
 
-	// 出力ファイルパスを決定
-	outputFile, err := radiko.BuildOutputPath(config, *stationID, *output, startDateTime)
+	start := time.Now()
+	outputFile, err := radiko.BuildOutputPath(config, stationID, output, start)
 	if err != nil {
 		logger.Fatal("出力パス生成に失敗: %v", err)
 	}
 
 	logger.Info("録音設定:")
-	logger.Info("  局: %s", *stationID)
-	logger.Info("  開始時間: %s", startDateTime.Format("2006-01-02 15:04"))
-	logger.Info("  録音時間: %s", radiko.FormatDuration(*duration))
+	logger.Info("  局: %s (ライブ)", stationID)
+	logger.Info("  録音時間: %s", radiko.FormatDuration(duration))
 	logger.Info("  出力ファイル: %s", outputFile)
 
-	// Radikoクライアントを作成
-	client := radiko.NewClient()
-	client.SetLogger(logger)
-
-	// 認証
 	logger.Info("radikoクライアント初期化...")
-	if err := client.Auth(); err != nil {
+	if err := client.AuthContext(ctx); err != nil {
 		logger.Fatal("クライアント初期化に失敗: %v", err)
 	}
 	logger.Info("初期化完了")
 
-	// ライブストリーム録音
 	logger.Info("ライブストリーム録音を開始...")
-	recFile := outputFile
-	if strings.HasSuffix(outputFile, ".mp3") {
-		recFile = strings.TrimSuffix(outputFile, ".mp3") + ".aac"
+	recFile := radiko.RecordingPath(outputFile)
+	recErr := client.RecordLive(ctx, stationID, time.Duration(duration)*time.Minute, recFile)
+	var partial *radiko.PartialRecordingError
+	if recErr != nil && !errors.As(recErr, &partial) {
+		logger.Fatal("%v", recordError(recErr))
 	}
-	if err := client.RecordTimeFree(*stationID, startDateTime, *duration, recFile); err != nil {
-		logger.Fatal("録音に失敗: %v", err)
+	if partial != nil {
+		// 時間切れでも途中までの録音は変換・アップロードしてから失敗として終了する
+		ctx = context.WithoutCancel(ctx)
 	}
-	if recFile != outputFile {
-		if err := radiko.ConvertToMP3(config.FFmpegPath, recFile, outputFile); err != nil {
-			logger.Fatal("変換に失敗: %v", err)
-		}
-		os.Remove(recFile)
+	if err := convert(ctx, config, recFile, outputFile); err != nil {
+		logger.Fatal("%v", err)
+	}
+	p := radiko.Program{StationID: stationID, Start: start, End: time.Now()}
+	md := tag(ctx, client, logger, chapterOpts, p, outputFile)
+	if _, err := publish(ctx, st, config, logger, md, p, outputFile); err != nil {
+		logger.Fatal("%v", err)
+	}
+	if partial != nil {
+		logger.Fatal("%v", recordError(partial))
 	}
 
 	logger.Info("録音完了: %s", outputFile)
 }
+
+// record はタイムフリー番組を録音して出力形式に変換し、保存先があればアップロードする
+func record(ctx context.Context, client *radiko.Client, config *radiko.Config, logger *radiko.Logger, chapterOpts radiko.ChapterOptions, st storage.Storage, lib *library.Library, p radiko.Program, outputFile string) error {
+	logger.Info("タイムフリー録音を開始...")
+	recFile := radiko.RecordingPath(outputFile)
+	if err := client.RecordTimeFreeContext(ctx, p.StationID, p.Start, p.Duration(), recFile); err != nil {
+		return recordError(err)
+	}
+	if err := convert(ctx, config, recFile, outputFile); err != nil {
+		return err
+	}
+	md := tag(ctx, client, logger, chapterOpts, p, outputFile)
+	upload, err := publish(ctx, st, config, logger, md, p, outputFile)
+	if err != nil {
+		return err
+	}
+	lib.TryRecord(ctx, logger, p, md.Album, outputFile, upload)
+	return nil
+}
+
+// recordError は録音エラーを利用者向けのメッセージに変換する。
+// エリア外の局の場合は録音できるエリアの指定方法を添える
+func recordError(err error) error {
+	var areaErr *radiko.StationAreaError
+	if errors.As(err, &areaErr) && len(areaErr.Areas) > 0 {
+		return fmt.Errorf("録音に失敗: %w。-area=%s を指定するか、radikoプレミアム（RADIKO_EMAIL / RADIKO_PASSWORD）でログインすると録音できます", err, areaErr.Areas[0])
+	}
+	return fmt.Errorf("録音に失敗: %w", err)
+}
+
+// tag は番組情報とチャプターを出力ファイルのタグとして書き込み、フィード用の番組情報を保存する。
+// 書き込めなかった場合はログに残して続ける
+func tag(ctx context.Context, client *radiko.Client, logger *radiko.Logger, chapterOpts radiko.ChapterOptions, p radiko.Program, outputFile string) radiko.Metadata {
+	md := client.ResolveMetadata(ctx, p)
+	md.Chapters = client.Chapters(ctx, p, chapterOpts)
+	writeEpisodeInfo(logger, md, p, outputFile)
+	if err := radiko.TagFile(outputFile, md); err != nil {
+		logger.Error("タグの書き込みに失敗: %v", err)
+		return md
+	}
+	logger.Debug("タグを書き込みました: %s", md.Title)
+	return md
+}
+
+// convert は録音ファイルを出力形式に変換する
+func convert(ctx context.Context, config *radiko.Config, recFile, outputFile string) error {
+	if err := radiko.ConvertAudioContext(ctx, config, recFile, outputFile); err != nil {
+		return fmt.Errorf("変換に失敗: %w", err)
+	}
+	os.Remove(recFile)
+	return nil
+}